@@ -0,0 +1,79 @@
+// Command fakealpaca serves the in-repo fake Alpaca API with demo accounts so
+// the app can run offline. Point the app at it with:
+//
+//	ALPACA_PAPER_BASE_URL=http://localhost:8090
+//	ALPACA_LIVE_BASE_URL=http://localhost:8090/live
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	flag.Parse()
+
+	fake := alpacatest.New()
+	now := time.Now()
+
+	fake.SetFixture("PKDEMO1", &alpacatest.Fixture{
+		Secret:  "demo-secret-1",
+		Account: alpacatest.NewAccount("demo-paper-0001", 104250, 103900),
+		Positions: []alpaca.Position{
+			alpacatest.NewPosition("AAPL", 50, 180, 192.5),
+			alpacatest.NewPosition("MSFT", 20, 410, 402.1),
+		},
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill("demo1-3", "MSFT", "buy", 20, 410, now.Add(-2*time.Hour)),
+			alpacatest.NewFill("demo1-2", "AAPL", "buy", 25, 185, now.Add(-26*time.Hour)),
+			alpacatest.NewFill("demo1-1", "AAPL", "buy", 25, 175, now.Add(-72*time.Hour)),
+		},
+		History: map[string]*alpaca.PortfolioHistory{
+			"": alpacatest.NewHistory(100000, 100000, 101200, 102800, 103900, 104250),
+		},
+	})
+
+	fake.SetFixture("PKDEMO2", &alpacatest.Fixture{
+		Secret:  "demo-secret-2",
+		Account: alpacatest.NewAccount("demo-paper-0002", 98700, 99100),
+		Positions: []alpaca.Position{
+			alpacatest.NewPosition("TSLA", 30, 250, 238.4),
+		},
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill("demo2-2", "NVDA", "sell", 10, 121, now.Add(-5*time.Hour)),
+			alpacatest.NewFill("demo2-1", "TSLA", "buy", 30, 250, now.Add(-48*time.Hour)),
+		},
+		History: map[string]*alpaca.PortfolioHistory{
+			"": alpacatest.NewHistory(100000, 100000, 99800, 99400, 99100, 98700),
+		},
+	})
+
+	fake.SetFixture("AKDEMO3", &alpacatest.Fixture{
+		Secret:  "demo-secret-3",
+		Live:    true,
+		Account: alpacatest.NewAccount("demo-live-0003", 25400, 25100),
+		History: map[string]*alpaca.PortfolioHistory{
+			"": alpacatest.NewHistory(25000, 25000, 25100, 25400),
+		},
+	})
+
+	fake.SetAssets([]alpaca.Asset{
+		alpacatest.NewAsset("AAPL", "Apple Inc. Common Stock"),
+		alpacatest.NewAsset("AMZN", "Amazon.com, Inc. Common Stock"),
+		alpacatest.NewAsset("MSFT", "Microsoft Corporation Common Stock"),
+		alpacatest.NewAsset("NVDA", "NVIDIA Corporation Common Stock"),
+		alpacatest.NewAsset("TSLA", "Tesla, Inc. Common Stock"),
+	})
+
+	log.Printf("Fake Alpaca listening on %s (paper at /, live at %s)", *addr, alpacatest.LivePrefix)
+	log.Printf("Demo logins: PKDEMO1/demo-secret-1, PKDEMO2/demo-secret-2 (paper), AKDEMO3/demo-secret-3 (live)")
+	if err := http.ListenAndServe(*addr, fake.Handler()); err != nil {
+		log.Fatalf("Fake Alpaca failed: %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package alpaca
 
 import (
 	"context"
+	"net/url"
+	"time"
 )
 
 type Account struct {
@@ -10,24 +12,24 @@ type Account struct {
 	Status                string  `json:"status"`
 	CryptoStatus          string  `json:"crypto_status"`
 	Currency              string  `json:"currency"`
-	BuyingPower           string  `json:"buying_power"`
-	Cash                  string  `json:"cash"`
-	PortfolioValue        string  `json:"portfolio_value"`
+	BuyingPower           Decimal `json:"buying_power"`
+	Cash                  Decimal `json:"cash"`
+	PortfolioValue        Decimal `json:"portfolio_value"`
 	PatternDayTrader      bool    `json:"pattern_day_trader"`
 	TradingBlocked        bool    `json:"trading_blocked"`
 	TransfersBlocked      bool    `json:"transfers_blocked"`
 	AccountBlocked        bool    `json:"account_blocked"`
 	CreatedAt             string  `json:"created_at"`
 	TradeSuspendedByUser  bool    `json:"trade_suspended_by_user"`
-	Multiplier            string  `json:"multiplier"`
+	Multiplier            Decimal `json:"multiplier"`
 	ShortingEnabled       bool    `json:"shorting_enabled"`
-	Equity                string  `json:"equity"`
-	LastEquity            string  `json:"last_equity"`
-	LongMarketValue       string  `json:"long_market_value"`
-	ShortMarketValue      string  `json:"short_market_value"`
-	InitialMargin         string  `json:"initial_margin"`
-	MaintenanceMargin     string  `json:"maintenance_margin"`
-	LastMaintenanceMargin string  `json:"last_maintenance_margin"`
+	Equity                Decimal `json:"equity"`
+	LastEquity            Decimal `json:"last_equity"`
+	LongMarketValue       Decimal `json:"long_market_value"`
+	ShortMarketValue      Decimal `json:"short_market_value"`
+	InitialMargin         Decimal `json:"initial_margin"`
+	MaintenanceMargin     Decimal `json:"maintenance_margin"`
+	LastMaintenanceMargin Decimal `json:"last_maintenance_margin"`
 	DaytradeCount         int     `json:"daytrade_count"`
 	BalanceAsOf           string  `json:"balance_asof"`
 }
@@ -49,12 +51,12 @@ func (c *Client) GetAccount(ctx context.Context) (*Account, error) {
 
 // PortfolioHistory represents portfolio history data
 type PortfolioHistory struct {
-	Timestamp      []int64   `json:"timestamp"`
-	Equity         []float64 `json:"equity"`
-	ProfitLoss     []float64 `json:"profit_loss"`
-	ProfitLossPct  []float64 `json:"profit_loss_pct"`
-	BaseValue      float64   `json:"base_value"`
-	Timeframe      string    `json:"timeframe"`
+	Timestamp     []int64   `json:"timestamp"`
+	Equity        []float64 `json:"equity"`
+	ProfitLoss    []float64 `json:"profit_loss"`
+	ProfitLossPct []float64 `json:"profit_loss_pct"`
+	BaseValue     float64   `json:"base_value"`
+	Timeframe     string    `json:"timeframe"`
 }
 
 // GetPortfolioHistory retrieves portfolio history
@@ -76,3 +78,28 @@ func (c *Client) GetPortfolioHistory(ctx context.Context, period, timeframe stri
 
 	return &history, nil
 }
+
+// GetPortfolioHistoryRange retrieves portfolio history between start and end.
+// A zero end time returns history up to the present.
+func (c *Client) GetPortfolioHistoryRange(ctx context.Context, start, end time.Time, timeframe string) (*PortfolioHistory, error) {
+	params := url.Values{}
+	params.Set("start", start.UTC().Format(time.RFC3339))
+	if !end.IsZero() {
+		params.Set("end", end.UTC().Format(time.RFC3339))
+	}
+	if timeframe != "" {
+		params.Set("timeframe", timeframe)
+	}
+
+	resp, err := c.doRequest(ctx, "GET", "/v2/account/portfolio/history?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var history PortfolioHistory
+	if err := c.decodeResponse(resp, &history); err != nil {
+		return nil, err
+	}
+
+	return &history, nil
+}
@@ -2,6 +2,10 @@ package alpaca
 
 import (
 	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Activity struct {
@@ -9,19 +13,96 @@ type Activity struct {
 	ActivityType    string  `json:"activity_type"`
 	TransactionTime string  `json:"transaction_time"`
 	Type            string  `json:"type"`
-	Price           string  `json:"price"`
-	Qty             string  `json:"qty"`
+	Price           Decimal `json:"price"`
+	Qty             Decimal `json:"qty"`
 	Side            string  `json:"side"`
 	Symbol          string  `json:"symbol"`
-	LeavesQty       string  `json:"leaves_qty"`
+	LeavesQty       Decimal `json:"leaves_qty"`
 	OrderID         string  `json:"order_id"`
-	CumQty          string  `json:"cum_qty"`
+	CumQty          Decimal `json:"cum_qty"`
 	OrderStatus     string  `json:"order_status"`
+
+	// Non-trade activities (deposits, withdrawals, journals) carry a date and
+	// a signed amount instead of a fill
+	Date        string  `json:"date"`
+	NetAmount   Decimal `json:"net_amount"`
+	Description string  `json:"description"`
 }
 
-// GetActivities retrieves account activities
+const (
+	// ActivityTypeFill is the activity type for trade executions
+	ActivityTypeFill = "FILL"
+
+	// Non-trade activity types that move cash into or out of an account
+	ActivityTypeDeposit    = "CSD"
+	ActivityTypeWithdrawal = "CSW"
+	ActivityTypeJournal    = "JNLC"
+
+	DirectionAsc  = "asc"
+	DirectionDesc = "desc"
+
+	// MaxActivitiesPageSize is the largest page Alpaca returns for activities
+	MaxActivitiesPageSize = 100
+)
+
+// CashFlowActivityTypes are the activity types for external cash flows
+var CashFlowActivityTypes = []string{ActivityTypeDeposit, ActivityTypeWithdrawal, ActivityTypeJournal}
+
+// ActivitiesQuery filters and pages a request to /v2/account/activities.
+// Zero values are omitted so Alpaca's defaults apply.
+type ActivitiesQuery struct {
+	ActivityTypes []string
+	Date          time.Time // a single trading day; After and Until are ignored when set
+	After         time.Time
+	Until         time.Time
+	Direction     string // DirectionAsc or DirectionDesc (Alpaca defaults to desc)
+	PageSize      int
+	PageToken     string // ID of the last activity from the previous page
+}
+
+// values encodes the query as URL parameters
+func (q ActivitiesQuery) values() url.Values {
+	params := url.Values{}
+	if len(q.ActivityTypes) > 0 {
+		params.Set("activity_types", strings.Join(q.ActivityTypes, ","))
+	}
+	// Alpaca rejects date combined with after or until
+	if !q.Date.IsZero() {
+		params.Set("date", q.Date.Format("2006-01-02"))
+	} else {
+		if !q.After.IsZero() {
+			params.Set("after", q.After.UTC().Format(time.RFC3339))
+		}
+		if !q.Until.IsZero() {
+			params.Set("until", q.Until.UTC().Format(time.RFC3339))
+		}
+	}
+	if q.Direction != "" {
+		params.Set("direction", q.Direction)
+	}
+	if q.PageSize > 0 {
+		params.Set("page_size", strconv.Itoa(q.PageSize))
+	}
+	if q.PageToken != "" {
+		params.Set("page_token", q.PageToken)
+	}
+	return params
+}
+
+// GetActivities retrieves the first page of account activities.
+// Use ListActivities or Activities to read past the first page.
 func (c *Client) GetActivities(ctx context.Context) ([]Activity, error) {
-	resp, err := c.doRequest(ctx, "GET", "/v2/account/activities", nil)
+	return c.GetActivitiesPage(ctx, ActivitiesQuery{})
+}
+
+// GetActivitiesPage retrieves a single page of account activities matching the query
+func (c *Client) GetActivitiesPage(ctx context.Context, query ActivitiesQuery) ([]Activity, error) {
+	path := "/v2/account/activities"
+	if params := query.values(); len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	resp, err := c.doRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -34,6 +115,28 @@ func (c *Client) GetActivities(ctx context.Context) ([]Activity, error) {
 	return activities, nil
 }
 
+// ListActivities walks pages of activities matching the query until limit
+// activities have been collected. A limit of 0 reads every page.
+func (c *Client) ListActivities(ctx context.Context, query ActivitiesQuery, limit int) ([]Activity, error) {
+	if limit > 0 && (query.PageSize == 0 || query.PageSize > limit) {
+		query.PageSize = min(limit, MaxActivitiesPageSize)
+	}
+
+	var activities []Activity
+	iter := c.Activities(ctx, query)
+	for iter.Next() {
+		activities = append(activities, iter.Activity())
+		if limit > 0 && len(activities) >= limit {
+			break
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return activities, nil
+}
+
 // GetActivitiesByType retrieves account activities filtered by type
 func (c *Client) GetActivitiesByType(ctx context.Context, activityType string) ([]Activity, error) {
 	path := "/v2/account/activities/" + activityType
@@ -50,3 +153,81 @@ func (c *Client) GetActivitiesByType(ctx context.Context, activityType string) (
 
 	return activities, nil
 }
+
+// ActivityIterator walks every page of an activities query, fetching the next
+// page only once the current one is exhausted:
+//
+//	iter := client.Activities(ctx, query)
+//	for iter.Next() {
+//		act := iter.Activity()
+//	}
+//	if err := iter.Err(); err != nil { ... }
+type ActivityIterator struct {
+	ctx     context.Context
+	client  *Client
+	query   ActivitiesQuery
+	page    []Activity
+	index   int
+	current Activity
+	done    bool
+	err     error
+}
+
+// Activities returns an iterator over all activities matching the query
+func (c *Client) Activities(ctx context.Context, query ActivitiesQuery) *ActivityIterator {
+	if query.PageSize <= 0 || query.PageSize > MaxActivitiesPageSize {
+		query.PageSize = MaxActivitiesPageSize
+	}
+	return &ActivityIterator{ctx: ctx, client: c, query: query}
+}
+
+// Next advances to the next activity, fetching a new page when needed.
+// It returns false when the activities are exhausted, the context is
+// cancelled, or a request fails.
+func (it *ActivityIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+
+	if it.index >= len(it.page) {
+		if it.done {
+			return false
+		}
+
+		page, err := it.client.GetActivitiesPage(it.ctx, it.query)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		// A short page is the last one
+		if len(page) < it.query.PageSize {
+			it.done = true
+		}
+		if len(page) == 0 {
+			return false
+		}
+
+		it.page = page
+		it.index = 0
+		it.query.PageToken = page[len(page)-1].ID
+	}
+
+	it.current = it.page[it.index]
+	it.index++
+	return true
+}
+
+// Activity returns the activity at the iterator's current position
+func (it *ActivityIterator) Activity() Activity {
+	return it.current
+}
+
+// Err returns the error that stopped iteration, if any
+func (it *ActivityIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,126 @@
+package alpacatest
+
+import (
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+)
+
+// NewAccount returns an active account with the given ID, equity and
+// previous-close equity, holding its equity as cash
+func NewAccount(id string, equity, lastEquity float64) alpaca.Account {
+	return alpaca.Account{
+		ID:             id,
+		AccountNumber:  id,
+		Status:         "ACTIVE",
+		Currency:       "USD",
+		Equity:         amount(equity),
+		LastEquity:     amount(lastEquity),
+		Cash:           amount(equity),
+		BuyingPower:    amount(equity).Mul(alpaca.NewDecimalFromInt(2)),
+		PortfolioValue: amount(equity),
+		Multiplier:     alpaca.NewDecimalFromInt(2),
+		CreatedAt:      time.Now().AddDate(-1, 0, 0).UTC().Format(time.RFC3339),
+	}
+}
+
+// NewAsset returns an active, tradable and fractionable equity
+func NewAsset(symbol, name string) alpaca.Asset {
+	return alpaca.Asset{
+		ID:           symbol,
+		Class:        "us_equity",
+		Exchange:     "NASDAQ",
+		Symbol:       symbol,
+		Name:         name,
+		Status:       alpaca.AssetStatusActive,
+		Tradable:     true,
+		Marginable:   true,
+		Shortable:    true,
+		EasyToBorrow: true,
+		Fractionable: true,
+	}
+}
+
+// NewPosition returns a long equity position
+func NewPosition(symbol string, qty, avgEntryPrice, currentPrice float64) alpaca.Position {
+	marketValue := amount(qty).Mul(amount(currentPrice))
+	costBasis := amount(qty).Mul(amount(avgEntryPrice))
+	unrealizedPL := marketValue.Sub(costBasis)
+
+	var unrealizedPLPC alpaca.Decimal
+	if !costBasis.IsZero() {
+		unrealizedPLPC = unrealizedPL.Div(costBasis)
+	}
+
+	return alpaca.Position{
+		AssetID:        symbol,
+		Symbol:         symbol,
+		Exchange:       "NASDAQ",
+		AssetClass:     "us_equity",
+		Qty:            amount(qty),
+		QtyAvailable:   amount(qty),
+		AvgEntryPrice:  amount(avgEntryPrice),
+		Side:           "long",
+		MarketValue:    marketValue,
+		CostBasis:      costBasis,
+		UnrealizedPL:   unrealizedPL,
+		UnrealizedPLPC: unrealizedPLPC,
+		CurrentPrice:   amount(currentPrice),
+		LastdayPrice:   amount(currentPrice),
+	}
+}
+
+// NewFill returns a FILL activity for a trade
+func NewFill(id, symbol, side string, qty, price float64, at time.Time) alpaca.Activity {
+	return alpaca.Activity{
+		ID:              id,
+		ActivityType:    alpaca.ActivityTypeFill,
+		TransactionTime: at.UTC().Format(time.RFC3339),
+		Type:            "fill",
+		Price:           amount(price),
+		Qty:             amount(qty),
+		Side:            side,
+		Symbol:          symbol,
+		LeavesQty:       alpaca.Decimal{},
+		CumQty:          amount(qty),
+		OrderID:         id + "-order",
+		OrderStatus:     "filled",
+	}
+}
+
+// NewCashFlow returns a non-trade activity moving amount into (positive) or
+// out of (negative) the account on the given day
+func NewCashFlow(id, activityType string, amt float64, on time.Time) alpaca.Activity {
+	return alpaca.Activity{
+		ID:           id,
+		ActivityType: activityType,
+		Date:         alpaca.MarketDate(on),
+		NetAmount:    amount(amt),
+	}
+}
+
+// NewHistory returns a daily portfolio history with one point per equity value,
+// ending today
+func NewHistory(baseValue float64, equities ...float64) *alpaca.PortfolioHistory {
+	history := &alpaca.PortfolioHistory{
+		BaseValue: baseValue,
+		Timeframe: "1D",
+	}
+
+	start := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -(len(equities) - 1))
+	for i, equity := range equities {
+		history.Timestamp = append(history.Timestamp, start.AddDate(0, 0, i).Unix())
+		history.Equity = append(history.Equity, equity)
+		history.ProfitLoss = append(history.ProfitLoss, equity-baseValue)
+		pct := 0.0
+		if baseValue != 0 {
+			pct = (equity - baseValue) / baseValue
+		}
+		history.ProfitLossPct = append(history.ProfitLossPct, pct)
+	}
+	return history
+}
+
+func amount(v float64) alpaca.Decimal {
+	return alpaca.NewDecimalFromFloat(v)
+}
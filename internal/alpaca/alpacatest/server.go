@@ -0,0 +1,359 @@
+// Package alpacatest provides an in-memory fake of the Alpaca trading API for
+// tests and offline development.
+//
+// Each account is registered under its API key with a scriptable Fixture. The
+// paper API is served at the server root and the live API under /live, so a
+// fixture's Live flag decides which endpoint accepts its credentials.
+package alpacatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+)
+
+// LivePrefix is the path prefix the fake serves the live trading API under
+const LivePrefix = "/live"
+
+// maxRecordedRequests bounds the request log so a long-running fake doesn't grow forever
+const maxRecordedRequests = 1000
+
+// Fixture is the scripted state of one fake Alpaca account
+type Fixture struct {
+	Secret    string
+	Live      bool
+	Account   alpaca.Account
+	Positions []alpaca.Position
+	// Activities are returned newest first, the same order Alpaca uses by default
+	Activities []alpaca.Activity
+	// History is keyed by the requested period ("1D", "1W", ...). Range requests
+	// and unknown periods fall back to the "" entry.
+	History map[string]*alpaca.PortfolioHistory
+	// Status, when non-zero, makes requests for this account fail with it
+	Status int
+	// FailRequests limits Status to the next N requests; 0 fails them all
+	FailRequests int
+	// RetryAfter, when set, is sent as the Retry-After header on failures
+	RetryAfter string
+}
+
+// Server is a fake Alpaca API backed by registered fixtures
+type Server struct {
+	mu       sync.Mutex
+	fixtures map[string]*Fixture
+	assets   []alpaca.Asset
+	requests []*http.Request
+	server   *httptest.Server
+}
+
+// New creates a fake without starting a listener; serve it with Handler
+func New() *Server {
+	return &Server{fixtures: make(map[string]*Fixture)}
+}
+
+// NewServer creates and starts a fake on a local httptest listener
+func NewServer() *Server {
+	s := New()
+	s.server = httptest.NewServer(s.Handler())
+	return s
+}
+
+// URL returns the paper API base URL of a started server
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// LiveURL returns the live API base URL of a started server
+func (s *Server) LiveURL() string {
+	return s.server.URL + LivePrefix
+}
+
+// Close shuts down a started server
+func (s *Server) Close() {
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// UseAsDefault points alpaca.PaperBaseURL and alpaca.LiveBaseURL at the server
+// so clients built anywhere in the app talk to it. The returned func restores
+// the previous values.
+func (s *Server) UseAsDefault() func() {
+	paper, live := alpaca.PaperBaseURL, alpaca.LiveBaseURL
+	alpaca.PaperBaseURL, alpaca.LiveBaseURL = s.URL(), s.LiveURL()
+	return func() {
+		alpaca.PaperBaseURL, alpaca.LiveBaseURL = paper, live
+	}
+}
+
+// Client returns a client for a registered account pointed at the server
+func (s *Server) Client(apiKey string) *alpaca.Client {
+	s.mu.Lock()
+	fixture := s.fixtures[apiKey]
+	s.mu.Unlock()
+
+	if fixture == nil {
+		return alpaca.NewClient(apiKey, "", alpaca.WithBaseURL(s.URL()))
+	}
+
+	baseURL := s.URL()
+	if fixture.Live {
+		baseURL = s.LiveURL()
+	}
+	return alpaca.NewClient(apiKey, fixture.Secret, alpaca.WithLive(fixture.Live), alpaca.WithBaseURL(baseURL))
+}
+
+// SetFixture registers or replaces the account for an API key
+func (s *Server) SetFixture(apiKey string, fixture *Fixture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures[apiKey] = fixture
+}
+
+// SetAssets replaces the asset catalog served to every account
+func (s *Server) SetAssets(assets []alpaca.Asset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.assets = assets
+}
+
+// Update mutates a registered fixture under the server's lock
+func (s *Server) Update(apiKey string, fn func(*Fixture)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fixture, ok := s.fixtures[apiKey]; ok {
+		fn(fixture)
+	}
+}
+
+// Requests returns the requests received so far, oldest first
+func (s *Server) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+// RequestCount returns how many requests hit the given path (without query)
+func (s *Server) RequestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, r := range s.requests {
+		if r.URL.Path == path {
+			count++
+		}
+	}
+	return count
+}
+
+// Handler returns the fake's HTTP handler
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(s.serveHTTP)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	if len(s.requests) > maxRecordedRequests {
+		s.requests = s.requests[len(s.requests)-maxRecordedRequests:]
+	}
+	fixture, ok := s.fixtures[r.Header.Get("APCA-API-KEY-ID")]
+	s.mu.Unlock()
+
+	path := r.URL.Path
+	live := strings.HasPrefix(path, LivePrefix+"/")
+	if live {
+		path = strings.TrimPrefix(path, LivePrefix)
+	}
+
+	if !ok || fixture.Secret != r.Header.Get("APCA-API-SECRET-KEY") || fixture.Live != live {
+		writeError(w, http.StatusUnauthorized, "request is not authorized")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fixture.Status != 0 {
+		if fixture.RetryAfter != "" {
+			w.Header().Set("Retry-After", fixture.RetryAfter)
+		}
+		status := fixture.Status
+		if fixture.FailRequests > 0 {
+			fixture.FailRequests--
+			if fixture.FailRequests == 0 {
+				fixture.Status = 0
+			}
+		}
+		writeError(w, status, http.StatusText(status))
+		return
+	}
+
+	switch path {
+	case "/v2/account":
+		writeJSON(w, fixture.Account)
+	case "/v2/positions":
+		writeJSON(w, nonNil(fixture.Positions))
+	case "/v2/account/activities":
+		activities, status, msg := queryActivities(fixture.Activities, r)
+		if status != http.StatusOK {
+			writeError(w, status, msg)
+			return
+		}
+		writeJSON(w, activities)
+	case "/v2/account/portfolio/history":
+		writeJSON(w, portfolioHistory(fixture.History, r))
+	case "/v2/assets":
+		writeJSON(w, queryAssets(s.assets, r))
+	default:
+		if symbol, ok := strings.CutPrefix(path, "/v2/assets/"); ok {
+			for _, asset := range s.assets {
+				if asset.Symbol == symbol || asset.ID == symbol {
+					writeJSON(w, asset)
+					return
+				}
+			}
+			writeError(w, http.StatusNotFound, "asset not found")
+			return
+		}
+		writeError(w, http.StatusNotFound, "endpoint not found")
+	}
+}
+
+// queryAssets applies Alpaca's asset filters to the catalog
+func queryAssets(all []alpaca.Asset, r *http.Request) []alpaca.Asset {
+	q := r.URL.Query()
+	assets := make([]alpaca.Asset, 0, len(all))
+	for _, asset := range all {
+		if v := q.Get("status"); v != "" && asset.Status != v {
+			continue
+		}
+		if v := q.Get("asset_class"); v != "" && asset.Class != v {
+			continue
+		}
+		if v := q.Get("exchange"); v != "" && asset.Exchange != v {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+	return assets
+}
+
+// queryActivities applies Alpaca's activity filters and paging to a fixture
+func queryActivities(all []alpaca.Activity, r *http.Request) ([]alpaca.Activity, int, string) {
+	q := r.URL.Query()
+
+	types := map[string]bool{}
+	if v := q.Get("activity_types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			types[t] = true
+		}
+	}
+
+	var after, until time.Time
+	if v := q.Get("after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, http.StatusUnprocessableEntity, "invalid after"
+		}
+		after = t
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, http.StatusUnprocessableEntity, "invalid until"
+		}
+		until = t
+	}
+	date := q.Get("date")
+
+	filtered := make([]alpaca.Activity, 0, len(all))
+	for _, act := range all {
+		if len(types) > 0 && !types[act.ActivityType] {
+			continue
+		}
+		if !after.IsZero() || !until.IsZero() || date != "" {
+			t, err := time.Parse(time.RFC3339, act.TransactionTime)
+			if err != nil {
+				continue
+			}
+			if !after.IsZero() && !t.After(after) {
+				continue
+			}
+			if !until.IsZero() && !t.Before(until) {
+				continue
+			}
+			if date != "" && t.UTC().Format("2006-01-02") != date {
+				continue
+			}
+		}
+		filtered = append(filtered, act)
+	}
+
+	if q.Get("direction") == alpaca.DirectionAsc {
+		for i, j := 0, len(filtered)-1; i < j; i, j = i+1, j-1 {
+			filtered[i], filtered[j] = filtered[j], filtered[i]
+		}
+	}
+
+	start := 0
+	if token := q.Get("page_token"); token != "" {
+		start = len(filtered)
+		for i, act := range filtered {
+			if act.ID == token {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	pageSize := alpaca.MaxActivitiesPageSize
+	if v := q.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > alpaca.MaxActivitiesPageSize {
+			return nil, http.StatusUnprocessableEntity, "invalid page_size"
+		}
+		pageSize = n
+	}
+
+	end := min(start+pageSize, len(filtered))
+	return filtered[start:end], http.StatusOK, ""
+}
+
+// portfolioHistory picks the fixture history for the requested period
+func portfolioHistory(history map[string]*alpaca.PortfolioHistory, r *http.Request) *alpaca.PortfolioHistory {
+	q := r.URL.Query()
+	if q.Get("start") == "" {
+		if h, ok := history[q.Get("period")]; ok {
+			return h
+		}
+	}
+	if h, ok := history[""]; ok {
+		return h
+	}
+	return &alpaca.PortfolioHistory{}
+}
+
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"code": status * 10000, "message": message})
+}
@@ -0,0 +1,83 @@
+package alpaca
+
+import (
+	"context"
+	"net/url"
+)
+
+type Asset struct {
+	ID           string `json:"id"`
+	Class        string `json:"class"`
+	Exchange     string `json:"exchange"`
+	Symbol       string `json:"symbol"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	Tradable     bool   `json:"tradable"`
+	Marginable   bool   `json:"marginable"`
+	Shortable    bool   `json:"shortable"`
+	EasyToBorrow bool   `json:"easy_to_borrow"`
+	Fractionable bool   `json:"fractionable"`
+}
+
+const (
+	AssetStatusActive   = "active"
+	AssetStatusInactive = "inactive"
+)
+
+// AssetsQuery filters a request to /v2/assets. Zero values are omitted so
+// Alpaca's defaults apply.
+type AssetsQuery struct {
+	Status     string // AssetStatusActive or AssetStatusInactive
+	AssetClass string // e.g. "us_equity" or "crypto"
+	Exchange   string
+}
+
+func (q AssetsQuery) values() url.Values {
+	params := url.Values{}
+	if q.Status != "" {
+		params.Set("status", q.Status)
+	}
+	if q.AssetClass != "" {
+		params.Set("asset_class", q.AssetClass)
+	}
+	if q.Exchange != "" {
+		params.Set("exchange", q.Exchange)
+	}
+	return params
+}
+
+// ListAssets retrieves every asset matching the query. Alpaca returns the
+// whole list in one response.
+func (c *Client) ListAssets(ctx context.Context, query AssetsQuery) ([]Asset, error) {
+	path := "/v2/assets"
+	if params := query.values(); len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	resp, err := c.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []Asset
+	if err := c.decodeResponse(resp, &assets); err != nil {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+// GetAsset retrieves a single asset by symbol or asset ID
+func (c *Client) GetAsset(ctx context.Context, symbolOrID string) (*Asset, error) {
+	resp, err := c.doRequest(ctx, "GET", "/v2/assets/"+url.PathEscape(symbolOrID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var asset Asset
+	if err := c.decodeResponse(resp, &asset); err != nil {
+		return nil, err
+	}
+
+	return &asset, nil
+}
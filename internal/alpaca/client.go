@@ -3,15 +3,19 @@ package alpaca
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
-const (
-	// Use paper trading API for development
-	BaseURL = "https://paper-api.alpaca.markets"
+// Default API hosts. These are variables so they can be pointed elsewhere at
+// startup (e.g. a local fake server) without threading options everywhere.
+var (
+	PaperBaseURL = "https://paper-api.alpaca.markets"
+	LiveBaseURL  = "https://api.alpaca.markets"
 )
 
 type Client struct {
@@ -19,47 +23,164 @@ type Client struct {
 	apiKey     string
 	apiSecret  string
 	baseURL    string
+	live       bool
+
+	onUnauthorized func()
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithBaseURL overrides the trading API base URL, whichever account type the
+// client is for
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithLive points the client at the live trading API instead of paper
+func WithLive(live bool) Option {
+	return func(c *Client) {
+		c.live = live
+	}
 }
 
-// NewClient creates a new Alpaca API client with API key authentication
-func NewClient(apiKey, apiSecret string) *Client {
-	return &Client{
+// WithOnUnauthorized registers a callback run whenever Alpaca rejects the
+// client's credentials (401), e.g. to revoke a stored session whose key was
+// regenerated or deleted
+func WithOnUnauthorized(fn func()) Option {
+	return func(c *Client) {
+		c.onUnauthorized = fn
+	}
+}
+
+// NewClient creates a new Alpaca API client with API key authentication.
+// Without options it talks to the paper trading API.
+func NewClient(apiKey, apiSecret string, opts ...Option) *Client {
+	c := &Client{
 		httpClient: &http.Client{Timeout: 30 * time.Second},
 		apiKey:     apiKey,
 		apiSecret:  apiSecret,
-		baseURL:    BaseURL,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.baseURL == "" {
+		c.baseURL = PaperBaseURL
+		if c.live {
+			c.baseURL = LiveBaseURL
+		}
+	}
+	return c
+}
+
+// IsLive reports whether the client trades against the live API
+func (c *Client) IsLive() bool {
+	return c.live
 }
 
-// doRequest performs an HTTP request with authentication
+// Connect validates credentials by fetching the account, trying the paper API
+// first and then the live API. Alpaca keys only work against the environment
+// they were issued for, so whichever succeeds identifies the account type.
+func Connect(ctx context.Context, apiKey, apiSecret string) (*Client, *Account, error) {
+	var errs []error
+	for _, live := range []bool{false, true} {
+		client := NewClient(apiKey, apiSecret, WithLive(live))
+		account, err := client.GetAccount(ctx)
+		if err == nil {
+			return client, account, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, nil, fmt.Errorf("credentials rejected by paper and live APIs: %w", errors.Join(errs...))
+}
+
+// Retry policy for rate limited (429) and server error (5xx) responses
+const (
+	maxRetries     = 3
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+// doRequest performs an HTTP request with authentication. Requests wait on the
+// API key's rate limiter, and bodiless requests that hit a 429 or 5xx are
+// retried with exponential backoff, honoring Retry-After when Alpaca sends it.
+// A Retry-After longer than maxBackoff fails the request instead of waiting.
+// Failed responses are returned as *APIError.
 func (c *Client) doRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
 	url := c.baseURL + path
+	limiter := limiterFor(c.apiKey)
+	backoff := initialBackoff
 
-	req, err := http.NewRequestWithContext(ctx, method, url, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	for attempt := 0; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return nil, err
+		}
 
-	req.Header.Set("APCA-API-KEY-ID", c.apiKey)
-	req.Header.Set("APCA-API-SECRET-KEY", c.apiSecret)
-	req.Header.Set("Content-Type", "application/json")
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
+		req.Header.Set("APCA-API-KEY-ID", c.apiKey)
+		req.Header.Set("APCA-API-SECRET-KEY", c.apiSecret)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
 
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode < 400 {
+			return resp, nil
+		}
+
+		respBody, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		apiErr := newAPIError(resp, respBody)
+
+		if resp.StatusCode == http.StatusUnauthorized && c.onUnauthorized != nil {
+			c.onUnauthorized()
+		}
+
+		// A request body can't be replayed, so only bodiless requests are retried
+		if !apiErr.retryable() || body != nil || attempt == maxRetries {
+			return nil, apiErr
+		}
+
+		delay := backoff
+		if apiErr.RetryAfter > maxBackoff {
+			return nil, apiErr
+		}
+		if apiErr.RetryAfter >= 0 {
+			delay = apiErr.RetryAfter
+		}
+		backoff = min(backoff*2, maxBackoff)
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, apiErr
+		}
 	}
+}
 
-	return resp, nil
+// sleep waits for d or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // decodeResponse decodes a JSON response into the target struct
 func (c *Client) decodeResponse(resp *http.Response, target interface{}) error {
 	defer resp.Body.Close()
-	return json.NewDecoder(resp.Body).Decode(target)
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
 }
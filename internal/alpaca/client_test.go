@@ -0,0 +1,277 @@
+package alpaca_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func newFake(t *testing.T) *alpacatest.Server {
+	t.Helper()
+	fake := alpacatest.NewServer()
+	t.Cleanup(fake.Close)
+	t.Cleanup(fake.UseAsDefault())
+	return fake
+}
+
+func TestConnectDetectsAccountType(t *testing.T) {
+	fake := newFake(t)
+	fake.SetFixture("PKPAPER", &alpacatest.Fixture{
+		Secret:  "paper-secret",
+		Account: alpacatest.NewAccount("paper-account", 100000, 100000),
+	})
+	fake.SetFixture("AKLIVE", &alpacatest.Fixture{
+		Secret:  "live-secret",
+		Live:    true,
+		Account: alpacatest.NewAccount("live-account", 5000, 5000),
+	})
+
+	client, account, err := alpaca.Connect(context.Background(), "PKPAPER", "paper-secret")
+	if err != nil {
+		t.Fatalf("Connect paper: %v", err)
+	}
+	if client.IsLive() || account.ID != "paper-account" {
+		t.Errorf("Expected paper account, got live=%v id=%s", client.IsLive(), account.ID)
+	}
+
+	client, account, err = alpaca.Connect(context.Background(), "AKLIVE", "live-secret")
+	if err != nil {
+		t.Fatalf("Connect live: %v", err)
+	}
+	if !client.IsLive() || account.ID != "live-account" {
+		t.Errorf("Expected live account, got live=%v id=%s", client.IsLive(), account.ID)
+	}
+
+	if _, _, err := alpaca.Connect(context.Background(), "PKPAPER", "wrong"); err == nil {
+		t.Error("Expected bad credentials to be rejected")
+	}
+}
+
+func TestExplicitBaseURLOverridesAccountType(t *testing.T) {
+	fake := newFake(t)
+	fake.SetFixture("AKLIVE", &alpacatest.Fixture{
+		Secret:  "live-secret",
+		Live:    true,
+		Account: alpacatest.NewAccount("live-account", 5000, 5000),
+	})
+
+	// A proxy in front of the live API is used whichever option comes first,
+	// rather than the default live host
+	alpaca.LiveBaseURL = "http://127.0.0.1:0"
+	for _, opts := range [][]alpaca.Option{
+		{alpaca.WithBaseURL(fake.LiveURL()), alpaca.WithLive(true)},
+		{alpaca.WithLive(true), alpaca.WithBaseURL(fake.LiveURL())},
+	} {
+		client := alpaca.NewClient("AKLIVE", "live-secret", opts...)
+		if _, err := client.GetAccount(context.Background()); err != nil || !client.IsLive() {
+			t.Errorf("Expected the explicit base URL for a live client, got live=%v (%v)", client.IsLive(), err)
+		}
+	}
+}
+
+func TestListActivitiesWalksPages(t *testing.T) {
+	fake := newFake(t)
+
+	start := time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)
+	var activities []alpaca.Activity
+	for i := 250; i > 0; i-- {
+		at := start.Add(time.Duration(i) * time.Hour)
+		activities = append(activities, alpacatest.NewFill(fmt.Sprintf("fill-%03d", i), "AAPL", "buy", 1, 100, at))
+		if i%50 == 0 {
+			activities = append(activities, alpaca.Activity{ID: fmt.Sprintf("div-%03d", i), ActivityType: "DIV"})
+		}
+	}
+	fake.SetFixture("PK", &alpacatest.Fixture{Secret: "s", Activities: activities})
+	client := fake.Client("PK")
+
+	query := alpaca.ActivitiesQuery{ActivityTypes: []string{alpaca.ActivityTypeFill}}
+	all, err := client.ListActivities(context.Background(), query, 0)
+	if err != nil {
+		t.Fatalf("ListActivities: %v", err)
+	}
+	if len(all) != 250 {
+		t.Fatalf("Expected 250 fills, got %d", len(all))
+	}
+	if all[0].ID != "fill-250" || all[249].ID != "fill-001" {
+		t.Errorf("Unexpected order: first=%s last=%s", all[0].ID, all[249].ID)
+	}
+	if got := fake.RequestCount("/v2/account/activities"); got != 3 {
+		t.Errorf("Expected 3 page requests, got %d", got)
+	}
+
+	limited, err := client.ListActivities(context.Background(), query, 21)
+	if err != nil {
+		t.Fatalf("ListActivities with limit: %v", err)
+	}
+	if len(limited) != 21 {
+		t.Errorf("Expected 21 fills, got %d", len(limited))
+	}
+}
+
+func TestActivitiesDateExcludesRange(t *testing.T) {
+	fake := newFake(t)
+	fake.SetFixture("PK", &alpacatest.Fixture{Secret: "s"})
+
+	day := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	query := alpaca.ActivitiesQuery{Date: day, After: day.AddDate(0, 0, -7), Until: day.AddDate(0, 0, 1)}
+	if _, err := fake.Client("PK").GetActivitiesPage(context.Background(), query); err != nil {
+		t.Fatalf("GetActivitiesPage: %v", err)
+	}
+
+	requests := fake.Requests()
+	params := requests[len(requests)-1].URL.Query()
+	if params.Get("date") != "2025-03-14" || params.Has("after") || params.Has("until") {
+		t.Errorf("Expected only the date filter, got %s", params.Encode())
+	}
+}
+
+func TestActivityIteratorStopsOnCancel(t *testing.T) {
+	fake := newFake(t)
+
+	var activities []alpaca.Activity
+	for i := 0; i < 10; i++ {
+		activities = append(activities, alpacatest.NewFill(fmt.Sprintf("fill-%d", i), "AAPL", "buy", 1, 100, time.Now()))
+	}
+	fake.SetFixture("PK", &alpacatest.Fixture{Secret: "s", Activities: activities})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	iter := fake.Client("PK").Activities(ctx, alpaca.ActivitiesQuery{PageSize: 2})
+
+	count := 0
+	for iter.Next() {
+		count++
+		if count == 3 {
+			cancel()
+		}
+	}
+	if count != 3 {
+		t.Errorf("Expected iteration to stop after cancel at 3, got %d", count)
+	}
+	if iter.Err() != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", iter.Err())
+	}
+}
+
+func TestRetriesRateLimitedRequests(t *testing.T) {
+	fake := newFake(t)
+	fake.SetFixture("PK", &alpacatest.Fixture{
+		Secret:       "s",
+		Account:      alpacatest.NewAccount("acct", 100000, 100000),
+		Status:       http.StatusTooManyRequests,
+		FailRequests: 2,
+		RetryAfter:   "0",
+	})
+
+	account, err := fake.Client("PK").GetAccount(context.Background())
+	if err != nil {
+		t.Fatalf("Expected retries to succeed, got %v", err)
+	}
+	if account.ID != "acct" {
+		t.Errorf("Unexpected account %q", account.ID)
+	}
+	if got := fake.RequestCount("/v2/account"); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+}
+
+func TestLongRetryAfterFailsFast(t *testing.T) {
+	fake := newFake(t)
+	fake.SetFixture("PK", &alpacatest.Fixture{
+		Secret:     "s",
+		Account:    alpacatest.NewAccount("acct", 100000, 100000),
+		Status:     http.StatusTooManyRequests,
+		RetryAfter: "600",
+	})
+
+	start := time.Now()
+	_, err := fake.Client("PK").GetAccount(context.Background())
+	if !errors.Is(err, alpaca.ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request to fail without waiting, took %v", elapsed)
+	}
+	if got := fake.RequestCount("/v2/account"); got != 1 {
+		t.Errorf("Expected a single attempt, got %d", got)
+	}
+}
+
+func TestTypedAPIErrors(t *testing.T) {
+	fake := newFake(t)
+	fake.SetFixture("PK", &alpacatest.Fixture{Secret: "s", Account: alpacatest.NewAccount("acct", 100000, 100000)})
+
+	tests := []struct {
+		name   string
+		status int
+		want   error
+	}{
+		{"forbidden", http.StatusForbidden, alpaca.ErrForbidden},
+		{"not found", http.StatusNotFound, alpaca.ErrNotFound},
+		{"rate limited", http.StatusTooManyRequests, alpaca.ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.Update("PK", func(f *alpacatest.Fixture) {
+				f.Status = tt.status
+				f.RetryAfter = "0"
+			})
+
+			_, err := fake.Client("PK").GetAccount(context.Background())
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+
+			var apiErr *alpaca.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Errorf("Expected *APIError with status %d, got %#v", tt.status, err)
+			}
+		})
+	}
+
+	unauthorized := 0
+	client := alpaca.NewClient("PK", "wrong", alpaca.WithBaseURL(fake.URL()), alpaca.WithOnUnauthorized(func() { unauthorized++ }))
+	if _, err := client.GetAccount(context.Background()); !errors.Is(err, alpaca.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if unauthorized != 1 {
+		t.Errorf("Expected unauthorized callback once, got %d", unauthorized)
+	}
+}
+
+func TestListAndGetAssets(t *testing.T) {
+	fake := newFake(t)
+	fake.SetFixture("PK1", &alpacatest.Fixture{Secret: "secret"})
+
+	delisted := alpacatest.NewAsset("OLD", "Delisted Corp")
+	delisted.Status = alpaca.AssetStatusInactive
+	fake.SetAssets([]alpaca.Asset{alpacatest.NewAsset("AAPL", "Apple Inc."), delisted})
+	client := fake.Client("PK1")
+
+	assets, err := client.ListAssets(context.Background(), alpaca.AssetsQuery{Status: alpaca.AssetStatusActive})
+	if err != nil {
+		t.Fatalf("ListAssets: %v", err)
+	}
+	if len(assets) != 1 || assets[0].Symbol != "AAPL" || !assets[0].Fractionable {
+		t.Errorf("Expected only the active asset, got %+v", assets)
+	}
+
+	asset, err := client.GetAsset(context.Background(), "OLD")
+	if err != nil {
+		t.Fatalf("GetAsset: %v", err)
+	}
+	if asset.Name != "Delisted Corp" || asset.Status != alpaca.AssetStatusInactive {
+		t.Errorf("Unexpected asset %+v", asset)
+	}
+
+	var apiErr *alpaca.APIError
+	if _, err := client.GetAsset(context.Background(), "NOPE"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 for an unknown asset, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package alpaca
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxDecimalPlaces caps how many digits String prints for values that don't
+// terminate (only possible after Div); everything parsed from Alpaca is exact
+const maxDecimalPlaces = 18
+
+// Decimal is an exact decimal number for money, prices and quantities.
+// Alpaca sends these as JSON strings; parsing them into a Decimal instead of a
+// float64 keeps sums exact and turns malformed values into decode errors
+// rather than silent zeroes. The zero value is 0 and Decimals are immutable.
+type Decimal struct {
+	r *big.Rat
+}
+
+// ParseDecimal parses a decimal string such as "123.45", "-0.5" or "1e-3"
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q: empty", s)
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789+-.eE", c) {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	return Decimal{r: r}, nil
+}
+
+// MustParseDecimal is ParseDecimal for constants; it panics on invalid input
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewDecimalFromFloat converts a float using its shortest decimal representation,
+// so 0.1 becomes exactly 0.1 rather than the nearest binary fraction
+func NewDecimalFromFloat(f float64) Decimal {
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		// NaN and ±Inf have no decimal representation
+		return Decimal{}
+	}
+	return d
+}
+
+// NewDecimalFromInt converts an integer
+func NewDecimalFromInt(i int64) Decimal {
+	return Decimal{r: new(big.Rat).SetInt64(i)}
+}
+
+func (d Decimal) rat() *big.Rat {
+	if d.r == nil {
+		return new(big.Rat)
+	}
+	return d.r
+}
+
+// Add returns d + o
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal{r: new(big.Rat).Add(d.rat(), o.rat())}
+}
+
+// Sub returns d - o
+func (d Decimal) Sub(o Decimal) Decimal {
+	return Decimal{r: new(big.Rat).Sub(d.rat(), o.rat())}
+}
+
+// Mul returns d * o
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{r: new(big.Rat).Mul(d.rat(), o.rat())}
+}
+
+// Div returns d / o. Like big.Rat, it panics if o is zero.
+func (d Decimal) Div(o Decimal) Decimal {
+	return Decimal{r: new(big.Rat).Quo(d.rat(), o.rat())}
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{r: new(big.Rat).Neg(d.rat())}
+}
+
+// Abs returns |d|
+func (d Decimal) Abs() Decimal {
+	return Decimal{r: new(big.Rat).Abs(d.rat())}
+}
+
+// Cmp compares d and o, returning -1, 0 or +1
+func (d Decimal) Cmp(o Decimal) int {
+	return d.rat().Cmp(o.rat())
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of d
+func (d Decimal) Sign() int {
+	return d.rat().Sign()
+}
+
+// IsZero reports whether d is 0
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Float64 returns the nearest float64, for display and charting
+func (d Decimal) Float64() float64 {
+	f, _ := d.rat().Float64()
+	return f
+}
+
+// String returns d with as many decimal places as it needs
+func (d Decimal) String() string {
+	r := d.rat()
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// Find the fewest places that represent d exactly
+	scaled := new(big.Rat).Set(r)
+	ten := big.NewRat(10, 1)
+	for places := 1; places <= maxDecimalPlaces; places++ {
+		scaled.Mul(scaled, ten)
+		if scaled.IsInt() {
+			return r.FloatString(places)
+		}
+	}
+	return r.FloatString(maxDecimalPlaces)
+}
+
+// StringFixed returns d rounded to the given number of decimal places
+func (d Decimal) StringFixed(places int) string {
+	return d.rat().FloatString(places)
+}
+
+// MarshalJSON encodes d as a JSON string, matching Alpaca's format
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts a JSON string or number. null and "" decode to zero,
+// since Alpaca uses them for fields that don't apply (e.g. price on a dividend).
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*d = Decimal{}
+			return nil
+		}
+	}
+
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
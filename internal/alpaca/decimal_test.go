@@ -0,0 +1,75 @@
+package alpaca
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecimalArithmeticIsExact(t *testing.T) {
+	sum := Decimal{}
+	for i := 0; i < 10; i++ {
+		sum = sum.Add(MustParseDecimal("0.1"))
+	}
+	if sum.Cmp(NewDecimalFromInt(1)) != 0 {
+		t.Errorf("Expected ten 0.1s to sum to exactly 1, got %s", sum)
+	}
+
+	pl := MustParseDecimal("100234.57").Sub(MustParseDecimal("100000.12"))
+	if pl.String() != "234.45" {
+		t.Errorf("Expected 234.45, got %s", pl)
+	}
+
+	if got := NewDecimalFromFloat(0.3).String(); got != "0.3" {
+		t.Errorf("Expected 0.3, got %s", got)
+	}
+	if got := MustParseDecimal("2").Div(MustParseDecimal("3")).StringFixed(4); got != "0.6667" {
+		t.Errorf("Expected 0.6667, got %s", got)
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	cases := map[string]string{
+		"0":          "0",
+		"-12":        "-12",
+		"1.50":       "1.5",
+		"0.000001":   "0.000001",
+		"1e3":        "1000",
+		"-0.0425000": "-0.0425",
+	}
+	for in, want := range cases {
+		if got := MustParseDecimal(in).String(); got != want {
+			t.Errorf("ParseDecimal(%q).String() = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDecimalUnmarshalJSON(t *testing.T) {
+	var account Account
+	err := json.Unmarshal([]byte(`{"equity":"105000.25","last_equity":104000,"cash":null,"buying_power":""}`), &account)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if account.Equity.String() != "105000.25" || account.LastEquity.String() != "104000" {
+		t.Errorf("Unexpected amounts: equity=%s last_equity=%s", account.Equity, account.LastEquity)
+	}
+	if !account.Cash.IsZero() || !account.BuyingPower.IsZero() {
+		t.Errorf("Expected null and empty values to decode as zero")
+	}
+
+	for _, bad := range []string{`{"equity":"12,000.00"}`, `{"equity":"abc"}`, `{"equity":"1/3"}`, `{"equity":true}`} {
+		if err := json.Unmarshal([]byte(bad), &account); err == nil {
+			t.Errorf("Expected %s to fail to decode", bad)
+		}
+	}
+}
+
+func TestDecimalMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(Position{Qty: MustParseDecimal("2.50")})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"qty":"2.5"`) {
+		t.Errorf("Expected qty to encode as a string, got %s", data)
+	}
+}
@@ -0,0 +1,89 @@
+package alpaca
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Sentinel errors for the API failures callers act on. Match them with
+// errors.Is; the underlying error is an *APIError with the full details.
+var (
+	ErrUnauthorized = errors.New("alpaca: unauthorized")
+	ErrForbidden    = errors.New("alpaca: forbidden")
+	ErrNotFound     = errors.New("alpaca: not found")
+	ErrRateLimited  = errors.New("alpaca: rate limited")
+)
+
+// APIError is a non-2xx response from Alpaca
+type APIError struct {
+	StatusCode int
+	Code       int    // Alpaca's error code from the response body, if any
+	Message    string // Alpaca's message, or the raw body when it isn't JSON
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// Is lets errors.Is match an APIError against the sentinel for its status
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// retryable reports whether the request may succeed if sent again
+func (e *APIError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// newAPIError builds an APIError from a failed response's status, headers and body
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var payload struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Message != "" {
+		apiErr.Code = payload.Code
+		apiErr.Message = payload.Message
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+
+	return apiErr
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+// It returns -1 when the header is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return -1
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return -1
+}
@@ -0,0 +1,22 @@
+package alpaca
+
+import (
+	"time"
+	_ "time/tzdata" // market time zone for hosts without zoneinfo
+)
+
+// MarketLocation is the exchange time zone that trading days are counted in
+var MarketLocation = loadMarketLocation()
+
+func loadMarketLocation() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// MarketDate formats the trading day t falls on, e.g. "2024-03-15"
+func MarketDate(t time.Time) string {
+	return t.In(MarketLocation).Format("2006-01-02")
+}
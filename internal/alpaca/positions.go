@@ -5,24 +5,24 @@ import (
 )
 
 type Position struct {
-	AssetID            string  `json:"asset_id"`
-	Symbol             string  `json:"symbol"`
-	Exchange           string  `json:"exchange"`
-	AssetClass         string  `json:"asset_class"`
-	AssetMarginable    bool    `json:"asset_marginable"`
-	Qty                string  `json:"qty"`
-	AvgEntryPrice      string  `json:"avg_entry_price"`
-	Side               string  `json:"side"`
-	MarketValue        string  `json:"market_value"`
-	CostBasis          string  `json:"cost_basis"`
-	UnrealizedPL       string  `json:"unrealized_pl"`
-	UnrealizedPLPC     string  `json:"unrealized_plpc"`
-	UnrealizedIntradayPL string `json:"unrealized_intraday_pl"`
-	UnrealizedIntradayPLPC string `json:"unrealized_intraday_plpc"`
-	CurrentPrice       string  `json:"current_price"`
-	LastdayPrice       string  `json:"lastday_price"`
-	ChangeToday        string  `json:"change_today"`
-	QtyAvailable       string  `json:"qty_available"`
+	AssetID                string  `json:"asset_id"`
+	Symbol                 string  `json:"symbol"`
+	Exchange               string  `json:"exchange"`
+	AssetClass             string  `json:"asset_class"`
+	AssetMarginable        bool    `json:"asset_marginable"`
+	Qty                    Decimal `json:"qty"`
+	AvgEntryPrice          Decimal `json:"avg_entry_price"`
+	Side                   string  `json:"side"`
+	MarketValue            Decimal `json:"market_value"`
+	CostBasis              Decimal `json:"cost_basis"`
+	UnrealizedPL           Decimal `json:"unrealized_pl"`
+	UnrealizedPLPC         Decimal `json:"unrealized_plpc"`
+	UnrealizedIntradayPL   Decimal `json:"unrealized_intraday_pl"`
+	UnrealizedIntradayPLPC Decimal `json:"unrealized_intraday_plpc"`
+	CurrentPrice           Decimal `json:"current_price"`
+	LastdayPrice           Decimal `json:"lastday_price"`
+	ChangeToday            Decimal `json:"change_today"`
+	QtyAvailable           Decimal `json:"qty_available"`
 }
 
 // GetPositions retrieves all open positions
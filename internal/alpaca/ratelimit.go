@@ -0,0 +1,85 @@
+package alpaca
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RequestsPerMinute is Alpaca's per-key API allowance
+const RequestsPerMinute = 200
+
+// tokenBucket paces requests to a steady rate while allowing short bursts.
+// The refill rate leaves room for the burst, so no 60-second window ever sees
+// more than the per-minute allowance.
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	rate     float64 // tokens added per second
+	last     time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	burst := max(1, perMinute/10)
+	return &tokenBucket{
+		tokens:   float64(burst),
+		capacity: float64(burst),
+		rate:     float64(perMinute-burst) / 60,
+		last:     time.Now(),
+	}
+}
+
+// wait blocks until a token is available or the context is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		delay := b.take(time.Now())
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// take spends a token if one is available at now, otherwise it reports how
+// long until the next one
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return max(time.Nanosecond, time.Duration((1-b.tokens)/b.rate*float64(time.Second)))
+}
+
+// limiters holds one bucket per API key. Alpaca counts requests per key, so
+// every Client built for the same key (handlers, sync worker, cache refreshes)
+// shares the same allowance.
+var limiters = struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}{buckets: make(map[string]*tokenBucket)}
+
+func limiterFor(apiKey string) *tokenBucket {
+	limiters.mu.Lock()
+	defer limiters.mu.Unlock()
+
+	bucket, ok := limiters.buckets[apiKey]
+	if !ok {
+		bucket = newTokenBucket(RequestsPerMinute)
+		limiters.buckets[apiKey] = bucket
+	}
+	return bucket
+}
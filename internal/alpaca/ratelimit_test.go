@@ -0,0 +1,86 @@
+package alpaca
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketPacesRequests(t *testing.T) {
+	// 600/min less its burst of 60 is one token every 111ms
+	bucket := newTokenBucket(600)
+	bucket.tokens = 1
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected the bucket to pace requests, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bucket.wait(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from an empty bucket, got %v", err)
+	}
+}
+
+func TestTokenBucketStaysUnderAllowance(t *testing.T) {
+	bucket := newTokenBucket(RequestsPerMinute)
+
+	// Request as fast as the bucket allows for three minutes
+	var sent []time.Time
+	now := bucket.last
+	end := now.Add(3 * time.Minute)
+	for now.Before(end) {
+		if delay := bucket.take(now); delay > 0 {
+			now = now.Add(delay)
+			continue
+		}
+		sent = append(sent, now)
+	}
+
+	for i, start := range sent {
+		count := 0
+		for _, at := range sent[i:] {
+			if at.Sub(start) < time.Minute {
+				count++
+			}
+		}
+		if count > RequestsPerMinute {
+			t.Fatalf("Expected at most %d requests in a minute, got %d starting at request %d", RequestsPerMinute, count, i)
+		}
+	}
+	if len(sent) < 3*RequestsPerMinute*9/10 {
+		t.Errorf("Expected the bucket to use most of the allowance, sent %d", len(sent))
+	}
+}
+
+func TestLimiterIsSharedPerKey(t *testing.T) {
+	if limiterFor("PKSHARED") != limiterFor("PKSHARED") {
+		t.Error("Expected clients with the same key to share a limiter")
+	}
+	if limiterFor("PKSHARED") == limiterFor("PKOTHER") {
+		t.Error("Expected different keys to have separate limiters")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("3"); got != 3*time.Second {
+		t.Errorf("Expected 3s, got %v", got)
+	}
+	if got := parseRetryAfter(""); got != -1 {
+		t.Errorf("Expected -1 for a missing header, got %v", got)
+	}
+	if got := parseRetryAfter("soon"); got != -1 {
+		t.Errorf("Expected -1 for an invalid header, got %v", got)
+	}
+	at := time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(at); got <= 0 || got > 5*time.Second {
+		t.Errorf("Expected up to 5s for an HTTP date, got %v", got)
+	}
+}
@@ -7,11 +7,16 @@ import (
 	"time"
 )
 
+// fetchTimeout bounds each upstream fetch, so a slow source can't hold a
+// key's in-flight fetch and every caller waiting on it indefinitely
+const fetchTimeout = 10 * time.Second
+
 // CacheEntry holds cached data with metadata
 type CacheEntry struct {
 	Data          any
 	ExpiresAt     time.Time
 	LastRefreshAt time.Time
+	TTL           time.Duration
 	RefreshFunc   RefreshFunc
 }
 
@@ -26,6 +31,8 @@ type Cache struct {
 	refreshBuffer time.Duration
 	stats         CacheStats
 	stopChan      chan bool
+	flights       flightGroup
+	listeners     []func(key string)
 }
 
 type CacheStats struct {
@@ -99,6 +106,7 @@ func (c *Cache) SetWithTTL(key string, value any, ttl time.Duration, refreshFunc
 		Data:          value,
 		ExpiresAt:     time.Now().Add(ttl),
 		LastRefreshAt: time.Now(),
+		TTL:           ttl,
 		RefreshFunc:   refreshFunc,
 	}
 }
@@ -114,15 +122,16 @@ func (c *Cache) GetOrSet(key string, ttl time.Duration, fetchFunc func() (any, e
 		return data, nil
 	}
 
-	// Cache miss - fetch data
-	data, err := fetchFunc()
-	if err != nil {
-		return nil, err
-	}
-
-	c.SetWithTTL(key, data, ttl, nil)
-
-	return data, nil
+	// Cache miss - fetch data, sharing the fetch with concurrent callers
+	data, err, _ := c.flights.do(key, func() (any, error) {
+		data, err := fetchFunc()
+		if err != nil {
+			return nil, err
+		}
+		c.SetWithTTL(key, data, ttl, nil)
+		return data, nil
+	})
+	return data, err
 }
 
 // GetOrSetWithRefresh is like GetOrSet but registers a refresh function
@@ -136,20 +145,43 @@ func (c *Cache) GetOrSetWithRefresh(key string, ttl time.Duration, refreshFunc R
 		return data, nil
 	}
 
-	// Cache miss - fetch data
-	ctx := context.Background()
-	data, err := refreshFunc(ctx)
-	if err != nil {
-		return nil, err
-	}
+	// Cache miss - fetch data, sharing the fetch with concurrent callers. The
+	// fetch isn't tied to any one caller's context, so a caller that gives up
+	// early still leaves the result cached for the next request.
+	data, err, _ := c.flights.do(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+		defer cancel()
 
-	c.SetWithRefresh(key, data, ttl, refreshFunc)
+		data, err := refreshFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.SetWithRefresh(key, data, ttl, refreshFunc)
+		return data, nil
+	})
+	return data, err
+}
 
-	return data, nil
+// OnRefresh registers a function called with an entry's key after a refresh
+// replaces its data, letting callers react to what the refresh brought in
+func (c *Cache) OnRefresh(fn func(key string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
 }
 
-// refreshKey refreshes a specific cache key using its refresh function
+// refreshKey refreshes a specific cache key using its refresh function.
+// Concurrent refreshes of the same key (e.g. several stale reads at once)
+// collapse into one.
 func (c *Cache) refreshKey(key string) {
+	c.flights.do("refresh:"+key, func() (any, error) {
+		c.refreshEntry(key)
+		return nil, nil
+	})
+}
+
+// refreshEntry fetches new data for a key and updates its entry in place
+func (c *Cache) refreshEntry(key string) {
 	c.mu.RLock()
 	entry, exists := c.store[key]
 	if !exists || entry.RefreshFunc == nil {
@@ -160,7 +192,7 @@ func (c *Cache) refreshKey(key string) {
 	c.mu.RUnlock()
 
 	// Fetch new data
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
 	defer cancel()
 
 	newData, err := refreshFunc(ctx)
@@ -171,16 +203,24 @@ func (c *Cache) refreshKey(key string) {
 
 	// Update cache
 	c.mu.Lock()
-	if entry, exists := c.store[key]; exists {
+	entry, exists = c.store[key]
+	if exists {
 		entry.Data = newData
-		entry.ExpiresAt = time.Now().Add(c.defaultTTL)
+		entry.ExpiresAt = time.Now().Add(entry.TTL)
 		entry.LastRefreshAt = time.Now()
 	}
+	listeners := c.listeners
 	c.mu.Unlock()
 
 	c.stats.mu.Lock()
 	c.stats.Refreshes++
 	c.stats.mu.Unlock()
+
+	if exists {
+		for _, fn := range listeners {
+			fn(key)
+		}
+	}
 }
 
 // Delete removes a value from cache
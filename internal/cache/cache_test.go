@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -220,3 +222,102 @@ func TestCacheStats(t *testing.T) {
 		t.Errorf("Expected 3 misses, got %d", stats.Misses)
 	}
 }
+
+func TestCacheRefreshKeepsEntryTTL(t *testing.T) {
+	c := NewCache(100*time.Millisecond, 50*time.Millisecond)
+	defer c.Stop()
+
+	refreshFunc := func(ctx context.Context) (any, error) {
+		return "refreshed_value", nil
+	}
+
+	c.SetWithRefresh("ttl_key", "initial_value", 5*time.Second, refreshFunc)
+	c.refreshKey("ttl_key")
+
+	// Refreshed entry should keep its own TTL rather than the cache default
+	time.Sleep(150 * time.Millisecond)
+
+	data, found, _ := c.Get("ttl_key")
+	if !found {
+		t.Fatal("Expected refreshed entry to outlive the default TTL")
+	}
+	if data != "refreshed_value" {
+		t.Errorf("Expected 'refreshed_value', got %v", data)
+	}
+}
+
+func TestCacheSharesConcurrentMisses(t *testing.T) {
+	c := NewCache(1*time.Second, 500*time.Millisecond)
+	defer c.Stop()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	refreshFunc := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		<-release
+		return "shared_value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := c.GetOrSetWithRefresh("shared_key", time.Second, refreshFunc)
+			if err != nil || data != "shared_value" {
+				t.Errorf("Expected shared_value, got %v (%v)", data, err)
+			}
+		}()
+	}
+
+	// Give every goroutine a chance to join the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected one upstream fetch, got %d", got)
+	}
+}
+
+func TestCacheMissFetchHasDeadline(t *testing.T) {
+	c := NewCache(1*time.Second, 500*time.Millisecond)
+	defer c.Stop()
+
+	refreshFunc := func(ctx context.Context) (any, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > fetchTimeout {
+			t.Errorf("Expected the fetch to run under a %v deadline, got %v (%v)", fetchTimeout, deadline, ok)
+		}
+		return "value", nil
+	}
+
+	if _, err := c.GetOrSetWithRefresh("key", time.Second, refreshFunc); err != nil {
+		t.Fatalf("GetOrSetWithRefresh: %v", err)
+	}
+}
+
+func TestCacheNotifiesRefreshListeners(t *testing.T) {
+	c := NewCache(1*time.Second, 500*time.Millisecond)
+	defer c.Stop()
+
+	var refreshed []string
+	c.OnRefresh(func(key string) {
+		refreshed = append(refreshed, key)
+	})
+
+	failing := func(ctx context.Context) (any, error) {
+		return nil, context.DeadlineExceeded
+	}
+	c.SetWithRefresh("failing_key", "value", time.Second, failing)
+	c.refreshKey("failing_key")
+
+	c.SetWithRefresh("listened_key", "value", time.Second, func(ctx context.Context) (any, error) {
+		return "new_value", nil
+	})
+	c.refreshKey("listened_key")
+
+	if len(refreshed) != 1 || refreshed[0] != "listened_key" {
+		t.Errorf("Expected only the successful refresh to be reported, got %v", refreshed)
+	}
+}
@@ -0,0 +1,48 @@
+package cache
+
+import "sync"
+
+// call is an in-flight or completed flightGroup call
+type call struct {
+	wg   sync.WaitGroup
+	data any
+	err  error
+}
+
+// flightGroup deduplicates concurrent loads of the same key: while one caller
+// runs the load, the others wait and receive its result. This keeps a cold
+// cache from sending one upstream request per concurrent page view.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do runs fn for key unless a call for key is already running, in which case it
+// waits for that call and returns its result. shared reports whether the result
+// came from another caller's run.
+func (g *flightGroup) do(key string, fn func() (any, error)) (data any, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.data, c.err, true
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+
+	c.data, c.err = fn()
+	return c.data, c.err, false
+}
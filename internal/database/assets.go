@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Asset is an entry in the local copy of Alpaca's asset catalog
+type Asset struct {
+	Symbol       string
+	AlpacaID     string
+	Name         string
+	Exchange     string
+	AssetClass   string
+	Status       string // "active" or "inactive"
+	Tradable     bool
+	Fractionable bool
+	UpdatedAt    time.Time
+}
+
+const assetColumns = `symbol, alpaca_id, name, exchange, asset_class, status, tradable, fractionable, updated_at`
+
+// SaveAssets replaces the catalog with a fresh listing of active assets.
+// Assets missing from the listing are kept, for the names of old trades, but
+// marked inactive.
+func (db *DB) SaveAssets(assets []Asset) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE assets SET status = 'inactive'`); err != nil {
+		return fmt.Errorf("failed to retire assets: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO assets (symbol, alpaca_id, name, exchange, asset_class, status, tradable, fractionable)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(symbol) DO UPDATE SET
+			alpaca_id = excluded.alpaca_id,
+			name = excluded.name,
+			exchange = excluded.exchange,
+			asset_class = excluded.asset_class,
+			status = excluded.status,
+			tradable = excluded.tradable,
+			fractionable = excluded.fractionable,
+			updated_at = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare asset insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, a := range assets {
+		if _, err := stmt.Exec(a.Symbol, a.AlpacaID, a.Name, a.Exchange, a.AssetClass, a.Status, a.Tradable, a.Fractionable); err != nil {
+			return fmt.Errorf("failed to save asset %s: %w", a.Symbol, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CountAssets returns how many assets the catalog holds
+func (db *DB) CountAssets() (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM assets`).Scan(&count)
+	return count, err
+}
+
+// GetAsset retrieves a symbol's catalog entry
+func (db *DB) GetAsset(symbol string) (*Asset, error) {
+	return scanAsset(db.QueryRow(`SELECT `+assetColumns+` FROM assets WHERE symbol = ?`, symbol))
+}
+
+// GetAssetNames returns the company name for each of the symbols the catalog
+// knows, keyed by symbol
+func (db *DB) GetAssetNames(symbols []string) (map[string]string, error) {
+	names := make(map[string]string)
+	if len(symbols) == 0 {
+		return names, nil
+	}
+
+	args := make([]interface{}, len(symbols))
+	for i, symbol := range symbols {
+		args[i] = symbol
+	}
+
+	query := `SELECT symbol, name FROM assets WHERE symbol IN (?` + generatePlaceholders(len(symbols)-1) + `)`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get asset names: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var symbol, name string
+		if err := rows.Scan(&symbol, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan asset name: %w", err)
+		}
+		names[symbol] = name
+	}
+	return names, rows.Err()
+}
+
+// SearchAssets finds active, tradable assets by symbol or company name. An
+// exact symbol comes first, then symbols starting with the term, then names
+// containing it.
+func (db *DB) SearchAssets(term string, limit int) ([]Asset, error) {
+	term = strings.TrimSpace(term)
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE status = 'active' AND tradable = 1
+		AND (symbol LIKE ? ESCAPE '\' OR name LIKE ? ESCAPE '\')
+		ORDER BY
+			CASE
+				WHEN symbol = ? COLLATE NOCASE THEN 0
+				WHEN symbol LIKE ? ESCAPE '\' THEN 1
+				ELSE 2
+			END,
+			symbol
+		LIMIT ?
+	`
+	prefix := escaped + "%"
+	rows, err := db.Query(query, prefix, "%"+escaped+"%", term, prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search assets: %w", err)
+	}
+	defer rows.Close()
+
+	var assets []Asset
+	for rows.Next() {
+		asset, err := scanAsset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan asset: %w", err)
+		}
+		assets = append(assets, *asset)
+	}
+	return assets, rows.Err()
+}
+
+func scanAsset(row rowScanner) (*Asset, error) {
+	var a Asset
+	var updatedAt sql.NullTime
+	err := row.Scan(&a.Symbol, &a.AlpacaID, &a.Name, &a.Exchange, &a.AssetClass, &a.Status, &a.Tradable, &a.Fractionable, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	a.UpdatedAt = updatedAt.Time
+	return &a, nil
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Comment tag kinds
+const (
+	CommentTagMention = "mention" // @nickname
+	CommentTagCashtag = "cashtag" // $TICKER
+)
+
+// CommentTag is an @mention or $cashtag found in a comment
+type CommentTag struct {
+	Kind  string
+	Value string // nickname as written, or the ticker symbol
+	Start int    // byte offsets of the tag, including its @ or $
+	End   int
+}
+
+var (
+	// commentTagPattern finds candidate tags; the boundary before them and
+	// the shape of cashtags are checked separately
+	commentTagPattern = regexp.MustCompile(`[@$][A-Za-z0-9_.\-]+`)
+	cashtagPattern    = regexp.MustCompile(`^[A-Z][A-Z0-9]{0,5}(\.[A-Z]{1,2})?$`)
+)
+
+// ParseCommentTags finds the @mentions and $cashtags in a comment, in order.
+// A tag must start the comment or follow a character that can't be part of a
+// word, so email addresses and amounts like $100 aren't picked up.
+func ParseCommentTags(content string) []CommentTag {
+	var tags []CommentTag
+	for _, loc := range commentTagPattern.FindAllStringIndex(content, -1) {
+		if loc[0] > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(content[:loc[0]])
+			if prev == '@' || prev == '$' || prev == '_' || unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+				continue
+			}
+		}
+
+		// Trailing punctuation ends the sentence rather than the tag
+		value := strings.TrimRight(content[loc[0]+1:loc[1]], ".-")
+		if value == "" {
+			continue
+		}
+		tag := CommentTag{Value: value, Start: loc[0], End: loc[0] + 1 + len(value)}
+
+		if content[loc[0]] == '@' {
+			tag.Kind = CommentTagMention
+		} else {
+			if !cashtagPattern.MatchString(value) {
+				continue
+			}
+			tag.Kind = CommentTagCashtag
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// ResolveNicknames maps nicknames, case-insensitively, to the users who hold
+// them. Nicknames shared by more than one user are left out rather than guessed.
+func (db *DB) ResolveNicknames(nicknames []string) (map[string]int, error) {
+	if len(nicknames) == 0 {
+		return map[string]int{}, nil
+	}
+
+	args := make([]interface{}, len(nicknames))
+	for i, nickname := range nicknames {
+		args[i] = strings.ToLower(nickname)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, LOWER(nickname)
+		FROM users
+		WHERE LOWER(nickname) IN (?`+generatePlaceholders(len(nicknames)-1)+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resolved := make(map[string]int)
+	holders := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var nickname string
+		if err := rows.Scan(&id, &nickname); err != nil {
+			return nil, err
+		}
+		resolved[nickname] = id
+		holders[nickname]++
+	}
+	for nickname, count := range holders {
+		if count > 1 {
+			delete(resolved, nickname)
+		}
+	}
+	return resolved, rows.Err()
+}
+
+// SetCommentTags replaces a comment's mentions and cashtags. mentions maps
+// each nickname as written to the mentioned user. It returns the users who
+// weren't mentioned before, so an edit only notifies the newly mentioned.
+func (db *DB) SetCommentTags(commentID int, mentions map[string]int, symbols []string) ([]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	previous := make(map[int]bool)
+	rows, err := tx.Query(`SELECT user_id FROM comment_mentions WHERE comment_id = ?`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		previous[userID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM comment_mentions WHERE comment_id = ?`, commentID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM comment_cashtags WHERE comment_id = ?`, commentID); err != nil {
+		return nil, err
+	}
+
+	var added []int
+	for nickname, userID := range mentions {
+		result, err := tx.Exec(`
+			INSERT OR IGNORE INTO comment_mentions (comment_id, user_id, nickname)
+			VALUES (?, ?, ?)
+		`, commentID, userID, nickname)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 && !previous[userID] {
+			added = append(added, userID)
+		}
+	}
+	for _, symbol := range symbols {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO comment_cashtags (comment_id, symbol) VALUES (?, ?)`, commentID, symbol); err != nil {
+			return nil, err
+		}
+	}
+
+	return added, tx.Commit()
+}
+
+// loadCommentMentions fills in each comment's resolved mentions
+func (db *DB) loadCommentMentions(comments []CommentWithUser) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(comments))
+	byID := make(map[int]*CommentWithUser, len(comments))
+	for i := range comments {
+		args[i] = comments[i].ID
+		byID[comments[i].ID] = &comments[i]
+	}
+
+	rows, err := db.Query(`
+		SELECT comment_id, user_id, nickname
+		FROM comment_mentions
+		WHERE comment_id IN (?`+generatePlaceholders(len(comments)-1)+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID, userID int
+		var nickname string
+		if err := rows.Scan(&commentID, &userID, &nickname); err != nil {
+			return err
+		}
+		comment := byID[commentID]
+		if comment.Mentions == nil {
+			comment.Mentions = make(map[string]int)
+		}
+		comment.Mentions[strings.ToLower(nickname)] = userID
+	}
+	return rows.Err()
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"slices"
 	"time"
 )
 
@@ -13,6 +14,7 @@ type Comment struct {
 	Content    string
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+	Status     string // CommentVisible, CommentHidden, CommentRemoved or CommentDeleted
 }
 
 type CommentWithUser struct {
@@ -20,13 +22,38 @@ type CommentWithUser struct {
 	UserDisplayName string
 	UserNickname    string
 	UserAvatarURL   string
+	Mentions        map[string]int // lowercased nickname as written -> mentioned user ID
+	Revisions       int            // earlier versions kept from edits
 }
 
+// CommentThread is a top-level comment with its most recent replies
+type CommentThread struct {
+	CommentWithUser
+	Replies        []CommentWithUser // oldest first
+	EarlierReplies int               // replies older than those loaded
+}
+
+// CommentRevision is an earlier version of an edited comment
+type CommentRevision struct {
+	ID         int
+	CommentID  int
+	Content    string
+	WrittenAt  time.Time // when this version was posted or last edited
+	ReplacedAt time.Time
+}
+
+// commentWithUserColumns is the column list every query for comments with
+// their authors selects from comments c joined to users u, in
+// scanCommentsWithUser order
+const commentWithUserColumns = `c.id, c.activity_id, c.user_id, c.parent_id, c.content, c.created_at, c.updated_at, c.status,
+	u.display_name, u.nickname, u.avatar_url,
+	(SELECT COUNT(*) FROM comment_revisions r WHERE r.comment_id = c.id)`
+
 func (db *DB) CreateComment(activityID string, userID int, parentID *int, content string) (*Comment, error) {
 	query := `
 		INSERT INTO comments (activity_id, user_id, parent_id, content)
 		VALUES (?, ?, ?, ?)
-		RETURNING id, activity_id, user_id, parent_id, content, created_at, updated_at
+		RETURNING id, activity_id, user_id, parent_id, content, created_at, updated_at, status
 	`
 
 	var comment Comment
@@ -43,6 +70,7 @@ func (db *DB) CreateComment(activityID string, userID int, parentID *int, conten
 		&comment.Content,
 		&comment.CreatedAt,
 		&comment.UpdatedAt,
+		&comment.Status,
 	)
 	if err != nil {
 		return nil, err
@@ -53,9 +81,7 @@ func (db *DB) CreateComment(activityID string, userID int, parentID *int, conten
 
 func (db *DB) GetCommentsByActivity(activityID string) ([]CommentWithUser, error) {
 	query := `
-		SELECT
-			c.id, c.activity_id, c.user_id, c.parent_id, c.content, c.created_at, c.updated_at,
-			u.display_name, u.nickname, u.avatar_url
+		SELECT ` + commentWithUserColumns + `
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
 		WHERE c.activity_id = ?
@@ -68,6 +94,220 @@ func (db *DB) GetCommentsByActivity(activityID string) ([]CommentWithUser, error
 	}
 	defer rows.Close()
 
+	comments, err := scanCommentsWithUser(rows)
+	if err != nil {
+		return nil, err
+	}
+	return comments, db.loadCommentMentions(comments)
+}
+
+// GetCommentsForActivities retrieves the comments on any of the given
+// activities, newest first
+func (db *DB) GetCommentsForActivities(activityIDs []string) ([]CommentWithUser, error) {
+	if len(activityIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT ` + commentWithUserColumns + `
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.activity_id IN (?` + generatePlaceholders(len(activityIDs)-1) + `)
+		ORDER BY c.created_at DESC
+	`
+
+	args := make([]interface{}, len(activityIDs))
+	for i, id := range activityIDs {
+		args[i] = id
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments, err := scanCommentsWithUser(rows)
+	if err != nil {
+		return nil, err
+	}
+	return comments, db.loadCommentMentions(comments)
+}
+
+// GetCommentThreads retrieves a page of an activity's top-level comments,
+// oldest first, each with its latest replies. Pages run back from the newest
+// comment: beforeID 0 asks for the newest page, otherwise the page before
+// that comment. A sinceID stretches the page back to include that comment.
+// more reports whether there are older comments.
+func (db *DB) GetCommentThreads(activityID string, beforeID, sinceID, limit, repliesShown int) ([]CommentThread, bool, error) {
+	if sinceID > 0 {
+		var count int
+		query := `SELECT COUNT(*) FROM comments WHERE activity_id = ? AND parent_id IS NULL AND id >= ? AND (? = 0 OR id < ?)`
+		if err := db.QueryRow(query, activityID, sinceID, beforeID, beforeID).Scan(&count); err != nil {
+			return nil, false, err
+		}
+		limit = max(limit, count)
+	}
+
+	query := `
+		SELECT ` + commentWithUserColumns + `
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.activity_id = ? AND c.parent_id IS NULL AND (? = 0 OR c.id < ?)
+		ORDER BY c.id DESC
+		LIMIT ?
+	`
+	rows, err := db.Query(query, activityID, beforeID, beforeID, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	comments, err := scanCommentsWithUser(rows)
+	if err != nil {
+		return nil, false, err
+	}
+	more := len(comments) > limit
+	if more {
+		comments = comments[:limit]
+	}
+	slices.Reverse(comments)
+	if len(comments) == 0 {
+		return nil, false, nil
+	}
+	if err := db.loadCommentMentions(comments); err != nil {
+		return nil, false, err
+	}
+
+	threads := make([]CommentThread, len(comments))
+	byID := make(map[int]*CommentThread, len(comments))
+	args := make([]interface{}, len(comments))
+	for i, comment := range comments {
+		threads[i] = CommentThread{CommentWithUser: comment}
+		byID[comment.ID] = &threads[i]
+		args[i] = comment.ID
+	}
+	placeholders := `?` + generatePlaceholders(len(comments)-1)
+
+	// Each thread's newest replies, numbered back from the latest
+	query = `
+		SELECT ` + commentWithUserColumns + `
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY id DESC) AS n
+				FROM comments
+				WHERE parent_id IN (` + placeholders + `)
+			)
+			WHERE n <= ?
+		)
+		ORDER BY c.id ASC
+	`
+	replyRows, err := db.Query(query, append(args, repliesShown)...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer replyRows.Close()
+
+	replies, err := scanCommentsWithUser(replyRows)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := db.loadCommentMentions(replies); err != nil {
+		return nil, false, err
+	}
+	for _, reply := range replies {
+		thread := byID[int(reply.ParentID.Int64)]
+		thread.Replies = append(thread.Replies, reply)
+	}
+
+	countRows, err := db.Query(`
+		SELECT parent_id, COUNT(*)
+		FROM comments
+		WHERE parent_id IN (`+placeholders+`)
+		GROUP BY parent_id
+	`, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer countRows.Close()
+
+	for countRows.Next() {
+		var parentID, count int
+		if err := countRows.Scan(&parentID, &count); err != nil {
+			return nil, false, err
+		}
+		thread := byID[parentID]
+		thread.EarlierReplies = count - len(thread.Replies)
+	}
+	return threads, more, countRows.Err()
+}
+
+// GetReplies retrieves up to limit of a comment's replies from before the
+// reply beforeID, oldest first, and how many earlier replies remain
+func (db *DB) GetReplies(parentID, beforeID, limit int) ([]CommentWithUser, int, error) {
+	query := `
+		SELECT ` + commentWithUserColumns + `
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.parent_id = ? AND c.id < ?
+		ORDER BY c.id DESC
+		LIMIT ?
+	`
+	rows, err := db.Query(query, parentID, beforeID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	replies, err := scanCommentsWithUser(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(replies) == 0 {
+		return nil, 0, nil
+	}
+	slices.Reverse(replies)
+	if err := db.loadCommentMentions(replies); err != nil {
+		return nil, 0, err
+	}
+
+	var earlier int
+	query = `SELECT COUNT(*) FROM comments WHERE parent_id = ? AND id < ?`
+	if err := db.QueryRow(query, parentID, replies[0].ID).Scan(&earlier); err != nil {
+		return nil, 0, err
+	}
+	return replies, earlier, nil
+}
+
+// GetCommentWithUser retrieves a single comment with its author
+func (db *DB) GetCommentWithUser(commentID int) (*CommentWithUser, error) {
+	query := `
+		SELECT ` + commentWithUserColumns + `
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.id = ?
+	`
+
+	rows, err := db.Query(query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments, err := scanCommentsWithUser(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &comments[0], db.loadCommentMentions(comments)
+}
+
+// scanCommentsWithUser scans comment rows joined with their author
+func scanCommentsWithUser(rows *sql.Rows) ([]CommentWithUser, error) {
 	var comments []CommentWithUser
 	for rows.Next() {
 		var comment CommentWithUser
@@ -81,9 +321,11 @@ func (db *DB) GetCommentsByActivity(activityID string) ([]CommentWithUser, error
 			&comment.Content,
 			&comment.CreatedAt,
 			&comment.UpdatedAt,
+			&comment.Status,
 			&displayName,
 			&nickname,
 			&avatarURL,
+			&comment.Revisions,
 		)
 		if err != nil {
 			return nil, err
@@ -96,12 +338,12 @@ func (db *DB) GetCommentsByActivity(activityID string) ([]CommentWithUser, error
 		comments = append(comments, comment)
 	}
 
-	return comments, nil
+	return comments, rows.Err()
 }
 
 func (db *DB) GetCommentByID(commentID int) (*Comment, error) {
 	query := `
-		SELECT id, activity_id, user_id, parent_id, content, created_at, updated_at
+		SELECT id, activity_id, user_id, parent_id, content, created_at, updated_at, status
 		FROM comments
 		WHERE id = ?
 	`
@@ -115,6 +357,7 @@ func (db *DB) GetCommentByID(commentID int) (*Comment, error) {
 		&comment.Content,
 		&comment.CreatedAt,
 		&comment.UpdatedAt,
+		&comment.Status,
 	)
 	if err != nil {
 		return nil, err
@@ -123,21 +366,103 @@ func (db *DB) GetCommentByID(commentID int) (*Comment, error) {
 	return &comment, nil
 }
 
+// UpdateComment replaces a comment's content, keeping the version it
+// replaces as a revision
 func (db *DB) UpdateComment(commentID int, content string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
+		INSERT INTO comment_revisions (comment_id, content, written_at)
+		SELECT id, content, updated_at FROM comments WHERE id = ?
+	`
+	if _, err := tx.Exec(query, commentID); err != nil {
+		return err
+	}
+
+	query = `
 		UPDATE comments
 		SET content = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
+	if _, err := tx.Exec(query, content, commentID); err != nil {
+		return err
+	}
 
-	_, err := db.Exec(query, content, commentID)
-	return err
+	return tx.Commit()
 }
 
+// GetCommentRevisions retrieves the earlier versions of a comment, newest first
+func (db *DB) GetCommentRevisions(commentID int) ([]CommentRevision, error) {
+	query := `
+		SELECT id, comment_id, content, written_at, replaced_at
+		FROM comment_revisions
+		WHERE comment_id = ?
+		ORDER BY id DESC
+	`
+	rows, err := db.Query(query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []CommentRevision
+	for rows.Next() {
+		var r CommentRevision
+		if err := rows.Scan(&r.ID, &r.CommentID, &r.Content, &r.WrittenAt, &r.ReplacedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// DeleteComment deletes a comment. A comment with replies is kept as a
+// tombstone instead, with its content, edit history and tags cleared and any
+// open reports resolved, so the replies stay threaded under it.
 func (db *DB) DeleteComment(commentID int) error {
-	query := `DELETE FROM comments WHERE id = ?`
-	_, err := db.Exec(query, commentID)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasReplies bool
+	query := `SELECT EXISTS (SELECT 1 FROM comments WHERE parent_id = ?)`
+	if err := tx.QueryRow(query, commentID).Scan(&hasReplies); err != nil {
+		return err
+	}
+
+	if !hasReplies {
+		if _, err := tx.Exec(`DELETE FROM comments WHERE id = ?`, commentID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	query = `
+		UPDATE comments
+		SET content = '', status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	if _, err := tx.Exec(query, CommentDeleted, commentID); err != nil {
+		return err
+	}
+	for _, query := range []string{
+		`DELETE FROM comment_revisions WHERE comment_id = ?`,
+		`DELETE FROM comment_mentions WHERE comment_id = ?`,
+		`DELETE FROM comment_cashtags WHERE comment_id = ?`,
+		`UPDATE comment_reports SET resolved_at = CURRENT_TIMESTAMP WHERE comment_id = ? AND resolved_at IS NULL`,
+	} {
+		if _, err := tx.Exec(query, commentID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (db *DB) GetCommentCount(activityID string) (int, error) {
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	_ "embed"
 	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -32,5 +33,82 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to execute schema: %w", err)
 	}
 
-	return &DB{db}, nil
+	d := &DB{db}
+	if err := d.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return d, nil
+}
+
+// columnMigration adds a column to a table created by an earlier version of schema.sql
+type columnMigration struct {
+	Table      string
+	Column     string
+	Definition string
+}
+
+// columnMigrations lists columns added after their table was first created.
+// New databases get these from schema.sql; existing ones are altered in place.
+var columnMigrations = []columnMigration{
+	{Table: "users", Column: "starting_equity", Definition: "REAL"},
+	{Table: "users", Column: "starting_equity_set_at", Definition: "DATETIME"},
+	{Table: "sessions", Column: "is_live", Definition: "BOOLEAN DEFAULT 0"},
+	{Table: "sessions", Column: "revoked_at", Definition: "DATETIME"},
+	{Table: "users", Column: "hide_from_leaderboard", Definition: "BOOLEAN DEFAULT 0"},
+	{Table: "users", Column: "hide_from_feed", Definition: "BOOLEAN DEFAULT 0"},
+	{Table: "users", Column: "hide_positions", Definition: "BOOLEAN DEFAULT 0"},
+	{Table: "users", Column: "trade_delay_minutes", Definition: "INTEGER DEFAULT 0"},
+	{Table: "users", Column: "hide_open_entries", Definition: "BOOLEAN DEFAULT 0"},
+	{Table: "league_standings", Column: "reset_dates", Definition: "TEXT NOT NULL DEFAULT ''"},
+	{Table: "users", Column: "lot_method", Definition: "TEXT NOT NULL DEFAULT 'fifo'"},
+	{Table: "users", Column: "is_admin", Definition: "BOOLEAN DEFAULT 0"},
+	{Table: "comments", Column: "status", Definition: "TEXT NOT NULL DEFAULT 'visible'"},
+}
+
+// migrate applies any column migrations missing from the current database
+func (db *DB) migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := db.columnExists(m.Table, m.Column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.Table, m.Column, m.Definition)
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", m.Table, m.Column, err)
+		}
+	}
+	return nil
+}
+
+// columnExists reports whether a table has the given column
+func (db *DB) columnExists(table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// formatTimestamp formats a time the way SQLite's CURRENT_TIMESTAMP stores it,
+// so comparisons against DEFAULT CURRENT_TIMESTAMP columns order correctly
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
 }
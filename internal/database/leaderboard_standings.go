@@ -0,0 +1,135 @@
+package database
+
+import (
+	"fmt"
+)
+
+// LeaderboardStanding is a user's recorded end-of-day place on one period's leaderboard
+type LeaderboardStanding struct {
+	Date        string // trading day in market time (YYYY-MM-DD)
+	Period      string
+	Mode        string
+	UserID      int
+	Rank        int
+	Total       int
+	GainPercent float64
+}
+
+// SaveLeaderboardStandings records a day's standings for a period and account
+// mode, replacing any recorded earlier that day
+func (db *DB) SaveLeaderboardStandings(date, period, mode string, standings []LeaderboardStanding) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM leaderboard_standings WHERE standing_date = ? AND period = ? AND mode = ?`, date, period, mode); err != nil {
+		return fmt.Errorf("failed to clear leaderboard standings: %w", err)
+	}
+
+	query := `
+		INSERT INTO leaderboard_standings (standing_date, period, mode, user_id, rank, total, gain_percent)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, standing := range standings {
+		_, err := tx.Exec(query, date, period, mode, standing.UserID, standing.Rank, standing.Total, standing.GainPercent)
+		if err != nil {
+			return fmt.Errorf("failed to insert leaderboard standing: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPreviousLeaderboardRanks returns each user's rank on the most recent
+// recorded day before the given date, keyed by user ID
+func (db *DB) GetPreviousLeaderboardRanks(period, mode, before string) (map[int]int, error) {
+	query := `
+		SELECT user_id, rank
+		FROM leaderboard_standings
+		WHERE period = ? AND mode = ? AND standing_date = (
+			SELECT MAX(standing_date) FROM leaderboard_standings
+			WHERE period = ? AND mode = ? AND standing_date < ?
+		)
+	`
+
+	rows, err := db.Query(query, period, mode, period, mode, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous leaderboard ranks: %w", err)
+	}
+	defer rows.Close()
+
+	ranks := make(map[int]int)
+	for rows.Next() {
+		var userID, rank int
+		if err := rows.Scan(&userID, &rank); err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard rank: %w", err)
+		}
+		ranks[userID] = rank
+	}
+	return ranks, rows.Err()
+}
+
+// GetDaysAtFirst counts the recorded days each user finished first on a
+// period's leaderboard, keyed by user ID
+func (db *DB) GetDaysAtFirst(period, mode string) (map[int]int, error) {
+	query := `
+		SELECT user_id, COUNT(*)
+		FROM leaderboard_standings
+		WHERE period = ? AND mode = ? AND rank = 1
+		GROUP BY user_id
+	`
+
+	rows, err := db.Query(query, period, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get days at first: %w", err)
+	}
+	defer rows.Close()
+
+	days := make(map[int]int)
+	for rows.Next() {
+		var userID, count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan days at first: %w", err)
+		}
+		days[userID] = count
+	}
+	return days, rows.Err()
+}
+
+// GetRankHistory retrieves a user's recorded standings on a period's
+// leaderboard since the given date, oldest first
+func (db *DB) GetRankHistory(userID int, period, mode, since string) ([]LeaderboardStanding, error) {
+	query := `
+		SELECT standing_date, period, mode, user_id, rank, total, gain_percent
+		FROM leaderboard_standings
+		WHERE user_id = ? AND period = ? AND mode = ? AND standing_date >= ?
+		ORDER BY standing_date ASC
+	`
+
+	rows, err := db.Query(query, userID, period, mode, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rank history: %w", err)
+	}
+	defer rows.Close()
+
+	var standings []LeaderboardStanding
+	for rows.Next() {
+		var standing LeaderboardStanding
+		err := rows.Scan(
+			&standing.Date,
+			&standing.Period,
+			&standing.Mode,
+			&standing.UserID,
+			&standing.Rank,
+			&standing.Total,
+			&standing.GainPercent,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rank history: %w", err)
+		}
+		standings = append(standings, standing)
+	}
+	return standings, rows.Err()
+}
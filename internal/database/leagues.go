@@ -0,0 +1,296 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// League is a named competition between a roster of users over a fixed window
+type League struct {
+	ID          int
+	Name        string
+	Description sql.NullString
+	Rules       sql.NullString
+	CreatorID   int
+	InviteCode  string
+	StartAt     time.Time
+	EndAt       time.Time
+	FinalizedAt sql.NullTime
+	CreatedAt   time.Time
+}
+
+// LeagueMember is a user on a league roster. StartEquity is filled in once the
+// member's equity at the league start has been read from portfolio history.
+type LeagueMember struct {
+	LeagueID    int
+	UserID      int
+	StartEquity sql.NullFloat64
+	JoinedAt    time.Time
+}
+
+// LeagueStanding is a member's frozen final result once a league has ended.
+// Rank is 0 for members who couldn't be ranked.
+type LeagueStanding struct {
+	LeagueID    int
+	UserID      int
+	Rank        int
+	StartEquity float64
+	EndEquity   float64
+	GainPercent float64
+	Resets      []string // trading days in the window the account appears to have been reset
+}
+
+// HasStarted reports whether the league window has opened
+func (l *League) HasStarted() bool {
+	return !time.Now().Before(l.StartAt)
+}
+
+// HasEnded reports whether the league window has closed
+func (l *League) HasEnded() bool {
+	return !time.Now().Before(l.EndAt)
+}
+
+const leagueColumns = `id, name, description, rules, creator_id, invite_code, start_at, end_at, finalized_at, created_at`
+
+func scanLeague(row rowScanner) (*League, error) {
+	var league League
+	err := row.Scan(
+		&league.ID,
+		&league.Name,
+		&league.Description,
+		&league.Rules,
+		&league.CreatorID,
+		&league.InviteCode,
+		&league.StartAt,
+		&league.EndAt,
+		&league.FinalizedAt,
+		&league.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &league, nil
+}
+
+// CreateLeague creates a league with a fresh invite code and adds the creator to its roster
+func (db *DB) CreateLeague(creatorID int, name, description, rules string, startAt, endAt time.Time) (*League, error) {
+	if !endAt.After(startAt) {
+		return nil, fmt.Errorf("league must end after it starts")
+	}
+
+	inviteCode, err := generateInviteCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invite code: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO leagues (name, description, rules, creator_id, invite_code, start_at, end_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING ` + leagueColumns
+
+	league, err := scanLeague(tx.QueryRow(query, name, NewNullString(description), NewNullString(rules), creatorID, inviteCode, startAt.UTC(), endAt.UTC()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create league: %w", err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO league_members (league_id, user_id) VALUES (?, ?)`, league.ID, creatorID); err != nil {
+		return nil, fmt.Errorf("failed to add creator to league: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit league: %w", err)
+	}
+
+	return league, nil
+}
+
+// GetLeagueByID retrieves a league by its ID
+func (db *DB) GetLeagueByID(leagueID int) (*League, error) {
+	query := `SELECT ` + leagueColumns + ` FROM leagues WHERE id = ?`
+	return scanLeague(db.QueryRow(query, leagueID))
+}
+
+// GetLeagueByInviteCode retrieves a league by its invite code (case-insensitive)
+func (db *DB) GetLeagueByInviteCode(inviteCode string) (*League, error) {
+	query := `SELECT ` + leagueColumns + ` FROM leagues WHERE invite_code = ?`
+	return scanLeague(db.QueryRow(query, strings.ToUpper(strings.TrimSpace(inviteCode))))
+}
+
+// GetLeaguesForUser retrieves every league the user is a member of, newest start first
+func (db *DB) GetLeaguesForUser(userID int) ([]League, error) {
+	query := `
+		SELECT l.id, l.name, l.description, l.rules, l.creator_id, l.invite_code, l.start_at, l.end_at, l.finalized_at, l.created_at
+		FROM leagues l
+		JOIN league_members m ON m.league_id = l.id
+		WHERE m.user_id = ?
+		ORDER BY l.start_at DESC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leagues: %w", err)
+	}
+	defer rows.Close()
+
+	var leagues []League
+	for rows.Next() {
+		league, err := scanLeague(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan league: %w", err)
+		}
+		leagues = append(leagues, *league)
+	}
+
+	return leagues, nil
+}
+
+// AddLeagueMember adds a user to a league roster; adding an existing member is a no-op
+func (db *DB) AddLeagueMember(leagueID, userID int) error {
+	query := `INSERT INTO league_members (league_id, user_id) VALUES (?, ?) ON CONFLICT(league_id, user_id) DO NOTHING`
+	if _, err := db.Exec(query, leagueID, userID); err != nil {
+		return fmt.Errorf("failed to add league member: %w", err)
+	}
+	return nil
+}
+
+// RemoveLeagueMember removes a user from a league roster
+func (db *DB) RemoveLeagueMember(leagueID, userID int) error {
+	query := `DELETE FROM league_members WHERE league_id = ? AND user_id = ?`
+	if _, err := db.Exec(query, leagueID, userID); err != nil {
+		return fmt.Errorf("failed to remove league member: %w", err)
+	}
+	return nil
+}
+
+// IsLeagueMember checks whether a user is on a league roster
+func (db *DB) IsLeagueMember(leagueID, userID int) (bool, error) {
+	query := `SELECT COUNT(*) FROM league_members WHERE league_id = ? AND user_id = ?`
+	var count int
+	if err := db.QueryRow(query, leagueID, userID).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check league membership: %w", err)
+	}
+	return count > 0, nil
+}
+
+// GetLeagueMembers retrieves a league's roster in join order
+func (db *DB) GetLeagueMembers(leagueID int) ([]LeagueMember, error) {
+	query := `
+		SELECT league_id, user_id, start_equity, joined_at
+		FROM league_members
+		WHERE league_id = ?
+		ORDER BY joined_at ASC, id ASC
+	`
+
+	rows, err := db.Query(query, leagueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get league members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []LeagueMember
+	for rows.Next() {
+		var member LeagueMember
+		if err := rows.Scan(&member.LeagueID, &member.UserID, &member.StartEquity, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan league member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// SetLeagueMemberStartEquity records a member's equity at the league start
+func (db *DB) SetLeagueMemberStartEquity(leagueID, userID int, startEquity float64) error {
+	query := `UPDATE league_members SET start_equity = ? WHERE league_id = ? AND user_id = ?`
+	if _, err := db.Exec(query, startEquity, leagueID, userID); err != nil {
+		return fmt.Errorf("failed to set league start equity: %w", err)
+	}
+	return nil
+}
+
+// FinalizeLeague freezes a league's final standings and marks it finalized
+func (db *DB) FinalizeLeague(leagueID int, standings []LeagueStanding) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO league_standings (league_id, user_id, rank, start_equity, end_equity, gain_percent, reset_dates)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(league_id, user_id) DO NOTHING
+	`
+	for _, standing := range standings {
+		_, err := tx.Exec(query, leagueID, standing.UserID, standing.Rank, standing.StartEquity, standing.EndEquity, standing.GainPercent, strings.Join(standing.Resets, ","))
+		if err != nil {
+			return fmt.Errorf("failed to insert league standing: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE leagues SET finalized_at = CURRENT_TIMESTAMP WHERE id = ? AND finalized_at IS NULL`, leagueID); err != nil {
+		return fmt.Errorf("failed to finalize league: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetLeagueStandings retrieves a finalized league's frozen standings in rank
+// order, with unranked members last
+func (db *DB) GetLeagueStandings(leagueID int) ([]LeagueStanding, error) {
+	query := `
+		SELECT league_id, user_id, rank, start_equity, end_equity, gain_percent, reset_dates
+		FROM league_standings
+		WHERE league_id = ?
+		ORDER BY rank = 0, rank ASC
+	`
+
+	rows, err := db.Query(query, leagueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get league standings: %w", err)
+	}
+	defer rows.Close()
+
+	var standings []LeagueStanding
+	for rows.Next() {
+		var standing LeagueStanding
+		var resets string
+		err := rows.Scan(
+			&standing.LeagueID,
+			&standing.UserID,
+			&standing.Rank,
+			&standing.StartEquity,
+			&standing.EndEquity,
+			&standing.GainPercent,
+			&resets,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan league standing: %w", err)
+		}
+		if resets != "" {
+			standing.Resets = strings.Split(resets, ",")
+		}
+		standings = append(standings, standing)
+	}
+
+	return standings, nil
+}
+
+// generateInviteCode returns a random 8 character uppercase hex code
+func generateInviteCode() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(b)), nil
+}
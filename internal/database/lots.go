@@ -0,0 +1,43 @@
+package database
+
+import "fmt"
+
+// SetLotMethod sets how a user's exits are matched to entries for realized P&L
+func (db *DB) SetLotMethod(userID int, method string) error {
+	_, err := db.Exec(`UPDATE users SET lot_method = ? WHERE id = ?`, method, userID)
+	return err
+}
+
+// SetLotSelection records the entry lot a user chose to close with an exit,
+// replacing any earlier choice for that exit
+func (db *DB) SetLotSelection(userID int, exitActivityID, entryActivityID string) error {
+	query := `
+		INSERT INTO lot_selections (user_id, exit_activity_id, entry_activity_id)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id, exit_activity_id) DO UPDATE SET
+			entry_activity_id = excluded.entry_activity_id,
+			selected_at = CURRENT_TIMESTAMP
+	`
+	_, err := db.Exec(query, userID, exitActivityID, entryActivityID)
+	return err
+}
+
+// GetLotSelections retrieves a user's chosen entry lot for each exit, keyed
+// by exit activity ID
+func (db *DB) GetLotSelections(userID int) (map[string]string, error) {
+	rows, err := db.Query(`SELECT exit_activity_id, entry_activity_id FROM lot_selections WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lot selections: %w", err)
+	}
+	defer rows.Close()
+
+	selections := make(map[string]string)
+	for rows.Next() {
+		var exitID, entryID string
+		if err := rows.Scan(&exitID, &entryID); err != nil {
+			return nil, fmt.Errorf("failed to scan lot selection: %w", err)
+		}
+		selections[exitID] = entryID
+	}
+	return selections, rows.Err()
+}
@@ -0,0 +1,285 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Comment statuses
+const (
+	CommentVisible = "visible"
+	CommentHidden  = "hidden"  // hidden automatically after enough reports, pending review
+	CommentRemoved = "removed" // removed by a moderator; replies stay threaded under it
+	CommentDeleted = "deleted" // deleted by its author after it was replied to
+)
+
+// Report reasons
+const (
+	ReportSpam       = "spam"
+	ReportHarassment = "harassment"
+	ReportMisleading = "misleading"
+	ReportOffTopic   = "off_topic"
+	ReportOther      = "other"
+)
+
+// ReportReasons lists every report reason in display order
+var ReportReasons = []string{ReportSpam, ReportHarassment, ReportMisleading, ReportOffTopic, ReportOther}
+
+// Moderation actions recorded in the audit log
+const (
+	ModerationHide    = "hide"    // enough reports hid the comment
+	ModerationRemove  = "remove"  // a moderator removed the comment
+	ModerationRestore = "restore" // a moderator put a removed comment back
+	ModerationDismiss = "dismiss" // a moderator kept the comment and closed its reports
+	ModerationFilter  = "filter"  // the word filter turned a comment away
+)
+
+// moderationStatuses is the comment status each moderator action leaves behind
+var moderationStatuses = map[string]string{
+	ModerationHide:    CommentHidden,
+	ModerationRemove:  CommentRemoved,
+	ModerationRestore: CommentVisible,
+	ModerationDismiss: CommentVisible,
+}
+
+// CommentReport is one user's report of a comment
+type CommentReport struct {
+	ID           int
+	CommentID    int
+	ReporterID   int
+	Reason       string
+	Details      string
+	CreatedAt    time.Time
+	ReporterName string
+}
+
+// ReportedComment is a comment waiting in the moderation queue with its open reports
+type ReportedComment struct {
+	CommentWithUser
+	Reports []CommentReport // newest first
+}
+
+// ModerationAction is an entry in the moderation audit log
+type ModerationAction struct {
+	ID          int
+	ModeratorID sql.NullInt64 // unset for automatic actions
+	CommentID   sql.NullInt64 // unset for comments the word filter kept out
+	UserID      int           // the comment's author
+	Action      string
+	Detail      string
+	CreatedAt   time.Time
+
+	ModeratorName string
+	UserName      string
+	CommentStatus string // the comment's current status, empty once it's deleted
+}
+
+// execer is implemented by both *DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// SetAdmins makes the users with the given Alpaca account IDs admins, and
+// everyone else not
+func (db *DB) SetAdmins(accountIDs []string) error {
+	if len(accountIDs) == 0 {
+		_, err := db.Exec(`UPDATE users SET is_admin = 0 WHERE is_admin = 1`)
+		return err
+	}
+
+	args := make([]interface{}, len(accountIDs))
+	for i, id := range accountIDs {
+		args[i] = id
+	}
+	query := `UPDATE users SET is_admin = alpaca_account_id IN (?` + generatePlaceholders(len(accountIDs)-1) + `)`
+	_, err := db.Exec(query, args...)
+	return err
+}
+
+// ReportComment records a user's report of a comment and returns how many
+// open reports the comment has. Reporting a comment again updates the
+// reporter's open report, or reopens one a moderator has closed.
+func (db *DB) ReportComment(commentID, reporterID int, reason, details string) (int, error) {
+	query := `
+		INSERT INTO comment_reports (comment_id, reporter_id, reason, details)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(comment_id, reporter_id) DO UPDATE SET
+			reason = excluded.reason,
+			details = excluded.details,
+			created_at = CURRENT_TIMESTAMP,
+			resolved_at = NULL
+	`
+	if _, err := db.Exec(query, commentID, reporterID, reason, details); err != nil {
+		return 0, fmt.Errorf("failed to report comment: %w", err)
+	}
+
+	var open int
+	err := db.QueryRow(`SELECT COUNT(*) FROM comment_reports WHERE comment_id = ? AND resolved_at IS NULL`, commentID).Scan(&open)
+	return open, err
+}
+
+// ModerateComment applies a moderation action to a comment and records it in
+// the audit log. moderatorID is nil for automatic actions. Every action but
+// hiding closes the comment's open reports.
+func (db *DB) ModerateComment(commentID int, moderatorID *int, action, detail string) error {
+	status, ok := moderationStatuses[action]
+	if !ok {
+		return fmt.Errorf("unknown moderation action %q", action)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var authorID int
+	err = tx.QueryRow(`UPDATE comments SET status = ? WHERE id = ? RETURNING user_id`, status, commentID).Scan(&authorID)
+	if err != nil {
+		return err
+	}
+
+	if action != ModerationHide {
+		query := `UPDATE comment_reports SET resolved_at = CURRENT_TIMESTAMP WHERE comment_id = ? AND resolved_at IS NULL`
+		if _, err := tx.Exec(query, commentID); err != nil {
+			return err
+		}
+	}
+
+	a := ModerationAction{
+		CommentID: sql.NullInt64{Int64: int64(commentID), Valid: true},
+		UserID:    authorID,
+		Action:    action,
+		Detail:    detail,
+	}
+	if moderatorID != nil {
+		a.ModeratorID = sql.NullInt64{Int64: int64(*moderatorID), Valid: true}
+	}
+	if err := logModerationAction(tx, a); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LogModerationAction records an action that didn't change a comment, such
+// as the word filter turning one away
+func (db *DB) LogModerationAction(a ModerationAction) error {
+	return logModerationAction(db, a)
+}
+
+func logModerationAction(e execer, a ModerationAction) error {
+	query := `
+		INSERT INTO moderation_actions (moderator_id, comment_id, user_id, action, detail)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	if _, err := e.Exec(query, a.ModeratorID, a.CommentID, a.UserID, a.Action, a.Detail); err != nil {
+		return fmt.Errorf("failed to log moderation action: %w", err)
+	}
+	return nil
+}
+
+// GetModerationQueue retrieves the comments with open reports or hidden
+// pending review, most reported first
+func (db *DB) GetModerationQueue() ([]ReportedComment, error) {
+	query := `
+		SELECT ` + commentWithUserColumns + `
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		LEFT JOIN (
+			SELECT comment_id, COUNT(*) AS open, MAX(created_at) AS latest
+			FROM comment_reports
+			WHERE resolved_at IS NULL
+			GROUP BY comment_id
+		) r ON r.comment_id = c.id
+		WHERE r.open > 0 OR c.status = ?
+		ORDER BY COALESCE(r.open, 0) DESC, r.latest DESC, c.id DESC
+	`
+	rows, err := db.Query(query, CommentHidden)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation queue: %w", err)
+	}
+	defer rows.Close()
+
+	comments, err := scanCommentsWithUser(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, nil
+	}
+
+	queue := make([]ReportedComment, len(comments))
+	byID := make(map[int]*ReportedComment, len(comments))
+	args := make([]interface{}, len(comments))
+	for i, comment := range comments {
+		queue[i] = ReportedComment{CommentWithUser: comment}
+		byID[comment.ID] = &queue[i]
+		args[i] = comment.ID
+	}
+
+	reportRows, err := db.Query(`
+		SELECT r.id, r.comment_id, r.reporter_id, r.reason, r.details, r.created_at,
+			COALESCE(NULLIF(u.nickname, ''), u.display_name, '')
+		FROM comment_reports r
+		JOIN users u ON r.reporter_id = u.id
+		WHERE r.resolved_at IS NULL AND r.comment_id IN (?`+generatePlaceholders(len(comments)-1)+`)
+		ORDER BY r.created_at DESC, r.id DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment reports: %w", err)
+	}
+	defer reportRows.Close()
+
+	for reportRows.Next() {
+		var report CommentReport
+		err := reportRows.Scan(
+			&report.ID, &report.CommentID, &report.ReporterID, &report.Reason, &report.Details, &report.CreatedAt,
+			&report.ReporterName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item := byID[report.CommentID]
+		item.Reports = append(item.Reports, report)
+	}
+	return queue, reportRows.Err()
+}
+
+// GetModerationActions retrieves the most recent entries in the moderation
+// audit log, newest first
+func (db *DB) GetModerationActions(limit int) ([]ModerationAction, error) {
+	query := `
+		SELECT
+			a.id, a.moderator_id, a.comment_id, a.user_id, a.action, a.detail, a.created_at,
+			COALESCE(NULLIF(m.nickname, ''), m.display_name, ''),
+			COALESCE(NULLIF(u.nickname, ''), u.display_name, ''),
+			COALESCE(c.status, '')
+		FROM moderation_actions a
+		LEFT JOIN users m ON a.moderator_id = m.id
+		LEFT JOIN users u ON a.user_id = u.id
+		LEFT JOIN comments c ON a.comment_id = c.id
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT ?
+	`
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []ModerationAction
+	for rows.Next() {
+		var a ModerationAction
+		err := rows.Scan(
+			&a.ID, &a.ModeratorID, &a.CommentID, &a.UserID, &a.Action, &a.Detail, &a.CreatedAt,
+			&a.ModeratorName, &a.UserName, &a.CommentStatus,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan moderation action: %w", err)
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Notification types
+const (
+	NotificationComment  = "comment"  // someone commented on the user's trade
+	NotificationReply    = "reply"    // someone replied to the user's comment
+	NotificationReaction = "reaction" // someone reacted to the user's trade
+	NotificationMention  = "mention"  // someone mentioned the user in a comment
+	NotificationFollow   = "follow"   // someone followed the user
+)
+
+// NotificationTypes lists every notification type in display order
+var NotificationTypes = []string{NotificationComment, NotificationReply, NotificationMention, NotificationReaction, NotificationFollow}
+
+// Notification tells a user about something another user did
+type Notification struct {
+	ID         int
+	UserID     int // recipient
+	ActorID    int
+	Type       string
+	ActivityID sql.NullString
+	CommentID  sql.NullInt64
+	Detail     string // comment excerpt or reaction emoji
+	ReadAt     sql.NullTime
+	CreatedAt  time.Time
+}
+
+// NotificationWithActor is a notification with the acting user's names
+type NotificationWithActor struct {
+	Notification
+	ActorDisplayName string
+	ActorNickname    string
+}
+
+// CreateNotification records a notification unless the recipient is the actor,
+// has turned the type off, or still has an identical one unread, e.g. from a
+// reaction toggled off and on again. It returns nil when nothing was recorded.
+func (db *DB) CreateNotification(n Notification) (*Notification, error) {
+	if n.UserID == n.ActorID {
+		return nil, nil
+	}
+
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, activity_id, comment_id, detail)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM notification_preferences
+			WHERE user_id = ? AND type = ? AND enabled = 0
+		) AND NOT EXISTS (
+			SELECT 1 FROM notifications
+			WHERE user_id = ? AND actor_id = ? AND type = ? AND activity_id IS ? AND comment_id IS ?
+				AND detail = ? AND read_at IS NULL
+		)
+		RETURNING id, created_at
+	`
+	err := db.QueryRow(query,
+		n.UserID, n.ActorID, n.Type, n.ActivityID, n.CommentID, n.Detail,
+		n.UserID, n.Type,
+		n.UserID, n.ActorID, n.Type, n.ActivityID, n.CommentID, n.Detail,
+	).Scan(&n.ID, &n.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+	return &n, nil
+}
+
+// GetNotifications retrieves a user's most recent notifications, newest first
+func (db *DB) GetNotifications(userID, limit int) ([]NotificationWithActor, error) {
+	query := `
+		SELECT
+			n.id, n.user_id, n.actor_id, n.type, n.activity_id, n.comment_id, n.detail, n.read_at, n.created_at,
+			COALESCE(u.display_name, ''), COALESCE(u.nickname, '')
+		FROM notifications n
+		JOIN users u ON n.actor_id = u.id
+		WHERE n.user_id = ?
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT ?
+	`
+	rows, err := db.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []NotificationWithActor
+	for rows.Next() {
+		var n NotificationWithActor
+		err := rows.Scan(
+			&n.ID, &n.UserID, &n.ActorID, &n.Type, &n.ActivityID, &n.CommentID, &n.Detail, &n.ReadAt, &n.CreatedAt,
+			&n.ActorDisplayName, &n.ActorNickname,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications returns how many of a user's notifications are unread
+func (db *DB) CountUnreadNotifications(userID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marks one of a user's notifications as read
+func (db *DB) MarkNotificationRead(userID, notificationID int) error {
+	query := `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND read_at IS NULL`
+	_, err := db.Exec(query, notificationID, userID)
+	return err
+}
+
+// MarkAllNotificationsRead marks every unread notification of a user as read
+func (db *DB) MarkAllNotificationsRead(userID int) error {
+	query := `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL`
+	_, err := db.Exec(query, userID)
+	return err
+}
+
+// GetNotificationPreferences reports whether each notification type is on
+// for a user, keyed by type
+func (db *DB) GetNotificationPreferences(userID int) (map[string]bool, error) {
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+
+	rows, err := db.Query(`SELECT type, enabled FROM notification_preferences WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t string
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		prefs[t] = enabled
+	}
+	return prefs, rows.Err()
+}
+
+// SetNotificationPreferences saves whether each notification type is on for a user
+func (db *DB) SetNotificationPreferences(userID int, prefs map[string]bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO notification_preferences (user_id, type, enabled)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id, type) DO UPDATE SET enabled = excluded.enabled
+	`
+	for _, t := range NotificationTypes {
+		if _, err := tx.Exec(query, userID, t, prefs[t]); err != nil {
+			return fmt.Errorf("failed to save notification preference: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
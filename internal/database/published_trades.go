@@ -0,0 +1,45 @@
+package database
+
+import (
+	"strings"
+)
+
+// PublishedTrade is a trade that has been shown to other traders
+type PublishedTrade struct {
+	ActivityID string
+	UserID     int
+}
+
+// PublishTrades records trades as visible to other traders. Trades already
+// published keep their original publish time.
+func (db *DB) PublishTrades(trades []PublishedTrade) error {
+	if len(trades) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(trades))
+	args := make([]any, 0, len(trades)*2)
+	for i, trade := range trades {
+		placeholders[i] = "(?, ?)"
+		args = append(args, trade.ActivityID, trade.UserID)
+	}
+
+	query := `INSERT OR IGNORE INTO published_trades (activity_id, user_id) VALUES ` + strings.Join(placeholders, ", ")
+	_, err := db.Exec(query, args...)
+	return err
+}
+
+// IsTradePublished reports whether a trade has been shown to other traders
+func (db *DB) IsTradePublished(activityID string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM published_trades WHERE activity_id = ?)`
+	err := db.QueryRow(query, activityID).Scan(&exists)
+	return exists, err
+}
+
+// GetTradeOwner returns the user whose published trade an activity is
+func (db *DB) GetTradeOwner(activityID string) (int, error) {
+	var userID int
+	err := db.QueryRow(`SELECT user_id FROM published_trades WHERE activity_id = ?`, activityID).Scan(&userID)
+	return userID, err
+}
@@ -10,7 +10,16 @@ CREATE TABLE IF NOT EXISTS users (
     is_public BOOLEAN DEFAULT 1,
     show_amounts BOOLEAN DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    last_sync_at DATETIME
+    last_sync_at DATETIME,
+    starting_equity REAL,
+    starting_equity_set_at DATETIME,
+    hide_from_leaderboard BOOLEAN DEFAULT 0,
+    hide_from_feed BOOLEAN DEFAULT 0,
+    hide_positions BOOLEAN DEFAULT 0,
+    trade_delay_minutes INTEGER DEFAULT 0,
+    hide_open_entries BOOLEAN DEFAULT 0,
+    lot_method TEXT NOT NULL DEFAULT 'fifo',
+    is_admin BOOLEAN DEFAULT 0
 );
 
 CREATE TABLE IF NOT EXISTS sessions (
@@ -18,6 +27,8 @@ CREATE TABLE IF NOT EXISTS sessions (
     user_id INTEGER NOT NULL,
     api_key TEXT NOT NULL,
     api_secret TEXT NOT NULL,
+    is_live BOOLEAN DEFAULT 0,
+    revoked_at DATETIME,
     expires_at DATETIME NOT NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
@@ -31,11 +42,47 @@ CREATE TABLE IF NOT EXISTS comments (
     content TEXT NOT NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    status TEXT NOT NULL DEFAULT 'visible', -- 'visible', 'hidden' or 'removed' by moderation, or 'deleted' by its author
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE CASCADE
 );
 
 CREATE INDEX IF NOT EXISTS idx_comments_activity ON comments(activity_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_id);
+
+-- Earlier versions of edited comments, kept so readers can see what changed
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    comment_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    written_at DATETIME NOT NULL, -- when this version was posted or last edited
+    replaced_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_revisions_comment ON comment_revisions(comment_id);
+
+-- @mentions resolved to users, keeping the nickname as written so the text links
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    nickname TEXT NOT NULL,
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_user ON comment_mentions(user_id);
+
+-- $TICKER cashtags in comments
+CREATE TABLE IF NOT EXISTS comment_cashtags (
+    comment_id INTEGER NOT NULL,
+    symbol TEXT NOT NULL,
+    PRIMARY KEY (comment_id, symbol),
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_cashtags_symbol ON comment_cashtags(symbol);
 
 CREATE TABLE IF NOT EXISTS reactions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -49,6 +96,16 @@ CREATE TABLE IF NOT EXISTS reactions (
 
 CREATE INDEX IF NOT EXISTS idx_reactions_activity ON reactions(activity_id);
 
+-- Trades that have been shown to other traders. Comments and reactions can only
+-- attach to a trade once it is here, so delayed trades stay untouchable until
+-- they are published.
+CREATE TABLE IF NOT EXISTS published_trades (
+    activity_id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    published_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 CREATE TABLE IF NOT EXISTS follows (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     follower_id INTEGER NOT NULL,
@@ -62,3 +119,184 @@ CREATE TABLE IF NOT EXISTS follows (
 
 CREATE INDEX IF NOT EXISTS idx_follows_follower ON follows(follower_id);
 CREATE INDEX IF NOT EXISTS idx_follows_following ON follows(following_id);
+
+CREATE TABLE IF NOT EXISTS portfolio_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    equity REAL NOT NULL,
+    last_equity REAL NOT NULL,
+    cash REAL NOT NULL,
+    taken_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_portfolio_snapshots_user ON portfolio_snapshots(user_id, taken_at);
+
+CREATE TABLE IF NOT EXISTS position_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snapshot_id INTEGER NOT NULL,
+    symbol TEXT NOT NULL,
+    asset_class TEXT,
+    qty REAL NOT NULL,
+    avg_entry_price REAL NOT NULL,
+    market_value REAL NOT NULL,
+    unrealized_pl REAL NOT NULL,
+    FOREIGN KEY (snapshot_id) REFERENCES portfolio_snapshots(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_position_snapshots_snapshot ON position_snapshots(snapshot_id);
+
+CREATE TABLE IF NOT EXISTS starting_equity_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    changed_by INTEGER,
+    old_value REAL,
+    new_value REAL NOT NULL,
+    source TEXT NOT NULL,
+    reason TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_starting_equity_audit_user ON starting_equity_audit(user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS leagues (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT,
+    rules TEXT,
+    creator_id INTEGER NOT NULL,
+    invite_code TEXT UNIQUE NOT NULL,
+    start_at DATETIME NOT NULL,
+    end_at DATETIME NOT NULL,
+    finalized_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK(end_at > start_at)
+);
+
+CREATE TABLE IF NOT EXISTS league_members (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    start_equity REAL,
+    joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (league_id) REFERENCES leagues(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(league_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_league_members_user ON league_members(user_id);
+
+CREATE TABLE IF NOT EXISTS league_standings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    rank INTEGER NOT NULL,
+    start_equity REAL NOT NULL,
+    end_equity REAL NOT NULL,
+    gain_percent REAL NOT NULL,
+    reset_dates TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (league_id) REFERENCES leagues(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(league_id, user_id)
+);
+
+-- End-of-day leaderboard standings, one row per ranked user for each
+-- period and account mode on every trading day
+CREATE TABLE IF NOT EXISTS leaderboard_standings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    standing_date TEXT NOT NULL, -- trading day in market time (YYYY-MM-DD)
+    period TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    rank INTEGER NOT NULL,
+    total INTEGER NOT NULL,
+    gain_percent REAL NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(standing_date, period, mode, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_leaderboard_standings_user ON leaderboard_standings(user_id, period, mode, standing_date);
+
+-- Entry lots a user chose to close with a given exit fill when realized
+-- P&L uses specific-lot matching
+CREATE TABLE IF NOT EXISTS lot_selections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    exit_activity_id TEXT NOT NULL,
+    entry_activity_id TEXT NOT NULL,
+    selected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(user_id, exit_activity_id)
+);
+
+-- Alpaca's asset catalog, refreshed daily, for company names and symbol search
+CREATE TABLE IF NOT EXISTS assets (
+    symbol TEXT PRIMARY KEY,
+    alpaca_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    exchange TEXT NOT NULL,
+    asset_class TEXT NOT NULL,
+    status TEXT NOT NULL,
+    tradable BOOLEAN NOT NULL DEFAULT 0,
+    fractionable BOOLEAN NOT NULL DEFAULT 0,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- In-app notifications of social events: comments, replies, reactions and follows
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL, -- recipient
+    actor_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    activity_id TEXT,
+    comment_id INTEGER,
+    detail TEXT NOT NULL DEFAULT '', -- comment excerpt or reaction emoji
+    read_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at);
+
+-- Notification types a user has turned off; every type is on by default
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Reports of comments by other users, open until a moderator acts on the comment
+CREATE TABLE IF NOT EXISTS comment_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    comment_id INTEGER NOT NULL,
+    reporter_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    resolved_at DATETIME,
+    UNIQUE (comment_id, reporter_id),
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_reports_open ON comment_reports(resolved_at, comment_id);
+
+-- Audit log of moderation: hides, removals, restores, dismissed reports and
+-- filtered comments. Rows outlive the comments and users they name.
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    moderator_id INTEGER, -- NULL for automatic actions
+    comment_id INTEGER,   -- NULL for comments the word filter kept out
+    user_id INTEGER NOT NULL, -- the comment's author
+    action TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_created ON moderation_actions(created_at);
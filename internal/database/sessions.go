@@ -1,6 +1,7 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 )
@@ -10,12 +11,14 @@ type Session struct {
 	UserID    int
 	APIKey    string
 	APISecret string
+	IsLive    bool         // credentials belong to a live (not paper) trading account
+	RevokedAt sql.NullTime // set when Alpaca rejected the credentials
 	ExpiresAt time.Time
 	CreatedAt time.Time
 }
 
 // CreateSession creates a new session with encrypted API keys
-func (db *DB) CreateSession(sessionID string, userID int, apiKey, apiSecret string, expiresAt time.Time) (*Session, error) {
+func (db *DB) CreateSession(sessionID string, userID int, apiKey, apiSecret string, isLive bool, expiresAt time.Time) (*Session, error) {
 	// Encrypt API credentials
 	encryptedKey, err := Encrypt(apiKey)
 	if err != nil {
@@ -28,18 +31,19 @@ func (db *DB) CreateSession(sessionID string, userID int, apiKey, apiSecret stri
 	}
 
 	query := `
-		INSERT INTO sessions (id, user_id, api_key, api_secret, expires_at)
-		VALUES (?, ?, ?, ?, ?)
-		RETURNING id, user_id, api_key, api_secret, expires_at, created_at
+		INSERT INTO sessions (id, user_id, api_key, api_secret, is_live, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id, user_id, api_key, api_secret, is_live, expires_at, created_at
 	`
 
 	var session Session
 	var encryptedKeyDB, encryptedSecretDB string
-	err = db.QueryRow(query, sessionID, userID, encryptedKey, encryptedSecret, expiresAt).Scan(
+	err = db.QueryRow(query, sessionID, userID, encryptedKey, encryptedSecret, isLive, expiresAt).Scan(
 		&session.ID,
 		&session.UserID,
 		&encryptedKeyDB,
 		&encryptedSecretDB,
+		&session.IsLive,
 		&session.ExpiresAt,
 		&session.CreatedAt,
 	)
@@ -57,7 +61,7 @@ func (db *DB) CreateSession(sessionID string, userID int, apiKey, apiSecret stri
 // GetSessionByID retrieves a session by ID and decrypts API keys
 func (db *DB) GetSessionByID(sessionID string) (*Session, error) {
 	query := `
-		SELECT id, user_id, api_key, api_secret, expires_at, created_at
+		SELECT id, user_id, api_key, api_secret, is_live, revoked_at, expires_at, created_at
 		FROM sessions
 		WHERE id = ?
 	`
@@ -69,6 +73,8 @@ func (db *DB) GetSessionByID(sessionID string) (*Session, error) {
 		&session.UserID,
 		&encryptedKey,
 		&encryptedSecret,
+		&session.IsLive,
+		&session.RevokedAt,
 		&session.ExpiresAt,
 		&session.CreatedAt,
 	)
@@ -102,12 +108,26 @@ func (s *Session) IsExpired() bool {
 	return time.Now().After(s.ExpiresAt)
 }
 
+// IsRevoked reports whether the session's API key was rejected by Alpaca
+func (s *Session) IsRevoked() bool {
+	return s.RevokedAt.Valid
+}
+
+// RevokeSessionsForUser marks all of a user's sessions as revoked. Revoked
+// sessions are skipped by background work and send the user back to login.
+func (db *DB) RevokeSessionsForUser(userID int) error {
+	query := `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL`
+	_, err := db.Exec(query, userID)
+	return err
+}
+
 // GetAllActiveSessions retrieves all non-expired sessions
 func (db *DB) GetAllActiveSessions() ([]Session, error) {
 	query := `
-		SELECT id, user_id, api_key, api_secret, expires_at, created_at
+		SELECT id, user_id, api_key, api_secret, is_live, expires_at, created_at
 		FROM sessions
 		WHERE expires_at > datetime('now')
+		AND revoked_at IS NULL
 	`
 
 	rows, err := db.Query(query)
@@ -125,6 +145,7 @@ func (db *DB) GetAllActiveSessions() ([]Session, error) {
 			&session.UserID,
 			&encryptedKey,
 			&encryptedSecret,
+			&session.IsLive,
 			&session.ExpiresAt,
 			&session.CreatedAt,
 		)
@@ -165,12 +186,12 @@ func (db *DB) DeleteOldSessionsForUser(userID int) error {
 	return err
 }
 
-// GetLatestSession retrieves the most recent session for a user
+// GetLatestSession retrieves the most recent unrevoked session for a user
 func (db *DB) GetLatestSession(userID int) (*Session, error) {
 	query := `
-		SELECT id, user_id, api_key, api_secret, expires_at, created_at
+		SELECT id, user_id, api_key, api_secret, is_live, expires_at, created_at
 		FROM sessions
-		WHERE user_id = ?
+		WHERE user_id = ? AND revoked_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
@@ -182,6 +203,7 @@ func (db *DB) GetLatestSession(userID int) (*Session, error) {
 		&session.UserID,
 		&encryptedKey,
 		&encryptedSecret,
+		&session.IsLive,
 		&session.ExpiresAt,
 		&session.CreatedAt,
 	)
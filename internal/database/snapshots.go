@@ -0,0 +1,215 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// PortfolioSnapshot is a point-in-time copy of a user's Alpaca account balances
+type PortfolioSnapshot struct {
+	ID         int
+	UserID     int
+	Equity     float64
+	LastEquity float64
+	Cash       float64
+	TakenAt    time.Time
+}
+
+// PositionSnapshot is a single open position captured alongside a portfolio snapshot
+type PositionSnapshot struct {
+	ID            int
+	SnapshotID    int
+	Symbol        string
+	AssetClass    string
+	Qty           float64
+	AvgEntryPrice float64
+	MarketValue   float64
+	UnrealizedPL  float64
+}
+
+// CreatePortfolioSnapshot stores a portfolio snapshot and its positions in a single transaction
+func (db *DB) CreatePortfolioSnapshot(snapshot PortfolioSnapshot, positions []PositionSnapshot) (*PortfolioSnapshot, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO portfolio_snapshots (user_id, equity, last_equity, cash)
+		VALUES (?, ?, ?, ?)
+		RETURNING id, user_id, equity, last_equity, cash, taken_at
+	`
+
+	var created PortfolioSnapshot
+	err = tx.QueryRow(query, snapshot.UserID, snapshot.Equity, snapshot.LastEquity, snapshot.Cash).Scan(
+		&created.ID,
+		&created.UserID,
+		&created.Equity,
+		&created.LastEquity,
+		&created.Cash,
+		&created.TakenAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert portfolio snapshot: %w", err)
+	}
+
+	positionQuery := `
+		INSERT INTO position_snapshots (snapshot_id, symbol, asset_class, qty, avg_entry_price, market_value, unrealized_pl)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, pos := range positions {
+		_, err := tx.Exec(positionQuery, created.ID, pos.Symbol, NewNullString(pos.AssetClass), pos.Qty, pos.AvgEntryPrice, pos.MarketValue, pos.UnrealizedPL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert position snapshot for %s: %w", pos.Symbol, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit snapshot: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetPortfolioSnapshotBefore retrieves a user's most recent snapshot taken before the given time
+func (db *DB) GetPortfolioSnapshotBefore(userID int, before time.Time) (*PortfolioSnapshot, error) {
+	query := `
+		SELECT id, user_id, equity, last_equity, cash, taken_at
+		FROM portfolio_snapshots
+		WHERE user_id = ? AND taken_at < ?
+		ORDER BY taken_at DESC, id DESC
+		LIMIT 1
+	`
+
+	var snapshot PortfolioSnapshot
+	err := db.QueryRow(query, userID, formatTimestamp(before)).Scan(
+		&snapshot.ID,
+		&snapshot.UserID,
+		&snapshot.Equity,
+		&snapshot.LastEquity,
+		&snapshot.Cash,
+		&snapshot.TakenAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// GetFirstPortfolioSnapshot retrieves the oldest snapshot for a user
+func (db *DB) GetFirstPortfolioSnapshot(userID int) (*PortfolioSnapshot, error) {
+	query := `
+		SELECT id, user_id, equity, last_equity, cash, taken_at
+		FROM portfolio_snapshots
+		WHERE user_id = ?
+		ORDER BY taken_at ASC, id ASC
+		LIMIT 1
+	`
+
+	var snapshot PortfolioSnapshot
+	err := db.QueryRow(query, userID).Scan(
+		&snapshot.ID,
+		&snapshot.UserID,
+		&snapshot.Equity,
+		&snapshot.LastEquity,
+		&snapshot.Cash,
+		&snapshot.TakenAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// GetLatestPortfolioSnapshot retrieves the most recent snapshot for a user
+func (db *DB) GetLatestPortfolioSnapshot(userID int) (*PortfolioSnapshot, error) {
+	query := `
+		SELECT id, user_id, equity, last_equity, cash, taken_at
+		FROM portfolio_snapshots
+		WHERE user_id = ?
+		ORDER BY taken_at DESC, id DESC
+		LIMIT 1
+	`
+
+	var snapshot PortfolioSnapshot
+	err := db.QueryRow(query, userID).Scan(
+		&snapshot.ID,
+		&snapshot.UserID,
+		&snapshot.Equity,
+		&snapshot.LastEquity,
+		&snapshot.Cash,
+		&snapshot.TakenAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// GetPositionSnapshots retrieves the positions captured with a portfolio snapshot
+func (db *DB) GetPositionSnapshots(snapshotID int) ([]PositionSnapshot, error) {
+	query := `
+		SELECT id, snapshot_id, symbol, COALESCE(asset_class, ''), qty, avg_entry_price, market_value, unrealized_pl
+		FROM position_snapshots
+		WHERE snapshot_id = ?
+		ORDER BY market_value DESC
+	`
+
+	rows, err := db.Query(query, snapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []PositionSnapshot
+	for rows.Next() {
+		var pos PositionSnapshot
+		err := rows.Scan(
+			&pos.ID,
+			&pos.SnapshotID,
+			&pos.Symbol,
+			&pos.AssetClass,
+			&pos.Qty,
+			&pos.AvgEntryPrice,
+			&pos.MarketValue,
+			&pos.UnrealizedPL,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan position snapshot: %w", err)
+		}
+		positions = append(positions, pos)
+	}
+
+	return positions, rows.Err()
+}
+
+// PrunePortfolioSnapshots downsamples snapshots taken before the cutoff to the
+// last one of each day per user, deleting the rest along with their positions.
+// Each user's oldest snapshot is also kept since it stands in for their
+// starting equity.
+func (db *DB) PrunePortfolioSnapshots(before time.Time) (int64, error) {
+	cutoff := formatTimestamp(before)
+	query := `
+		DELETE FROM portfolio_snapshots
+		WHERE taken_at < ? AND id NOT IN (
+			SELECT MAX(id)
+			FROM portfolio_snapshots
+			WHERE taken_at < ?
+			GROUP BY user_id, date(taken_at)
+		) AND id NOT IN (
+			SELECT MIN(id)
+			FROM portfolio_snapshots
+			GROUP BY user_id
+		)
+	`
+
+	result, err := db.Exec(query, cutoff, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune portfolio snapshots: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Sources recorded in the starting equity audit trail
+const (
+	StartingEquitySourcePortfolioHistory = "portfolio_history"
+	StartingEquitySourceSnapshot         = "snapshot"
+	StartingEquitySourceUser             = "user"
+)
+
+// StartingEquityChange is one entry in a user's starting equity audit trail
+type StartingEquityChange struct {
+	ID        int
+	UserID    int
+	ChangedBy sql.NullInt64
+	OldValue  sql.NullFloat64
+	NewValue  float64
+	Source    string
+	Reason    sql.NullString
+	CreatedAt time.Time
+}
+
+// SetStartingEquity updates a user's baseline equity and records the change in the audit trail.
+// changedBy is nil when the baseline was derived automatically.
+func (db *DB) SetStartingEquity(userID int, value float64, source string, changedBy *int, reason string) error {
+	if value <= 0 {
+		return fmt.Errorf("starting equity must be positive")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldValue sql.NullFloat64
+	if err := tx.QueryRow(`SELECT starting_equity FROM users WHERE id = ?`, userID).Scan(&oldValue); err != nil {
+		return fmt.Errorf("failed to get current starting equity: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE users SET starting_equity = ?, starting_equity_set_at = CURRENT_TIMESTAMP WHERE id = ?`, value, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update starting equity: %w", err)
+	}
+
+	var changedByVal sql.NullInt64
+	if changedBy != nil {
+		changedByVal = sql.NullInt64{Int64: int64(*changedBy), Valid: true}
+	}
+
+	query := `
+		INSERT INTO starting_equity_audit (user_id, changed_by, old_value, new_value, source, reason)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	if _, err := tx.Exec(query, userID, changedByVal, oldValue, value, source, NewNullString(reason)); err != nil {
+		return fmt.Errorf("failed to record starting equity change: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetStartingEquityHistory returns a user's starting equity changes, newest first
+func (db *DB) GetStartingEquityHistory(userID int) ([]StartingEquityChange, error) {
+	query := `
+		SELECT id, user_id, changed_by, old_value, new_value, source, reason, created_at
+		FROM starting_equity_audit
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get starting equity history: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []StartingEquityChange
+	for rows.Next() {
+		var change StartingEquityChange
+		err := rows.Scan(
+			&change.ID,
+			&change.UserID,
+			&change.ChangedBy,
+			&change.OldValue,
+			&change.NewValue,
+			&change.Source,
+			&change.Reason,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan starting equity change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
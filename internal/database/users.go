@@ -16,21 +16,52 @@ type User struct {
 	ShowAmounts     bool
 	CreatedAt       time.Time
 	LastSyncAt      sql.NullTime
+	StartingEquity  sql.NullFloat64
+
+	HideFromLeaderboard bool
+	HideFromFeed        bool
+	HidePositions       bool
+	TradeDelayMinutes   int
+	HideOpenEntries     bool
+
+	LotMethod string // how exits are matched to entries for realized P&L
+	IsAdmin   bool   // can moderate comments
 }
 
-// CreateUser creates a new user or returns existing user
-func (db *DB) CreateUser(alpacaAccountID string, email *string, displayName string) (*User, error) {
-	query := `
-		INSERT INTO users (alpaca_account_id, email, display_name)
-		VALUES (?, ?, ?)
-		ON CONFLICT(alpaca_account_id) DO UPDATE SET
-			email = COALESCE(excluded.email, email),
-			display_name = COALESCE(excluded.display_name, display_name)
-		RETURNING id, alpaca_account_id, email, display_name, nickname, avatar_url, is_public, show_amounts, created_at, last_sync_at
-	`
+// PrivacySettings are a user's controls over what other traders can see
+type PrivacySettings struct {
+	IsPublic            bool // profile is visible; private users appear nowhere
+	ShowAmounts         bool // dollar amounts are shown; percentages always are
+	HideFromLeaderboard bool
+	HideFromFeed        bool
+	HidePositions       bool // holdings are hidden on the profile, performance % still shows
+	TradeDelayMinutes   int  // trades are published to others this long after they fill
+	HideOpenEntries     bool // fills that opened a still-open position stay hidden until it closes
+}
+
+// MaxTradeDelayMinutes caps the trade publishing delay at one week
+const MaxTradeDelayMinutes = 7 * 24 * 60
+
+// DefaultStartingEquity is the balance a new Alpaca paper account is funded with,
+// used as the baseline until a user's real starting equity is known
+const DefaultStartingEquity = 100000.0
+
+// MaxStartingEquity bounds manually entered baselines; it is far above any
+// account the app ranks, so only a typo would reach it
+const MaxStartingEquity = 1000000000.0
+
+// userColumns is the column list every user query selects, in scanUser order
+const userColumns = `id, alpaca_account_id, email, display_name, nickname, avatar_url, is_public, show_amounts, created_at, last_sync_at, starting_equity, hide_from_leaderboard, hide_from_feed, hide_positions, trade_delay_minutes, hide_open_entries, lot_method, is_admin`
 
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser scans a row selected with userColumns into a User
+func scanUser(row rowScanner) (*User, error) {
 	var user User
-	err := db.QueryRow(query, alpacaAccountID, email, displayName).Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.AlpacaAccountID,
 		&user.Email,
@@ -41,18 +72,65 @@ func (db *DB) CreateUser(alpacaAccountID string, email *string, displayName stri
 		&user.ShowAmounts,
 		&user.CreatedAt,
 		&user.LastSyncAt,
+		&user.StartingEquity,
+		&user.HideFromLeaderboard,
+		&user.HideFromFeed,
+		&user.HidePositions,
+		&user.TradeDelayMinutes,
+		&user.HideOpenEntries,
+		&user.LotMethod,
+		&user.IsAdmin,
 	)
 	if err != nil {
 		return nil, err
 	}
-
 	return &user, nil
 }
 
+// Baseline returns the equity the user's total gain is measured against
+func (u *User) Baseline() float64 {
+	if u.StartingEquity.Valid && u.StartingEquity.Float64 > 0 {
+		return u.StartingEquity.Float64
+	}
+	return DefaultStartingEquity
+}
+
+// Privacy returns the user's privacy settings
+func (u *User) Privacy() PrivacySettings {
+	return PrivacySettings{
+		IsPublic:            u.IsPublic,
+		ShowAmounts:         u.ShowAmounts,
+		HideFromLeaderboard: u.HideFromLeaderboard,
+		HideFromFeed:        u.HideFromFeed,
+		HidePositions:       u.HidePositions,
+		TradeDelayMinutes:   u.TradeDelayMinutes,
+		HideOpenEntries:     u.HideOpenEntries,
+	}
+}
+
+// TradeDelay returns how long the user's trades are held back from other traders
+func (u *User) TradeDelay() time.Duration {
+	return time.Duration(u.TradeDelayMinutes) * time.Minute
+}
+
+// CreateUser creates a new user or returns existing user
+func (db *DB) CreateUser(alpacaAccountID string, email *string, displayName string) (*User, error) {
+	query := `
+		INSERT INTO users (alpaca_account_id, email, display_name)
+		VALUES (?, ?, ?)
+		ON CONFLICT(alpaca_account_id) DO UPDATE SET
+			email = COALESCE(excluded.email, email),
+			display_name = COALESCE(excluded.display_name, display_name)
+		RETURNING ` + userColumns + `
+	`
+
+	return scanUser(db.QueryRow(query, alpacaAccountID, email, displayName))
+}
+
 // GetAllPublicUsers retrieves all users with public profiles
 func (db *DB) GetAllPublicUsers() ([]User, error) {
 	query := `
-		SELECT id, alpaca_account_id, email, display_name, nickname, avatar_url, is_public, show_amounts, created_at, last_sync_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE is_public = 1
 		ORDER BY created_at DESC
@@ -66,82 +144,112 @@ func (db *DB) GetAllPublicUsers() ([]User, error) {
 
 	var users []User
 	for rows.Next() {
-		var user User
-		err := rows.Scan(
-			&user.ID,
-			&user.AlpacaAccountID,
-			&user.Email,
-			&user.DisplayName,
-			&user.Nickname,
-			&user.AvatarURL,
-			&user.IsPublic,
-			&user.ShowAmounts,
-			&user.CreatedAt,
-			&user.LastSyncAt,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 
 	return users, nil
 }
 
-// GetUserByID retrieves a user by their ID
-func (db *DB) GetUserByID(id int) (*User, error) {
+// GetLeaderboardUsers retrieves public users who haven't opted out of the leaderboard
+func (db *DB) GetLeaderboardUsers() ([]User, error) {
+	return db.queryUsers(`
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE is_public = 1 AND hide_from_leaderboard = 0
+		ORDER BY created_at DESC
+	`)
+}
+
+// GetFeedUserIDs retrieves the IDs of public users who haven't opted out of the activity feed
+func (db *DB) GetFeedUserIDs() ([]int, error) {
+	users, err := db.queryUsers(`
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE is_public = 1 AND hide_from_feed = 0
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return ids, nil
+}
+
+// queryUsers runs a query selecting userColumns and scans every row
+func (db *DB) queryUsers(query string, args ...any) ([]User, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// GetUsersWithSessions retrieves all users that have at least one unrevoked session
+func (db *DB) GetUsersWithSessions() ([]User, error) {
 	query := `
-		SELECT id, alpaca_account_id, email, display_name, nickname, avatar_url, is_public, show_amounts, created_at, last_sync_at
+		SELECT ` + userColumns + `
 		FROM users
-		WHERE id = ?
+		WHERE EXISTS (SELECT 1 FROM sessions WHERE sessions.user_id = users.id AND sessions.revoked_at IS NULL)
+		ORDER BY id ASC
 	`
 
-	var user User
-	err := db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.AlpacaAccountID,
-		&user.Email,
-		&user.DisplayName,
-		&user.Nickname,
-		&user.AvatarURL,
-		&user.IsPublic,
-		&user.ShowAmounts,
-		&user.CreatedAt,
-		&user.LastSyncAt,
-	)
+	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &user, nil
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, nil
+}
+
+// GetUserByID retrieves a user by their ID
+func (db *DB) GetUserByID(id int) (*User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = ?
+	`
+
+	return scanUser(db.QueryRow(query, id))
 }
 
 // GetUserByAlpacaID retrieves a user by their Alpaca account ID
 func (db *DB) GetUserByAlpacaID(alpacaAccountID string) (*User, error) {
 	query := `
-		SELECT id, alpaca_account_id, email, display_name, nickname, avatar_url, is_public, show_amounts, created_at, last_sync_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE alpaca_account_id = ?
 	`
 
-	var user User
-	err := db.QueryRow(query, alpacaAccountID).Scan(
-		&user.ID,
-		&user.AlpacaAccountID,
-		&user.Email,
-		&user.DisplayName,
-		&user.Nickname,
-		&user.AvatarURL,
-		&user.IsPublic,
-		&user.ShowAmounts,
-		&user.CreatedAt,
-		&user.LastSyncAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
+	return scanUser(db.QueryRow(query, alpacaAccountID))
 }
 
 // UpdateLastSync updates the last sync timestamp for a user
@@ -158,10 +266,31 @@ func (db *DB) UpdateUserNickname(userID int, nickname sql.NullString) error {
 	return err
 }
 
+// UpdatePrivacySettings replaces a user's privacy settings
+func (db *DB) UpdatePrivacySettings(userID int, settings PrivacySettings) error {
+	query := `
+		UPDATE users
+		SET is_public = ?, show_amounts = ?, hide_from_leaderboard = ?, hide_from_feed = ?, hide_positions = ?,
+			trade_delay_minutes = ?, hide_open_entries = ?
+		WHERE id = ?
+	`
+	_, err := db.Exec(query,
+		settings.IsPublic,
+		settings.ShowAmounts,
+		settings.HideFromLeaderboard,
+		settings.HideFromFeed,
+		settings.HidePositions,
+		settings.TradeDelayMinutes,
+		settings.HideOpenEntries,
+		userID,
+	)
+	return err
+}
+
 // SearchUsers searches for users by nickname, display name, or email
 func (db *DB) SearchUsers(searchTerm string, limit int) ([]User, error) {
 	query := `
-		SELECT id, alpaca_account_id, email, display_name, nickname, avatar_url, is_public, show_amounts, created_at, last_sync_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE is_public = 1
 		AND (
@@ -188,23 +317,11 @@ func (db *DB) SearchUsers(searchTerm string, limit int) ([]User, error) {
 
 	var users []User
 	for rows.Next() {
-		var user User
-		err := rows.Scan(
-			&user.ID,
-			&user.AlpacaAccountID,
-			&user.Email,
-			&user.DisplayName,
-			&user.Nickname,
-			&user.AvatarURL,
-			&user.IsPublic,
-			&user.ShowAmounts,
-			&user.CreatedAt,
-			&user.LastSyncAt,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 
 	return users, nil
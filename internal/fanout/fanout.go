@@ -0,0 +1,100 @@
+// Package fanout runs per-user upstream fetches concurrently with a bounded
+// number of workers, returning whatever finished before the deadline.
+package fanout
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSkip is returned by a task to drop its item without counting it as
+// unavailable, e.g. a user who has no data for the requested view
+var ErrSkip = errors.New("fanout: skip item")
+
+// Results holds the outcome of Run
+type Results[T any] struct {
+	Values []T // successful results, in the order of the input items
+	// Unavailable counts items whose task failed or didn't finish before the
+	// context was done
+	Unavailable int
+}
+
+// Partial reports whether some items are missing from Values
+func (r Results[T]) Partial() bool {
+	return r.Unavailable > 0
+}
+
+// Run calls task for every item using at most workers goroutines. It returns
+// when all tasks have finished or ctx is done, whichever comes first; tasks
+// still running at that point are counted as unavailable and their results
+// are discarded. Tasks should honor ctx, but Run doesn't wait for those that
+// don't.
+func Run[I, T any](ctx context.Context, workers int, items []I, task func(context.Context, I) (T, error)) Results[T] {
+	type outcome struct {
+		index int
+		value T
+		err   error
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	workers = min(workers, len(items))
+
+	// Buffered so workers never block on a caller that has already returned
+	outcomes := make(chan outcome, len(items))
+	jobs := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				value, err := task(ctx, items[i])
+				outcomes <- outcome{index: i, value: value, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range items {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	done := make([]bool, len(items))
+	values := make([]T, len(items))
+	skipped := 0
+	succeeded := 0
+
+collect:
+	for received := 0; received < len(items); received++ {
+		select {
+		case o := <-outcomes:
+			switch {
+			case errors.Is(o.err, ErrSkip):
+				skipped++
+			case o.err == nil:
+				done[o.index] = true
+				values[o.index] = o.value
+				succeeded++
+			}
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	results := Results[T]{
+		Values:      make([]T, 0, succeeded),
+		Unavailable: len(items) - succeeded - skipped,
+	}
+	for i, ok := range done {
+		if ok {
+			results.Values = append(results.Values, values[i])
+		}
+	}
+	return results
+}
@@ -0,0 +1,94 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunKeepsInputOrder(t *testing.T) {
+	items := []int{5, 4, 3, 2, 1}
+	results := Run(context.Background(), 3, items, func(ctx context.Context, n int) (int, error) {
+		// Finish out of order
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		return n * 10, nil
+	})
+
+	want := []int{50, 40, 30, 20, 10}
+	if len(results.Values) != len(want) {
+		t.Fatalf("Expected %d values, got %v", len(want), results.Values)
+	}
+	for i := range want {
+		if results.Values[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, results.Values)
+			break
+		}
+	}
+	if results.Partial() {
+		t.Errorf("Expected complete results, %d unavailable", results.Unavailable)
+	}
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	items := make([]int, 20)
+
+	Run(context.Background(), 4, items, func(ctx context.Context, _ int) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return 0, nil
+	})
+
+	if got := peak.Load(); got > 4 {
+		t.Errorf("Expected at most 4 concurrent tasks, saw %d", got)
+	}
+}
+
+func TestRunCountsFailuresAndSkips(t *testing.T) {
+	items := []string{"ok", "fail", "skip", "ok"}
+	results := Run(context.Background(), 2, items, func(ctx context.Context, s string) (string, error) {
+		switch s {
+		case "fail":
+			return "", errors.New("upstream error")
+		case "skip":
+			return "", ErrSkip
+		}
+		return s, nil
+	})
+
+	if len(results.Values) != 2 {
+		t.Errorf("Expected 2 values, got %v", results.Values)
+	}
+	if results.Unavailable != 1 {
+		t.Errorf("Expected 1 unavailable, got %d", results.Unavailable)
+	}
+}
+
+func TestRunReturnsPartialResultsAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	items := []time.Duration{0, 0, time.Second, time.Second}
+	start := time.Now()
+	results := Run(ctx, 4, items, func(ctx context.Context, d time.Duration) (time.Duration, error) {
+		// Ignores ctx, like a fetch shared with other callers
+		time.Sleep(d)
+		return d, nil
+	})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected Run to return at the deadline, took %v", elapsed)
+	}
+	if len(results.Values) != 2 || results.Unavailable != 2 {
+		t.Errorf("Expected 2 values and 2 unavailable, got %d and %d", len(results.Values), results.Unavailable)
+	}
+}
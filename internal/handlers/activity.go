@@ -2,16 +2,15 @@ package handlers
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net/http"
 	"sort"
 	"strconv"
 	"time"
 
-	"github.com/skywall34/fantasy-trading/internal/alpaca"
 	"github.com/skywall34/fantasy-trading/internal/cache"
 	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/fanout"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
@@ -58,44 +57,36 @@ func (h *ActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	limit := 20
 	offset := (page - 1) * limit
 
-	// Fetch live activities from Alpaca for all users
-	var activities []database.Activity
-	var usersToFetch []int
+	// Get all public users who haven't opted out of the feed
+	usersToFetch, err := h.db.GetFeedUserIDs()
+	if err != nil {
+		log.Printf("Error getting feed users: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-	switch filter {
-	case "all":
-		// Get all public users
-		publicUsers, err := h.db.GetAllPublicUsers()
-		if err != nil {
-			log.Printf("Error getting public users: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		for _, u := range publicUsers {
-			usersToFetch = append(usersToFetch, u.ID)
-		}
-	case "following":
-		// Get users that current user is following
-		usersToFetch, err = h.db.GetFollowing(userID)
+	if filter == "following" {
+		// Narrow to users that current user is following
+		following, err := h.db.GetFollowing(userID)
 		if err != nil {
 			log.Printf("Error getting following: %v", err)
-			usersToFetch = []int{}
 		}
-	default:
-		// Get all public users
-		publicUsers, err := h.db.GetAllPublicUsers()
-		if err != nil {
-			log.Printf("Error getting public users: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+		followed := make(map[int]bool, len(following))
+		for _, id := range following {
+			followed[id] = true
 		}
-		for _, u := range publicUsers {
-			usersToFetch = append(usersToFetch, u.ID)
+
+		feedUsers := usersToFetch
+		usersToFetch = nil
+		for _, id := range feedUsers {
+			if followed[id] {
+				usersToFetch = append(usersToFetch, id)
+			}
 		}
 	}
 
 	// Fetch activities from Alpaca for each user
-	activities = h.fetchActivitiesForUsers(r.Context(), usersToFetch)
+	activities, unavailable := h.fetchActivitiesForUsers(r.Context(), usersToFetch, offset+limit+1)
 
 	// Apply pagination
 	start := offset
@@ -118,10 +109,20 @@ func (h *ActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	activityIDs := make([]string, 0, len(activities))
+	published := make([]database.PublishedTrade, 0, len(activities))
 	for _, act := range activities {
 		activityIDs = append(activityIDs, act.ID)
+		published = append(published, database.PublishedTrade{ActivityID: act.ID, UserID: act.UserID})
+	}
+
+	// Trades shown in the feed are open for comments and reactions
+	if err := h.db.PublishTrades(published); err != nil {
+		log.Printf("Error publishing trades: %v", err)
 	}
 
+	// Sales are annotated with the gain they realized
+	sales := getRealizedSales(r.Context(), h.db, h.cache, activities, userID)
+
 	commentCounts, _ := h.db.GetCommentCountsForActivities(activityIDs)
 	reactionCountsMap, _ := h.db.GetReactionCountsForActivities(activityIDs)
 	userReactionsMap, _ := h.db.GetUserReactionsForActivities(activityIDs, userID)
@@ -177,6 +178,8 @@ func (h *ActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			userReactions = []string{}
 		}
 
+		sale, realized := sales[act.ID]
+
 		templateActivities = append(templateActivities, templates.ActivityFeedItem{
 			ID:             act.ID,
 			UserID:         act.UserID,
@@ -192,14 +195,21 @@ func (h *ActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			CommentCount:   commentCount,
 			ReactionCounts: reactionCounts,
 			UserReactions:  userReactions,
+			HasRealized:    realized,
+			RealizedPnL:    sale.PnL,
+			RealizedPct:    sale.PnLPercent(),
+			ShowAmounts:    actUser.ShowAmounts || act.UserID == userID,
 		})
 	}
 
+	addFeedItemNames(h.db, templateActivities)
+
 	data := templates.ActivityFeedData{
-		Activities: templateActivities,
-		Filter:     filter,
-		HasMore:    hasMore,
-		Page:       page,
+		Activities:  templateActivities,
+		Filter:      filter,
+		HasMore:     hasMore,
+		Page:        page,
+		Unavailable: unavailable,
 	}
 
 	if r.Header.Get("HX-Request") == "true" {
@@ -222,6 +232,7 @@ func (h *ActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ID:          user.ID,
 		DisplayName: displayName,
 		Initials:    initials,
+		IsAdmin:     user.IsAdmin,
 	}
 
 	if err := templates.Activity(templateUser, data).Render(r.Context(), w); err != nil {
@@ -231,71 +242,35 @@ func (h *ActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// fetchActivitiesForUsers fetches live activities from Alpaca for multiple users
-func (h *ActivityHandler) fetchActivitiesForUsers(ctx context.Context, userIDs []int) []database.Activity {
-	var allActivities []database.Activity
-
-	for _, uid := range userIDs {
-		var alpacaActivities []alpaca.Activity
-
-		// Try to use cache if available
-		if h.cache != nil {
-			cacheKey := fmt.Sprintf("activities:%d", uid)
-
-			// Define refresh function for this user
-			userID := uid // Capture for closure
-			refreshFunc := func(ctx context.Context) (any, error) {
-				session, err := h.db.GetLatestSession(userID)
-				if err != nil {
-					return nil, err
-				}
-
-				apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
-				if err != nil {
-					return nil, err
-				}
-
-				client := alpaca.NewClient(apiKey, apiSecret)
-				return client.GetActivities(ctx)
-			}
-
-			// Get or set with auto-refresh (30s TTL)
-			data, err := h.cache.GetOrSetWithRefresh(cacheKey, 30*time.Second, refreshFunc)
-			if err != nil {
-				log.Printf("Failed to get activities for user %d: %v", uid, err)
-				continue
-			}
-
-			alpacaActivities = data.([]alpaca.Activity)
-		} else {
-			// Fallback to direct API call if cache is not available
-			session, err := h.db.GetLatestSession(uid)
-			if err != nil {
-				log.Printf("No session found for user %d: %v", uid, err)
-				continue
-			}
-
-			apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
-			if err != nil {
-				log.Printf("Failed to decrypt API keys for user %d: %v", uid, err)
-				continue
-			}
-
-			client := alpaca.NewClient(apiKey, apiSecret)
-			alpacaActivities, err = client.GetActivities(ctx)
-			if err != nil {
-				log.Printf("Failed to get activities from Alpaca for user %d: %v", uid, err)
-				continue
-			}
+// fetchActivitiesForUsers fetches live trades from Alpaca for multiple users
+// concurrently, returning the merged trades and how many users couldn't be
+// fetched before the deadline. Each user's trade delay and hidden open entries
+// are applied, so the feed shows what the rest of the team can see. Since the merged feed is sorted by time, no
+// user can contribute more than perUser entries to the requested page, so
+// only that many are fetched each.
+func (h *ActivityHandler) fetchActivitiesForUsers(ctx context.Context, userIDs []int, perUser int) ([]database.Activity, int) {
+	ctx, cancel := context.WithTimeout(ctx, fanoutTimeout)
+	defer cancel()
+
+	results := fanout.Run(ctx, fanoutWorkers, userIDs, func(ctx context.Context, uid int) ([]database.Activity, error) {
+		user, err := h.db.GetUserByID(uid)
+		if err != nil {
+			return nil, err
+		}
+		alpacaActivities, err := getVisibleTradesForUser(ctx, h.db, h.cache, user, perUser)
+		if err != nil {
+			log.Printf("Failed to get activities for user %d: %v", uid, err)
+			return nil, err
 		}
 
 		// Convert to database.Activity format
+		activities := make([]database.Activity, 0, len(alpacaActivities))
 		for _, act := range alpacaActivities {
-			qty, _ := strconv.ParseFloat(act.Qty, 64)
-			price, _ := strconv.ParseFloat(act.Price, 64)
+			qty := act.Qty.Float64()
+			price := act.Price.Float64()
 			transTime, _ := time.Parse(time.RFC3339, act.TransactionTime)
 
-			allActivities = append(allActivities, database.Activity{
+			activities = append(activities, database.Activity{
 				ID:              act.ID,
 				UserID:          uid,
 				ActivityType:    act.ActivityType,
@@ -307,6 +282,15 @@ func (h *ActivityHandler) fetchActivitiesForUsers(ctx context.Context, userIDs [
 				TransactionTime: database.NewNullTime(transTime),
 			})
 		}
+		return activities, nil
+	})
+	if results.Partial() {
+		log.Printf("Activity feed missing %d of %d users", results.Unavailable, len(userIDs))
+	}
+
+	var allActivities []database.Activity
+	for _, activities := range results.Values {
+		allActivities = append(allActivities, activities...)
 	}
 
 	// Sort all activities by transaction time descending
@@ -317,5 +301,5 @@ func (h *ActivityHandler) fetchActivitiesForUsers(ctx context.Context, userIDs [
 		return allActivities[i].TransactionTime.Time.After(allActivities[j].TransactionTime.Time)
 	})
 
-	return allActivities
+	return allActivities, results.Unavailable
 }
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func TestActivityFeedMergesUsersNewestFirst(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	_, sessionID := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill("a-2", "MSFT", "buy", 3, 400, now.Add(-1*time.Hour)),
+			{ID: "a-div", ActivityType: "DIV"},
+			alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-3*time.Hour)),
+		},
+	})
+	env.addUser("PK2", "Bob", &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount("acct-2", 100000, 100000),
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill("b-1", "TSLA", "sell", 2, 250, now.Add(-2*time.Hour)),
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/activity", nil)
+	rec := env.serve(NewActivityHandler(env.db), req, sessionID)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	msft := strings.Index(body, "MSFT")
+	tsla := strings.Index(body, "TSLA")
+	aapl := strings.Index(body, "AAPL")
+	if msft < 0 || tsla < 0 || aapl < 0 {
+		t.Fatalf("Expected trades from both users in the feed")
+	}
+	if !(msft < tsla && tsla < aapl) {
+		t.Errorf("Expected newest first (MSFT, TSLA, AAPL); got positions %d, %d, %d", msft, tsla, aapl)
+	}
+
+	for _, r := range env.fake.Requests() {
+		if r.URL.Path == "/v2/account/activities" && r.URL.Query().Get("activity_types") != alpaca.ActivityTypeFill {
+			t.Errorf("Expected the feed to request only fills, got %q", r.URL.RawQuery)
+		}
+	}
+}
+
+func TestActivityFeedPaginates(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	var fills []alpaca.Activity
+	for i := 0; i < 25; i++ {
+		fills = append(fills, alpacatest.NewFill(fmt.Sprintf("fill-%02d", i), fmt.Sprintf("SYM%02d", i), "buy", 1, 10, now.Add(-time.Duration(i)*time.Minute)))
+	}
+	_, sessionID := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: fills,
+	})
+
+	handler := NewActivityHandler(env.db)
+
+	rec := env.serve(handler, httptest.NewRequest(http.MethodGet, "/activity?page=1", nil), sessionID)
+	body := rec.Body.String()
+	if !strings.Contains(body, "SYM00") || !strings.Contains(body, "SYM19") || strings.Contains(body, "SYM20") {
+		t.Error("Expected page 1 to hold the 20 newest trades")
+	}
+	if !strings.Contains(body, "page=2") {
+		t.Error("Expected a link to page 2")
+	}
+
+	rec = env.serve(handler, httptest.NewRequest(http.MethodGet, "/activity?page=2", nil), sessionID)
+	body = rec.Body.String()
+	if !strings.Contains(body, "SYM20") || !strings.Contains(body, "SYM24") || strings.Contains(body, "SYM19") {
+		t.Error("Expected page 2 to hold the remaining 5 trades")
+	}
+	if strings.Contains(body, "page=3") {
+		t.Error("Expected no link to page 3")
+	}
+}
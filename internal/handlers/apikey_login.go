@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/skywall34/fantasy-trading/internal/alpaca"
 	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
 
@@ -22,7 +23,11 @@ func NewAPIKeyLoginHandler(db *database.DB) *APIKeyLoginHandler {
 
 func (h *APIKeyLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		// Show login page
+		// Show login page, explaining why if the user was sent back here
+		if r.URL.Query().Get("reason") == middleware.LoginReasonRevoked {
+			templates.LoginPageWithError("Alpaca rejected your saved API key. It may have been regenerated or deleted, so please log in again with a current key.").Render(r.Context(), w)
+			return
+		}
 		templates.LoginPage().Render(r.Context(), w)
 		return
 	}
@@ -51,11 +56,9 @@ func (h *APIKeyLoginHandler) handleLogin(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Validate credentials by making a test API call
-	alpacaClient := alpaca.NewClient(apiKey, apiSecret)
+	// Validate credentials against the paper and live APIs to find which account type they belong to
 	ctx := context.Background()
-
-	account, err := alpacaClient.GetAccount(ctx)
+	alpacaClient, account, err := alpaca.Connect(ctx, apiKey, apiSecret)
 	if err != nil {
 		log.Printf("Failed to validate API credentials: %v", err)
 		errorMsg := "Invalid API credentials. Please check your API key and secret."
@@ -77,10 +80,18 @@ func (h *APIKeyLoginHandler) handleLogin(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Derive the starting equity baseline on first login
+	if !user.StartingEquity.Valid {
+		if err := deriveStartingEquity(ctx, h.db, alpacaClient, user.ID); err != nil {
+			log.Printf("Failed to derive starting equity for user %d: %v", user.ID, err)
+			// Don't return error, gains fall back to the default baseline
+		}
+	}
+
 	// Create session
 	sessionID := uuid.New().String()
 	expiresAt := time.Now().Add(24 * time.Hour) // 24 hour session
-	_, err = h.db.CreateSession(sessionID, user.ID, apiKey, apiSecret, expiresAt)
+	_, err = h.db.CreateSession(sessionID, user.ID, apiKey, apiSecret, alpacaClient.IsLive(), expiresAt)
 	if err != nil {
 		log.Printf("Failed to create session: %v", err)
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
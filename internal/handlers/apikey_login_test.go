@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func postLogin(h http.Handler, apiKey, apiSecret string) *httptest.ResponseRecorder {
+	form := url.Values{"api_key": {apiKey}, "api_secret": {apiSecret}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoginCreatesUserAndSession(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.SetFixture("PKTEST", &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount("acct-12345678", 105000, 104000),
+		History: map[string]*alpaca.PortfolioHistory{
+			"": alpacatest.NewHistory(100000, 100000, 102000, 105000),
+		},
+	})
+
+	rec := postLogin(NewAPIKeyLoginHandler(env.db), "PKTEST", "secret")
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/dashboard" {
+		t.Fatalf("Expected redirect to /dashboard, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	var sessionID string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session_id" {
+			sessionID = c.Value
+		}
+	}
+	if sessionID == "" {
+		t.Fatal("Expected a session cookie")
+	}
+
+	session, err := env.db.GetSessionByID(sessionID)
+	if err != nil {
+		t.Fatalf("Session not stored: %v", err)
+	}
+	if session.APIKey != "PKTEST" || session.IsLive {
+		t.Errorf("Unexpected session: key=%s live=%v", session.APIKey, session.IsLive)
+	}
+
+	user, err := env.db.GetUserByID(session.UserID)
+	if err != nil {
+		t.Fatalf("User not stored: %v", err)
+	}
+	if user.AlpacaAccountID != "acct-12345678" {
+		t.Errorf("Expected account ID acct-12345678, got %s", user.AlpacaAccountID)
+	}
+	if !user.StartingEquity.Valid || user.StartingEquity.Float64 != 100000 {
+		t.Errorf("Expected starting equity derived from history, got %v", user.StartingEquity)
+	}
+}
+
+func TestLoginDetectsLiveAccount(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.SetFixture("AKLIVE", &alpacatest.Fixture{
+		Secret:  "secret",
+		Live:    true,
+		Account: alpacatest.NewAccount("live-account-1", 5000, 5000),
+	})
+
+	rec := postLogin(NewAPIKeyLoginHandler(env.db), "AKLIVE", "secret")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect, got %d", rec.Code)
+	}
+
+	user, err := env.db.GetUserByAlpacaID("live-account-1")
+	if err != nil {
+		t.Fatalf("User not stored: %v", err)
+	}
+	session, err := env.db.GetLatestSession(user.ID)
+	if err != nil {
+		t.Fatalf("Session not stored: %v", err)
+	}
+	if !session.IsLive {
+		t.Error("Expected session to be marked live")
+	}
+}
+
+func TestLoginRejectsBadCredentials(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.SetFixture("PKTEST", &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount("acct-12345678", 100000, 100000),
+	})
+
+	rec := postLogin(NewAPIKeyLoginHandler(env.db), "PKTEST", "wrong")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected login page, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Invalid API credentials") {
+		t.Error("Expected an invalid credentials message")
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("Expected no session cookie")
+	}
+}
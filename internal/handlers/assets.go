@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// getAssetNames looks up company names in the local asset catalog, keyed by
+// symbol. Symbols the catalog doesn't know are left out, so callers fall back
+// to the symbol itself.
+func getAssetNames(db *database.DB, symbols []string) map[string]string {
+	seen := make(map[string]bool, len(symbols))
+	unique := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		if !seen[symbol] {
+			seen[symbol] = true
+			unique = append(unique, symbol)
+		}
+	}
+
+	names, err := db.GetAssetNames(unique)
+	if err != nil {
+		log.Printf("Failed to get asset names: %v", err)
+		return map[string]string{}
+	}
+	return names
+}
+
+// addActivityNames fills in the company name of each activity's symbol
+func addActivityNames(db *database.DB, activities []templates.ActivityData) {
+	symbols := make([]string, 0, len(activities))
+	for _, act := range activities {
+		symbols = append(symbols, act.Symbol)
+	}
+	names := getAssetNames(db, symbols)
+	for i := range activities {
+		activities[i].Name = names[activities[i].Symbol]
+	}
+}
+
+// addFeedItemNames fills in the company name of each feed item's symbol
+func addFeedItemNames(db *database.DB, items []templates.ActivityFeedItem) {
+	symbols := make([]string, 0, len(items))
+	for _, item := range items {
+		symbols = append(symbols, item.Symbol)
+	}
+	names := getAssetNames(db, symbols)
+	for i := range items {
+		items[i].Name = names[items[i].Symbol]
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	syncworker "github.com/skywall34/fantasy-trading/internal/sync"
+)
+
+func TestAssetCatalogNamesAndSearch(t *testing.T) {
+	env := newTestEnv(t)
+	fixture := leaderboardFixture("acct-1", false, 100000, 100000)
+	fixture.Positions = []alpaca.Position{alpacatest.NewPosition("AAPL", 10, 180, 190)}
+	_, sessionID := env.addUser("PK1", "Trader", fixture)
+
+	env.fake.SetAssets([]alpaca.Asset{
+		alpacatest.NewAsset("AAPL", "Apple Inc. Common Stock"),
+		alpacatest.NewAsset("AAP", "Advance Auto Parts Inc."),
+		alpacatest.NewAsset("PINE", "Alpine Income Property Trust"),
+	})
+	assetSync := syncworker.NewAssetSync(env.db)
+	if err := assetSync.Refresh(context.Background(), time.Now()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	body := env.serve(NewDashboardHandler(env.db), httptest.NewRequest(http.MethodGet, "/dashboard", nil), sessionID).Body.String()
+	if !strings.Contains(body, "Apple Inc. Common Stock") {
+		t.Error("Expected the position to show its company name")
+	}
+
+	search := func(q string) string {
+		req := httptest.NewRequest(http.MethodGet, "/search?q="+q, nil)
+		req.Header.Set("HX-Request", "true")
+		return env.serve(NewSearchHandler(env.db), req, sessionID).Body.String()
+	}
+
+	// An exact symbol comes before longer symbols and name matches
+	body = search("aap")
+	aap, aapl := strings.Index(body, "Advance Auto Parts"), strings.Index(body, "Apple Inc.")
+	if aap < 0 || aapl < 0 || aap > aapl {
+		t.Error("Expected AAP to be suggested ahead of AAPL")
+	}
+	if !strings.Contains(search("alpine"), "/symbol/PINE") {
+		t.Error("Expected symbols to be found by company name")
+	}
+
+	// Assets dropped from Alpaca's listing keep their names but stop being suggested
+	env.fake.SetAssets([]alpaca.Asset{alpacatest.NewAsset("AAPL", "Apple Inc. Common Stock")})
+	if err := assetSync.Refresh(context.Background(), time.Now()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if strings.Contains(search("alpine"), "/symbol/PINE") {
+		t.Error("Expected a delisted asset to drop out of suggestions")
+	}
+	if asset, err := env.db.GetAsset("PINE"); err != nil || asset.Name != "Alpine Income Property Trust" {
+		t.Errorf("Expected the delisted asset to be kept, got %+v (%v)", asset, err)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/metrics"
+)
+
+// cashFlowsTTL is how long a user's deposits and withdrawals stay cached
+const cashFlowsTTL = 15 * time.Minute
+
+// getCashFlowsForUser returns every deposit, withdrawal and cash journal on a
+// user's account, served from the cache when one is configured
+func getCashFlowsForUser(ctx context.Context, db *database.DB, c *cache.Cache, userID int) ([]metrics.CashFlow, error) {
+	refreshFunc := func(ctx context.Context) (any, error) {
+		client, err := newClientForUser(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		query := alpaca.ActivitiesQuery{
+			ActivityTypes: alpaca.CashFlowActivityTypes,
+			Direction:     alpaca.DirectionAsc,
+		}
+		activities, err := client.ListActivities(ctx, query, 0)
+		if err != nil {
+			return nil, err
+		}
+		return cashFlowsFromActivities(activities), nil
+	}
+
+	if c == nil {
+		data, err := refreshFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return data.([]metrics.CashFlow), nil
+	}
+
+	data, err := c.GetOrSetWithRefresh(fmt.Sprintf("cashflows:%d", userID), cashFlowsTTL, refreshFunc)
+	if err != nil {
+		return nil, err
+	}
+	return data.([]metrics.CashFlow), nil
+}
+
+// cashFlowsFromActivities converts non-trade activities to dated cash flows.
+// Activities without a date fall back to their transaction time.
+func cashFlowsFromActivities(activities []alpaca.Activity) []metrics.CashFlow {
+	flows := make([]metrics.CashFlow, 0, len(activities))
+	for _, act := range activities {
+		date := act.Date
+		if len(date) > len("2006-01-02") {
+			date = date[:len("2006-01-02")]
+		}
+		if date == "" {
+			t, err := time.Parse(time.RFC3339, act.TransactionTime)
+			if err != nil {
+				continue
+			}
+			date = alpaca.MarketDate(t)
+		}
+		if act.NetAmount.Sign() == 0 {
+			continue
+		}
+		flows = append(flows, metrics.CashFlow{Date: date, Amount: act.NetAmount.Float64()})
+	}
+	return flows
+}
+
+// periodReturn is a user's performance over one history window with external
+// cash flows stripped out
+type periodReturn struct {
+	StartingEquity float64
+	Equity         float64  // ending equity
+	NetFlows       float64  // money added inside the window, including resets
+	Gain           float64  // ending equity less the starting equity and net flows
+	GainPercent    float64  // time-weighted return
+	Resets         []string // trading days the account appears to have been reset
+}
+
+// periodGain returns the time-weighted performance of a history window.
+// All-time returns start from the user's starting equity baseline; other
+// windows start from Alpaca's base value.
+func periodGain(history *alpaca.PortfolioHistory, period string, baseline float64, flows []metrics.CashFlow) (periodReturn, bool) {
+	startingEquity, equity, ok := periodEquityRange(history)
+	if !ok {
+		return periodReturn{}, false
+	}
+	startValue := history.BaseValue
+	if period == "all" && baseline > 0 {
+		startingEquity, startValue = baseline, baseline
+	}
+
+	ret, ok := metrics.TimeWeightedReturn(history.Timestamp, history.Equity, startValue, flows, alpaca.MarketLocation)
+	if !ok {
+		return periodReturn{}, false
+	}
+	return periodReturn{
+		StartingEquity: startingEquity,
+		Equity:         equity,
+		NetFlows:       ret.NetFlows,
+		Gain:           equity - startingEquity - ret.NetFlows,
+		GainPercent:    ret.Percent,
+		Resets:         ret.Resets,
+	}, true
+}
+
+// adjustForCashFlows replaces an account's simple total gain with its
+// time-weighted return over the user's whole history, so deposits,
+// withdrawals and resets don't count as gains. The simple gain is kept when
+// the history can't be fetched.
+func adjustForCashFlows(ctx context.Context, db *database.DB, c *cache.Cache, userID int, baseline float64, data *AccountData) {
+	history, err := getPeriodHistory(ctx, db, c, userID, "all")
+	if err != nil {
+		log.Printf("Failed to get portfolio history for user %d: %v", userID, err)
+		return
+	}
+	flows, err := getCashFlowsForUser(ctx, db, c, userID)
+	if err != nil {
+		log.Printf("Failed to get cash flows for user %d: %v", userID, err)
+	}
+
+	ret, ok := periodGain(history, "all", baseline, flows)
+	if !ok {
+		return
+	}
+	data.TotalGain = data.Equity.Sub(alpaca.NewDecimalFromFloat(ret.StartingEquity + ret.NetFlows))
+	data.TotalGainPct = ret.GainPercent
+}
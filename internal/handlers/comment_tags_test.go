@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+func TestCommentMentionsAndCashtags(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	alice, aliceSession := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	})
+	bob, _ := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+	carol, _ := env.addUser("PK3", "Carol", leaderboardFixture("acct-3", false, 100000, 100000))
+	for user, nickname := range map[*database.User]string{alice: "alice", bob: "bobby", carol: "carol_t"} {
+		if err := env.db.UpdateUserNickname(user.ID, sql.NullString{String: nickname, Valid: true}); err != nil {
+			t.Fatalf("Failed to set nickname: %v", err)
+		}
+	}
+
+	env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), aliceSession)
+
+	send := func(handler http.Handler, method, path, content string) *httptest.ResponseRecorder {
+		form := url.Values{"content": {content}}
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return env.serve(handler, req, aliceSession)
+	}
+	mentions := func(userID int) int {
+		notifications, err := env.db.GetNotifications(userID, 10)
+		if err != nil {
+			t.Fatalf("Failed to get notifications: %v", err)
+		}
+		count := 0
+		for _, n := range notifications {
+			if n.Type == database.NotificationMention {
+				count++
+			}
+		}
+		return count
+	}
+
+	rec := send(NewCommentsHandler(env.db), http.MethodPost, "/api/activities/a-1/comments", "@Bobby adding more $AAPL, ask @nobody or mail me@bobby.com for $100.")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected comment to succeed, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{fmt.Sprintf(`href="/user/%d"`, bob.ID), `href="/symbol/AAPL"`, "@nobody", "me@bobby.com"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the comment to render %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `href="/symbol/100"`) || strings.Count(body, fmt.Sprintf(`href="/user/%d"`, bob.ID)) != 1 {
+		t.Errorf("Expected only the real tags to be linked:\n%s", body)
+	}
+	if got := mentions(bob.ID); got != 1 {
+		t.Errorf("Expected Bob to be notified of his mention once, got %d", got)
+	}
+
+	comments, err := env.db.GetCommentsByActivity("a-1")
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("Expected one comment, got %d (%v)", len(comments), err)
+	}
+
+	// Editing swaps Bob's mention for Carol's and only Carol hears about it
+	path := fmt.Sprintf("/api/comments/%d", comments[0].ID)
+	if rec := send(NewCommentActionsHandler(env.db), http.MethodPut, path, "Actually @carol_t called $AAPL first"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected edit to succeed, got %d", rec.Code)
+	}
+	body = send(NewCommentsHandler(env.db), http.MethodGet, "/api/activities/a-1/comments", "").Body.String()
+	if !strings.Contains(body, fmt.Sprintf(`href="/user/%d"`, carol.ID)) || strings.Contains(body, fmt.Sprintf(`href="/user/%d"`, bob.ID)) {
+		t.Errorf("Expected the edit to move the mention link to Carol:\n%s", body)
+	}
+	if mentions(carol.ID) != 1 || mentions(bob.ID) != 1 {
+		t.Errorf("Expected Carol notified once and Bob not again, got %d and %d", mentions(carol.ID), mentions(bob.ID))
+	}
+
+	// Mentioning yourself doesn't notify
+	if rec := send(NewCommentActionsHandler(env.db), http.MethodPut, path, "@carol_t and @Alice"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected edit to succeed, got %d", rec.Code)
+	}
+	if got := mentions(alice.ID); got != 0 {
+		t.Errorf("Expected no notification for a self-mention, got %d", got)
+	}
+	if got := mentions(carol.ID); got != 1 {
+		t.Errorf("Expected Carol's unchanged mention not to notify again, got %d", got)
+	}
+}
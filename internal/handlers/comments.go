@@ -2,23 +2,46 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/live"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
 
+const (
+	// commentThreadsPerPage is how many top-level comments load at a time
+	commentThreadsPerPage = 20
+	// repliesShown is how many of a thread's latest replies show before the
+	// earlier ones are collapsed
+	repliesShown = 3
+	// repliesPerPage is how many collapsed replies load at a time
+	repliesPerPage = 20
+)
+
 type CommentsHandler struct {
-	db *database.DB
+	db     *database.DB
+	hub    *live.Hub
+	filter *WordFilter
 }
 
 func NewCommentsHandler(db *database.DB) *CommentsHandler {
-	return &CommentsHandler{db: db}
+	return &CommentsHandler{db: db, hub: nil}
+}
+
+func (h *CommentsHandler) SetHub(hub *live.Hub) {
+	h.hub = hub
+}
+
+func (h *CommentsHandler) SetWordFilter(filter *WordFilter) {
+	h.filter = filter
 }
 
 func (h *CommentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -48,15 +71,40 @@ func (h *CommentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getComments renders the newest page of an activity's comment threads, or
+// with a before query parameter, the page of earlier threads to load above them
 func (h *CommentsHandler) getComments(w http.ResponseWriter, r *http.Request, activityID string) {
-	comments, err := h.db.GetCommentsByActivity(activityID)
+	before, _ := strconv.Atoi(r.URL.Query().Get("before"))
+	if before <= 0 {
+		h.renderComments(w, r, activityID, 0)
+		return
+	}
+
+	threads, more, err := h.db.GetCommentThreads(activityID, before, 0, commentThreadsPerPage, repliesShown)
 	if err != nil {
 		log.Printf("Error getting comments: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	if err := templates.CommentsList(comments, activityID).Render(r.Context(), w); err != nil {
+	if err := templates.CommentThreads(threads, more, activityID).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering comments: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderComments renders the newest page of an activity's comment threads,
+// reaching back to the thread sinceID when it's set
+func (h *CommentsHandler) renderComments(w http.ResponseWriter, r *http.Request, activityID string, sinceID int) {
+	threads, more, err := h.db.GetCommentThreads(activityID, 0, sinceID, commentThreadsPerPage, repliesShown)
+	if err != nil {
+		log.Printf("Error getting comments: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.CommentsList(threads, more, activityID).Render(r.Context(), w); err != nil {
 		log.Printf("Error rendering comments: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -86,6 +134,14 @@ func (h *CommentsHandler) createComment(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	if rejectFiltered(w, h.db, h.filter, userID, nil, content) {
+		return
+	}
+
+	if !requirePublishedTrade(w, h.db, activityID) {
+		return
+	}
+
 	var parentID *int
 	if parentIDStr := r.FormValue("parent_id"); parentIDStr != "" {
 		if pid, err := strconv.Atoi(parentIDStr); err == nil {
@@ -93,14 +149,22 @@ func (h *CommentsHandler) createComment(w http.ResponseWriter, r *http.Request,
 		}
 	}
 
-	_, err := h.db.CreateComment(activityID, userID, parentID, content)
+	comment, err := h.db.CreateComment(activityID, userID, parentID, content)
 	if err != nil {
 		log.Printf("Error creating comment: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	mentioned := saveCommentTags(h.db, comment)
+	notifyComment(h.db, h.hub, comment, mentioned)
+	publishComment(h.db, h.hub, comment)
 
-	h.getComments(w, r, activityID)
+	// A reply to an older thread keeps that thread on the page
+	sinceID := 0
+	if parentID != nil {
+		sinceID = *parentID
+	}
+	h.renderComments(w, r, activityID, sinceID)
 }
 
 func (h *CommentsHandler) handleReaction(w http.ResponseWriter, r *http.Request, activityID string) {
@@ -143,12 +207,20 @@ func (h *CommentsHandler) handleReaction(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	_, err := h.db.AddReaction(activityID, userID, emoji)
+	if !requirePublishedTrade(w, h.db, activityID) {
+		return
+	}
+
+	added, err := h.db.AddReaction(activityID, userID, emoji)
 	if err != nil {
 		log.Printf("Error toggling reaction: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	if added {
+		notifyReaction(h.db, h.hub, activityID, userID, emoji)
+	}
+	publishReactions(h.hub, activityID)
 
 	reactionCounts, err := h.db.GetReactionCounts(activityID)
 	if err != nil {
@@ -177,13 +249,63 @@ func (h *CommentsHandler) handleReaction(w http.ResponseWriter, r *http.Request,
 	}
 }
 
-// CommentActionsHandler handles update and delete operations on individual comments
+// saveCommentTags records the users and symbols a comment tags, returning
+// the users who are newly mentioned. Nicknames that don't match a user are
+// left as plain text.
+func saveCommentTags(db *database.DB, comment *database.Comment) []int {
+	var nicknames, symbols []string
+	for _, tag := range database.ParseCommentTags(comment.Content) {
+		if tag.Kind == database.CommentTagMention {
+			nicknames = append(nicknames, tag.Value)
+		} else {
+			symbols = append(symbols, tag.Value)
+		}
+	}
+
+	resolved, err := db.ResolveNicknames(nicknames)
+	if err != nil {
+		log.Printf("Failed to resolve mentions in comment %d: %v", comment.ID, err)
+		return nil
+	}
+	mentions := make(map[string]int)
+	for _, nickname := range nicknames {
+		if userID, ok := resolved[strings.ToLower(nickname)]; ok {
+			mentions[nickname] = userID
+		}
+	}
+
+	added, err := db.SetCommentTags(comment.ID, mentions, symbols)
+	if err != nil {
+		log.Printf("Failed to save tags for comment %d: %v", comment.ID, err)
+		return nil
+	}
+	return added
+}
+
+// CommentActionsHandler handles update and delete operations on individual
+// comments by their authors, and reports, collapsed replies and edit history
+// for other users
 type CommentActionsHandler struct {
-	db *database.DB
+	db            *database.DB
+	hub           *live.Hub
+	filter        *WordFilter
+	hideThreshold int // open reports that hide a comment pending review; 0 never hides
 }
 
 func NewCommentActionsHandler(db *database.DB) *CommentActionsHandler {
-	return &CommentActionsHandler{db: db}
+	return &CommentActionsHandler{db: db, hub: nil, hideThreshold: defaultReportHideThreshold}
+}
+
+func (h *CommentActionsHandler) SetHub(hub *live.Hub) {
+	h.hub = hub
+}
+
+func (h *CommentActionsHandler) SetWordFilter(filter *WordFilter) {
+	h.filter = filter
+}
+
+func (h *CommentActionsHandler) SetReportHideThreshold(threshold int) {
+	h.hideThreshold = threshold
 }
 
 func (h *CommentActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -194,7 +316,8 @@ func (h *CommentActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 	}
 
 	path := strings.TrimPrefix(r.URL.Path, "/api/comments/")
-	commentID, err := strconv.Atoi(path)
+	idStr, endpoint, _ := strings.Cut(path, "/")
+	commentID, err := strconv.Atoi(idStr)
 	if err != nil {
 		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
 		return
@@ -206,6 +329,22 @@ func (h *CommentActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	switch endpoint {
+	case "report":
+		h.reportComment(w, r, comment, userID)
+		return
+	case "replies":
+		h.getReplies(w, r, comment)
+		return
+	case "revisions":
+		h.getRevisions(w, r, comment)
+		return
+	}
+	if endpoint != "" {
+		http.NotFound(w, r)
+		return
+	}
+
 	if comment.UserID != userID {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
@@ -222,6 +361,11 @@ func (h *CommentActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 }
 
 func (h *CommentActionsHandler) updateComment(w http.ResponseWriter, r *http.Request, comment *database.Comment) {
+	if comment.Status != database.CommentVisible {
+		http.Error(w, "Comment is under moderation", http.StatusForbidden)
+		return
+	}
+
 	if time.Since(comment.CreatedAt) > 15*time.Minute {
 		http.Error(w, "Edit window expired (15 minutes)", http.StatusForbidden)
 		return
@@ -243,17 +387,31 @@ func (h *CommentActionsHandler) updateComment(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if rejectFiltered(w, h.db, h.filter, comment.UserID, &comment.ID, content) {
+		return
+	}
+
 	if err := h.db.UpdateComment(comment.ID, content); err != nil {
 		log.Printf("Error updating comment: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	// Only users the edit newly mentions are notified
+	comment.Content = content
+	notifyMentions(h.db, h.hub, comment, saveCommentTags(h.db, comment))
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
 }
 
 func (h *CommentActionsHandler) deleteComment(w http.ResponseWriter, r *http.Request, comment *database.Comment) {
+	// Moderated comments stay put so their reports and replies survive review
+	if comment.Status != database.CommentVisible {
+		http.Error(w, "Comment is under moderation", http.StatusForbidden)
+		return
+	}
+
 	if err := h.db.DeleteComment(comment.ID); err != nil {
 		log.Printf("Error deleting comment: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -263,3 +421,101 @@ func (h *CommentActionsHandler) deleteComment(w http.ResponseWriter, r *http.Req
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
+
+// reportComment records a report of another user's comment, hiding the
+// comment pending review once enough reports are open
+func (h *CommentActionsHandler) reportComment(w http.ResponseWriter, r *http.Request, comment *database.Comment, userID int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if comment.UserID == userID {
+		http.Error(w, "You can't report your own comment", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.FormValue("reason")
+	if !slices.Contains(database.ReportReasons, reason) {
+		http.Error(w, "Invalid report reason", http.StatusBadRequest)
+		return
+	}
+	details := truncateRunes(strings.TrimSpace(r.FormValue("details")), reportDetailsLength)
+
+	open, err := h.db.ReportComment(comment.ID, userID, reason, details)
+	if err != nil {
+		log.Printf("Error reporting comment: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if h.hideThreshold > 0 && open >= h.hideThreshold && comment.Status == database.CommentVisible {
+		detail := fmt.Sprintf("%d open reports", open)
+		if err := h.db.ModerateComment(comment.ID, nil, database.ModerationHide, detail); err != nil {
+			log.Printf("Error hiding reported comment %d: %v", comment.ID, err)
+		}
+	}
+
+	if err := templates.CommentReported().Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering report confirmation: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// getReplies renders the replies collapsed above the reply in the before
+// query parameter
+func (h *CommentActionsHandler) getReplies(w http.ResponseWriter, r *http.Request, comment *database.Comment) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	before, err := strconv.Atoi(r.URL.Query().Get("before"))
+	if err != nil {
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+		return
+	}
+
+	replies, earlier, err := h.db.GetReplies(comment.ID, before, repliesPerPage)
+	if err != nil {
+		log.Printf("Error getting replies: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.EarlierReplies(comment.ID, replies, earlier).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering replies: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// getRevisions renders the earlier versions of an edited comment. A
+// moderated comment's history is hidden along with it.
+func (h *CommentActionsHandler) getRevisions(w http.ResponseWriter, r *http.Request, comment *database.Comment) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if comment.Status != database.CommentVisible {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	revisions, err := h.db.GetCommentRevisions(comment.ID)
+	if err != nil {
+		log.Printf("Error getting comment revisions: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.CommentRevisions(revisions).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering comment revisions: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
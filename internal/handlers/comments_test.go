@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+func TestCommentPagesAndCollapsedReplies(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	alice, aliceSession := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	})
+	_, bobSession := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+
+	env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), aliceSession)
+
+	var threadIDs, replyIDs []int
+	for i := 0; i < 25; i++ {
+		comment, err := env.db.CreateComment("a-1", alice.ID, nil, fmt.Sprintf("Comment %02d", i))
+		if err != nil {
+			t.Fatalf("CreateComment: %v", err)
+		}
+		threadIDs = append(threadIDs, comment.ID)
+	}
+	for i := 0; i < 5; i++ {
+		reply, err := env.db.CreateComment("a-1", alice.ID, &threadIDs[0], fmt.Sprintf("Reply %02d", i))
+		if err != nil {
+			t.Fatalf("CreateComment: %v", err)
+		}
+		replyIDs = append(replyIDs, reply.ID)
+	}
+
+	comments := NewCommentsHandler(env.db)
+	actions := NewCommentActionsHandler(env.db)
+	get := func(handler http.Handler, path string) string {
+		rec := env.serve(handler, httptest.NewRequest(http.MethodGet, path, nil), bobSession)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected GET %s to succeed, got %d", path, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	// The newest page holds the latest threads, with the rest behind a button
+	first := get(comments, "/api/activities/a-1/comments")
+	if !strings.Contains(first, "Comment 05") || !strings.Contains(first, "Comment 24") || strings.Contains(first, "Comment 04") {
+		t.Errorf("Expected the 20 newest threads on the first page:\n%s", first)
+	}
+	earlierPath := fmt.Sprintf("/api/activities/a-1/comments?before=%d", threadIDs[5])
+	if !strings.Contains(first, "Show earlier comments") || !strings.Contains(first, earlierPath) {
+		t.Errorf("Expected a button loading the threads before Comment 05:\n%s", first)
+	}
+
+	earlier := get(comments, earlierPath)
+	if !strings.Contains(earlier, "Comment 00") || strings.Contains(earlier, "Comment 05") || strings.Contains(earlier, "Show earlier comments") {
+		t.Errorf("Expected the last page to hold only the oldest threads:\n%s", earlier)
+	}
+
+	// A busy thread shows its latest replies and collapses the rest
+	if strings.Contains(earlier, "Reply 01") || !strings.Contains(earlier, "Reply 02") || !strings.Contains(earlier, "Show 2 earlier replies") {
+		t.Errorf("Expected only the three latest replies shown:\n%s", earlier)
+	}
+	replies := get(actions, fmt.Sprintf("/api/comments/%d/replies?before=%d", threadIDs[0], replyIDs[2]))
+	if !strings.Contains(replies, "Reply 00") || !strings.Contains(replies, "Reply 01") || strings.Contains(replies, "Reply 02") || strings.Contains(replies, "earlier") {
+		t.Errorf("Expected the collapsed replies and nothing more:\n%s", replies)
+	}
+
+	// Replying to an old thread keeps it on the re-rendered page
+	form := url.Values{"content": {"Late reply"}, "parent_id": {fmt.Sprint(threadIDs[0])}}
+	req := httptest.NewRequest(http.MethodPost, "/api/activities/a-1/comments", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := env.serve(comments, req, bobSession)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Comment 00") || !strings.Contains(rec.Body.String(), "Late reply") {
+		t.Errorf("Expected the replied-to thread on the page, got %d:\n%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCommentEditsKeepRevisions(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	_, aliceSession := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	})
+	bob, bobSession := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+
+	env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), aliceSession)
+
+	comment, err := env.db.CreateComment("a-1", bob.ID, nil, "Target 200")
+	if err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+
+	comments := NewCommentsHandler(env.db)
+	actions := NewCommentActionsHandler(env.db)
+	revisionsPath := fmt.Sprintf("/api/comments/%d/revisions", comment.ID)
+
+	if body := env.serve(comments, httptest.NewRequest(http.MethodGet, "/api/activities/a-1/comments", nil), aliceSession).Body.String(); strings.Contains(body, revisionsPath) {
+		t.Errorf("Expected an unedited comment not to be marked edited:\n%s", body)
+	}
+
+	for _, content := range []string{"Target 210", "Target 220"} {
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/comments/%d", comment.ID), strings.NewReader(url.Values{"content": {content}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if rec := env.serve(actions, req, bobSession); rec.Code != http.StatusOK {
+			t.Fatalf("Expected edit to succeed, got %d", rec.Code)
+		}
+	}
+
+	body := env.serve(comments, httptest.NewRequest(http.MethodGet, "/api/activities/a-1/comments", nil), aliceSession).Body.String()
+	if !strings.Contains(body, "Target 220") || strings.Contains(body, "Target 210") || !strings.Contains(body, revisionsPath) {
+		t.Errorf("Expected the latest version marked as edited:\n%s", body)
+	}
+
+	rec := env.serve(actions, httptest.NewRequest(http.MethodGet, revisionsPath, nil), aliceSession)
+	history := rec.Body.String()
+	if rec.Code != http.StatusOK || strings.Index(history, "Target 210") > strings.Index(history, "Target 200") || strings.Contains(history, "Target 220") {
+		t.Errorf("Expected both earlier versions, newest first, got %d:\n%s", rec.Code, history)
+	}
+	if !strings.Contains(history, "Target 200") {
+		t.Errorf("Expected the original version kept:\n%s", history)
+	}
+}
+
+func TestCommentDeletion(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	alice, aliceSession := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	})
+	bob, bobSession := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+
+	env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), aliceSession)
+
+	create := func(parentID *int, content string) int {
+		comment, err := env.db.CreateComment("a-1", bob.ID, parentID, content)
+		if err != nil {
+			t.Fatalf("CreateComment: %v", err)
+		}
+		return comment.ID
+	}
+	actions := NewCommentActionsHandler(env.db)
+	deleteComment := func(commentID int) int {
+		return env.serve(actions, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/comments/%d", commentID), nil), bobSession).Code
+	}
+
+	// A comment held for moderation keeps its reports for the moderators
+	reported := create(nil, "Buy now before it moons")
+	if _, err := env.db.ReportComment(reported, alice.ID, database.ReportSpam, ""); err != nil {
+		t.Fatalf("ReportComment: %v", err)
+	}
+	if err := env.db.ModerateComment(reported, nil, database.ModerationHide, ""); err != nil {
+		t.Fatalf("ModerateComment: %v", err)
+	}
+	if code := deleteComment(reported); code != http.StatusForbidden {
+		t.Errorf("Expected deleting a hidden comment to be refused, got %d", code)
+	}
+	if _, err := env.db.GetCommentByID(reported); err != nil {
+		t.Errorf("Expected the hidden comment to survive: %v", err)
+	}
+
+	// A comment with replies leaves a tombstone so the replies stay threaded
+	parent := create(nil, "Target 200")
+	reply := create(&parent, "Agreed")
+	if code := deleteComment(parent); code != http.StatusOK {
+		t.Fatalf("Expected delete to succeed, got %d", code)
+	}
+	body := env.serve(NewCommentsHandler(env.db), httptest.NewRequest(http.MethodGet, "/api/activities/a-1/comments", nil), aliceSession).Body.String()
+	if strings.Contains(body, "Target 200") || !strings.Contains(body, "[deleted]") || !strings.Contains(body, "Agreed") {
+		t.Errorf("Expected the parent replaced by a tombstone above its reply:\n%s", body)
+	}
+
+	// A comment without replies is removed outright
+	if code := deleteComment(reply); code != http.StatusOK {
+		t.Fatalf("Expected delete to succeed, got %d", code)
+	}
+	if _, err := env.db.GetCommentByID(reply); err == nil {
+		t.Error("Expected the reply to be deleted")
+	}
+}
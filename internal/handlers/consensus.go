@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/fanout"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+const (
+	// consensusTradeDays is the window for the most-bought and most-sold symbols
+	consensusTradeDays = 7
+	// consensusTopSymbols caps each consensus list
+	consensusTopSymbols = 10
+)
+
+// ConsensusHandler serves the platform-wide view of what public traders hold
+// and trade. Building it fans out to every trader, so it is rebuilt on a
+// schedule by Refresh and requests only read the latest result.
+type ConsensusHandler struct {
+	db    *database.DB
+	cache *cache.Cache
+
+	mu     sync.RWMutex
+	latest *templates.ConsensusData
+}
+
+func NewConsensusHandler(db *database.DB) *ConsensusHandler {
+	return &ConsensusHandler{db: db, cache: nil}
+}
+
+func (h *ConsensusHandler) SetCache(c *cache.Cache) {
+	h.cache = c
+}
+
+// consensusTrader is one trader's visible holdings and this week's trades
+type consensusTrader struct {
+	Positions []alpaca.Position
+	Trades    []alpaca.Activity
+}
+
+// symbolTally counts a symbol's trades and distinct traders
+type symbolTally struct {
+	Trades  int
+	Traders int
+}
+
+func (h *ConsensusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.mu.RLock()
+	data := h.latest
+	h.mu.RUnlock()
+
+	if err := templates.ConsensusPage(templateUserFor(user), data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering consensus page: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Refresh rebuilds the consensus from every public trader's cached positions
+// and activities. Only counts and percentages are kept, so no trader's dollar
+// amounts can be read from it whatever their show_amounts setting.
+func (h *ConsensusHandler) Refresh(ctx context.Context) error {
+	users, err := h.db.GetAllPublicUsers()
+	if err != nil {
+		return fmt.Errorf("failed to get public users: %w", err)
+	}
+
+	now := time.Now()
+	since := now.AddDate(0, 0, -consensusTradeDays)
+
+	fetchCtx, cancel := context.WithTimeout(ctx, fanoutTimeout)
+	defer cancel()
+
+	results := fanout.Run(fetchCtx, fanoutWorkers, users, func(ctx context.Context, u database.User) (consensusTrader, error) {
+		if _, err := h.db.GetLatestSession(u.ID); err != nil {
+			return consensusTrader{}, fanout.ErrSkip
+		}
+
+		var trader consensusTrader
+		if !u.HidePositions {
+			positions, err := getOpenPositionsForUser(ctx, h.db, h.cache, u.ID)
+			if err != nil {
+				log.Printf("Failed to get positions for user %d: %v", u.ID, err)
+				return consensusTrader{}, err
+			}
+			if trader.Positions, err = filterVisiblePositions(ctx, h.db, h.cache, &u, positions); err != nil {
+				log.Printf("Failed to filter positions for user %d: %v", u.ID, err)
+			}
+		}
+
+		if !u.HideFromFeed {
+			fills, err := getVisibleTradesForUser(ctx, h.db, h.cache, &u, maxMetricFills)
+			if err != nil {
+				log.Printf("Failed to get activities for user %d: %v", u.ID, err)
+				return consensusTrader{}, err
+			}
+			for _, act := range fills {
+				if filledAt, err := time.Parse(time.RFC3339, act.TransactionTime); err == nil && !filledAt.Before(since) {
+					trader.Trades = append(trader.Trades, act)
+				}
+			}
+		}
+
+		return trader, nil
+	})
+	if results.Partial() {
+		log.Printf("Consensus missing %d of %d users", results.Unavailable, len(users))
+	}
+
+	data := buildConsensus(results.Values)
+	addConsensusNames(h.db, &data)
+	data.Unavailable = results.Unavailable
+	data.UpdatedAt = now.Format("Jan 2, 3:04 PM")
+
+	h.mu.Lock()
+	h.latest = &data
+	h.mu.Unlock()
+
+	return nil
+}
+
+// buildConsensus aggregates traders' holdings and trades into counts and
+// percentages
+func buildConsensus(traders []consensusTrader) templates.ConsensusData {
+	holders := make(map[string]int)
+	weights := make(map[string]float64)
+	values := make(map[string]float64)
+	classValues := make(map[string]float64)
+	bought := make(map[string]*symbolTally)
+	sold := make(map[string]*symbolTally)
+	var platformValue float64
+	holding := 0
+
+	for _, trader := range traders {
+		var portfolioValue float64
+		for _, pos := range trader.Positions {
+			portfolioValue += math.Abs(pos.MarketValue.Float64())
+		}
+		if portfolioValue > 0 {
+			holding++
+		}
+
+		for _, pos := range trader.Positions {
+			value := math.Abs(pos.MarketValue.Float64())
+			holders[pos.Symbol]++
+			values[pos.Symbol] += value
+			classValues[pos.AssetClass] += value
+			platformValue += value
+			if portfolioValue > 0 {
+				weights[pos.Symbol] += value / portfolioValue * 100
+			}
+		}
+
+		tallied := make(map[string]bool)
+		for _, act := range trader.Trades {
+			tallies := bought
+			if act.Side == "sell" {
+				tallies = sold
+			} else if act.Side != "buy" {
+				continue
+			}
+			tally, ok := tallies[act.Symbol]
+			if !ok {
+				tally = &symbolTally{}
+				tallies[act.Symbol] = tally
+			}
+			tally.Trades++
+			if key := act.Side + ":" + act.Symbol; !tallied[key] {
+				tallied[key] = true
+				tally.Traders++
+			}
+		}
+	}
+
+	data := templates.ConsensusData{
+		Traders:   len(traders),
+		Holding:   holding,
+		TradeDays: consensusTradeDays,
+	}
+
+	for symbol, count := range holders {
+		held := templates.ConsensusHoldingData{
+			Symbol:    symbol,
+			Holders:   count,
+			AvgWeight: weights[symbol] / float64(count),
+		}
+		if holding > 0 {
+			held.HolderPct = float64(count) / float64(holding) * 100
+		}
+		if platformValue > 0 {
+			held.PlatformPct = values[symbol] / platformValue * 100
+		}
+		data.MostHeld = append(data.MostHeld, held)
+	}
+	sort.Slice(data.MostHeld, func(i, j int) bool {
+		a, b := data.MostHeld[i], data.MostHeld[j]
+		if a.Holders != b.Holders {
+			return a.Holders > b.Holders
+		}
+		if a.AvgWeight != b.AvgWeight {
+			return a.AvgWeight > b.AvgWeight
+		}
+		return a.Symbol < b.Symbol
+	})
+	if len(data.MostHeld) > consensusTopSymbols {
+		data.MostHeld = data.MostHeld[:consensusTopSymbols]
+	}
+
+	data.MostBought = rankTallies(bought)
+	data.MostSold = rankTallies(sold)
+
+	for class, value := range classValues {
+		if platformValue > 0 {
+			data.AssetClasses = append(data.AssetClasses, templates.AssetClassShareData{
+				AssetClass: class,
+				Percent:    value / platformValue * 100,
+			})
+		}
+	}
+	sort.Slice(data.AssetClasses, func(i, j int) bool {
+		return data.AssetClasses[i].Percent > data.AssetClasses[j].Percent
+	})
+
+	return data
+}
+
+// rankTallies orders symbols by distinct traders, then trades
+func rankTallies(tallies map[string]*symbolTally) []templates.ConsensusTradeData {
+	ranked := make([]templates.ConsensusTradeData, 0, len(tallies))
+	for symbol, tally := range tallies {
+		ranked = append(ranked, templates.ConsensusTradeData{
+			Symbol:  symbol,
+			Trades:  tally.Trades,
+			Traders: tally.Traders,
+		})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Traders != b.Traders {
+			return a.Traders > b.Traders
+		}
+		if a.Trades != b.Trades {
+			return a.Trades > b.Trades
+		}
+		return a.Symbol < b.Symbol
+	})
+	if len(ranked) > consensusTopSymbols {
+		ranked = ranked[:consensusTopSymbols]
+	}
+	return ranked
+}
+
+// addConsensusNames fills in the company names of the consensus symbols
+func addConsensusNames(db *database.DB, data *templates.ConsensusData) {
+	var symbols []string
+	for _, held := range data.MostHeld {
+		symbols = append(symbols, held.Symbol)
+	}
+	for _, trade := range append(append([]templates.ConsensusTradeData(nil), data.MostBought...), data.MostSold...) {
+		symbols = append(symbols, trade.Symbol)
+	}
+
+	names := getAssetNames(db, symbols)
+	for i := range data.MostHeld {
+		data.MostHeld[i].Name = names[data.MostHeld[i].Symbol]
+	}
+	for i := range data.MostBought {
+		data.MostBought[i].Name = names[data.MostBought[i].Symbol]
+	}
+	for i := range data.MostSold {
+		data.MostSold[i].Name = names[data.MostSold[i].Symbol]
+	}
+}
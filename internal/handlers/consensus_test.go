@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func TestConsensusRefreshesOnSchedule(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	crypto := alpacatest.NewPosition("BTCUSD", 1, 2500, 3000)
+	crypto.AssetClass = "crypto"
+	alice := leaderboardFixture("acct-1", false, 100000, 101000)
+	alice.Positions = []alpaca.Position{alpacatest.NewPosition("NVDA", 10, 90, 100), crypto}
+	alice.Activities = []alpaca.Activity{
+		alpacatest.NewFill("a-2", "NVDA", "buy", 5, 100, now.Add(-24*time.Hour)),
+		alpacatest.NewFill("a-1", "TSLA", "buy", 5, 200, now.Add(-30*24*time.Hour)),
+	}
+	_, sessionID := env.addUser("PK1", "Alice", alice)
+
+	bob := leaderboardFixture("acct-2", false, 100000, 99000)
+	bob.Positions = []alpaca.Position{alpacatest.NewPosition("NVDA", 10, 110, 100)}
+	bob.Activities = []alpaca.Activity{
+		alpacatest.NewFill("b-3", "AAPL", "sell", 1, 180, now.Add(-2*time.Hour)),
+		alpacatest.NewFill("b-2", "NVDA", "buy", 5, 100, now.Add(-3*time.Hour)),
+		alpacatest.NewFill("b-1", "NVDA", "buy", 5, 100, now.Add(-4*time.Hour)),
+	}
+	env.addUser("PK2", "Bob", bob)
+
+	handler := NewConsensusHandler(env.db)
+	serve := func() string {
+		return env.serve(handler, httptest.NewRequest(http.MethodGet, "/consensus", nil), sessionID).Body.String()
+	}
+
+	if body := serve(); !strings.Contains(body, "still being computed") {
+		t.Error("Expected the consensus to wait for its first refresh")
+	}
+
+	if err := handler.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	requests := len(env.fake.Requests())
+
+	// NVDA is 25% of Alice's holdings and all of Bob's, and 40% of the platform's
+	body := serve()
+	for _, want := range []string{"2 (100%)", "62.5%", "40.0%", "Crypto", "60.0%", "2 traders · 3 trades", "1 traders · 1 trades"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the consensus to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "TSLA") {
+		t.Error("Expected trades older than a week to be left out")
+	}
+	if strings.Contains(body, "$") {
+		t.Error("Expected the consensus to report no dollar amounts")
+	}
+	if len(env.fake.Requests()) != requests {
+		t.Error("Expected requests to read the last refresh without calling Alpaca")
+	}
+}
@@ -4,21 +4,26 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
 	"github.com/skywall34/fantasy-trading/internal/database"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
 
 type DashboardHandler struct {
-	db *database.DB
+	db    *database.DB
+	cache *cache.Cache
 }
 
 func NewDashboardHandler(db *database.DB) *DashboardHandler {
-	return &DashboardHandler{db: db}
+	return &DashboardHandler{db: db, cache: nil}
+}
+
+func (h *DashboardHandler) SetCache(c *cache.Cache) {
+	h.cache = c
 }
 
 func (h *DashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -50,12 +55,15 @@ func (h *DashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create Alpaca client
-	alpacaClient := alpaca.NewClient(apiKey, apiSecret)
+	alpacaClient := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(middleware.GetIsLive(r.Context())), revokeOnUnauthorized(h.db, userID))
 	ctx := context.Background()
 
 	// Get account info
 	account, err := alpacaClient.GetAccount(ctx)
 	if err != nil {
+		if redirectIfRevoked(w, r, err) {
+			return
+		}
 		log.Printf("Failed to get account: %v", err)
 		http.Error(w, "Failed to get account data", http.StatusInternalServerError)
 		return
@@ -77,13 +85,17 @@ func (h *DashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse account data
-	accountData := parseAccountData(account)
+	accountData := parseAccountData(account, user.Baseline())
+	adjustForCashFlows(ctx, h.db, h.cache, userID, user.Baseline(), &accountData)
 
 	// Convert positions to template data
-	positionData := convertPositionsToTemplateData(positions)
+	positionData := convertPositionsToTemplateData(h.db, positions)
 
 	// Get recent activities from Alpaca
-	alpacaActivities, err := alpacaClient.GetActivities(ctx)
+	alpacaActivities, err := alpacaClient.ListActivities(ctx, alpaca.ActivitiesQuery{
+		ActivityTypes: []string{alpaca.ActivityTypeFill},
+		Direction:     alpaca.DirectionDesc,
+	}, 10)
 	if err != nil {
 		log.Printf("Failed to get activities: %v", err)
 		alpacaActivities = []alpaca.Activity{}
@@ -95,8 +107,8 @@ func (h *DashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if i >= 10 {
 			break
 		}
-		qty, _ := strconv.ParseFloat(act.Qty, 64)
-		price, _ := strconv.ParseFloat(act.Price, 64)
+		qty := act.Qty.Float64()
+		price := act.Price.Float64()
 
 		action := "traded"
 		if act.Side == "buy" {
@@ -124,25 +136,43 @@ func (h *DashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			TimeAgo:  timeAgo,
 		})
 	}
+	addActivityNames(h.db, recentActivity)
 
 	// Create template user
 	templateUser := &templates.User{
 		ID:          user.ID,
 		DisplayName: getDisplayName(user),
 		Initials:    getInitials(user),
+		IsAdmin:     user.IsAdmin,
+	}
+
+	// Get the user's weekly leaderboard rank
+	rank, err := getUserRank(r.Context(), h.db, h.cache, userID, alpacaClient.IsLive(), defaultRankingPeriod)
+	if err != nil {
+		log.Printf("Failed to get rank: %v", err)
+	}
+
+	// Realized P&L from the user's closed trades
+	trades, err := getRealizedTrades(r.Context(), h.db, h.cache, user, userID)
+	if err != nil {
+		log.Printf("Failed to get realized trades: %v", err)
 	}
+	realized := convertRealized(trades, lotMethodFor(user), true, true, time.Now())
 
 	// Create dashboard data
 	data := templates.DashboardData{
-		PortfolioValue: accountData.Equity,
-		TodaysGain:     accountData.TodaysGain,
+		PortfolioValue: accountData.Equity.Float64(),
+		TodaysGain:     accountData.TodaysGain.Float64(),
 		TodaysGainPct:  accountData.TodaysGainPct,
-		TotalGain:      accountData.TotalGain,
+		TotalGain:      accountData.TotalGain.Float64(),
 		TotalGainPct:   accountData.TotalGainPct,
-		BuyingPower:    accountData.BuyingPower,
-		Cash:           accountData.Cash,
+		BuyingPower:    accountData.BuyingPower.Float64(),
+		Cash:           accountData.Cash.Float64(),
 		Positions:      positionData,
 		RecentActivity: recentActivity,
+		IsLive:         alpacaClient.IsLive(),
+		Rank:           rank,
+		Realized:       realized,
 		PortfolioHistory: templates.PortfolioHistoryData{
 			Timestamps: portfolioHistory.Timestamp,
 			Equities:   portfolioHistory.Equity,
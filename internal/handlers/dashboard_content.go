@@ -4,21 +4,27 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
 	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/metrics"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
 
 type DashboardContentHandler struct {
-	db *database.DB
+	db    *database.DB
+	cache *cache.Cache
 }
 
 func NewDashboardContentHandler(db *database.DB) *DashboardContentHandler {
-	return &DashboardContentHandler{db: db}
+	return &DashboardContentHandler{db: db, cache: nil}
+}
+
+func (h *DashboardContentHandler) SetCache(c *cache.Cache) {
+	h.cache = c
 }
 
 func (h *DashboardContentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -42,13 +48,22 @@ func (h *DashboardContentHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Get user for display name and starting equity baseline
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+	}
+
 	// Create Alpaca client
-	alpacaClient := alpaca.NewClient(apiKey, apiSecret)
+	alpacaClient := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(middleware.GetIsLive(r.Context())), revokeOnUnauthorized(h.db, userID))
 	ctx := context.Background()
 
 	// Get account info
 	account, err := alpacaClient.GetAccount(ctx)
 	if err != nil {
+		if redirectIfRevoked(w, r, err) {
+			return
+		}
 		log.Printf("Failed to get account: %v", err)
 		http.Error(w, "Failed to get account data", http.StatusInternalServerError)
 		return
@@ -69,32 +84,34 @@ func (h *DashboardContentHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Parse account data
-	accountData := parseAccountData(account)
+	startingEquity := database.DefaultStartingEquity
+	if user != nil {
+		startingEquity = user.Baseline()
+	}
+	accountData := parseAccountData(account, startingEquity)
+	adjustForCashFlows(ctx, h.db, h.cache, userID, startingEquity, &accountData)
 
 	// Convert positions to template data
-	positionData := convertPositionsToTemplateData(positions)
+	positionData := convertPositionsToTemplateData(h.db, positions)
 
 	// Get recent activities from Alpaca
-	alpacaActivities, err := alpacaClient.GetActivities(ctx)
+	alpacaActivities, err := alpacaClient.ListActivities(ctx, alpaca.ActivitiesQuery{
+		ActivityTypes: []string{alpaca.ActivityTypeFill},
+		Direction:     alpaca.DirectionDesc,
+	}, 10)
 	if err != nil {
 		log.Printf("Failed to get activities: %v", err)
 		alpacaActivities = []alpaca.Activity{}
 	}
 
-	// Get user for display name
-	user, err := h.db.GetUserByID(userID)
-	if err != nil {
-		log.Printf("Failed to get user: %v", err)
-	}
-
 	// Convert activities to template data
 	recentActivity := make([]templates.ActivityData, 0)
 	for i, act := range alpacaActivities {
 		if i >= 10 {
 			break
 		}
-		qty, _ := strconv.ParseFloat(act.Qty, 64)
-		price, _ := strconv.ParseFloat(act.Price, 64)
+		qty := act.Qty.Float64()
+		price := act.Price.Float64()
 
 		action := "traded"
 		if act.Side == "buy" {
@@ -125,18 +142,38 @@ func (h *DashboardContentHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 			TimeAgo:  timeAgo,
 		})
 	}
+	addActivityNames(h.db, recentActivity)
+
+	// Get the user's weekly leaderboard rank
+	rank, err := getUserRank(r.Context(), h.db, h.cache, userID, alpacaClient.IsLive(), defaultRankingPeriod)
+	if err != nil {
+		log.Printf("Failed to get rank: %v", err)
+	}
+
+	// Realized P&L from the user's closed trades
+	realized := templates.RealizedData{Method: string(metrics.LotFIFO)}
+	if user != nil {
+		trades, err := getRealizedTrades(r.Context(), h.db, h.cache, user, userID)
+		if err != nil {
+			log.Printf("Failed to get realized trades: %v", err)
+		}
+		realized = convertRealized(trades, lotMethodFor(user), true, true, time.Now())
+	}
 
 	// Create dashboard data
 	data := templates.DashboardData{
-		PortfolioValue: accountData.Equity,
-		TodaysGain:     accountData.TodaysGain,
+		PortfolioValue: accountData.Equity.Float64(),
+		TodaysGain:     accountData.TodaysGain.Float64(),
 		TodaysGainPct:  accountData.TodaysGainPct,
-		TotalGain:      accountData.TotalGain,
+		TotalGain:      accountData.TotalGain.Float64(),
 		TotalGainPct:   accountData.TotalGainPct,
-		BuyingPower:    accountData.BuyingPower,
-		Cash:           accountData.Cash,
+		BuyingPower:    accountData.BuyingPower.Float64(),
+		Cash:           accountData.Cash.Float64(),
 		Positions:      positionData,
 		RecentActivity: recentActivity,
+		IsLive:         alpacaClient.IsLive(),
+		Rank:           rank,
+		Realized:       realized,
 		PortfolioHistory: templates.PortfolioHistoryData{
 			Timestamps: portfolioHistory.Timestamp,
 			Equities:   portfolioHistory.Equity,
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func TestDashboardRendersAccount(t *testing.T) {
+	env := newTestEnv(t)
+	_, sessionID := env.addUser("PKTEST", "Trader", &alpacatest.Fixture{
+		Secret:    "secret",
+		Account:   alpacatest.NewAccount("acct-1", 110000, 109000),
+		Positions: []alpaca.Position{alpacatest.NewPosition("AAPL", 10, 150, 190)},
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill("fill-1", "NVDA", "buy", 5, 120, time.Now().Add(-time.Hour)),
+		},
+		History: map[string]*alpaca.PortfolioHistory{
+			"": alpacatest.NewHistory(100000, 100000, 110000),
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	rec := env.serve(NewDashboardHandler(env.db), req, sessionID)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{"$110000.00", "AAPL", "NVDA", "PAPER"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected dashboard to contain %q", want)
+		}
+	}
+}
+
+func TestDashboardRequiresLogin(t *testing.T) {
+	env := newTestEnv(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	rec := env.serve(NewDashboardHandler(env.db), req, "")
+
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Location") != "/login" {
+		t.Errorf("Expected redirect to /login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestDashboardReportsAlpacaFailure(t *testing.T) {
+	env := newTestEnv(t)
+	_, sessionID := env.addUser("PKTEST", "Trader", &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount("acct-1", 100000, 100000),
+		Status:  http.StatusInternalServerError,
+		// Skip the client's retry backoff
+		RetryAfter: "0",
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	rec := env.serve(NewDashboardHandler(env.db), req, sessionID)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", rec.Code)
+	}
+}
+
+func TestDashboardSendsRevokedKeyToLogin(t *testing.T) {
+	env := newTestEnv(t)
+	user, sessionID := env.addUser("PKTEST", "Trader", &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount("acct-1", 100000, 100000),
+	})
+
+	// The key is regenerated in Alpaca, so the stored secret is now rejected
+	env.fake.Update("PKTEST", func(f *alpacatest.Fixture) { f.Secret = "regenerated" })
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	rec := env.serve(NewDashboardHandler(env.db), req, sessionID)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login?reason=revoked" {
+		t.Fatalf("Expected redirect to re-login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if _, err := env.db.GetLatestSession(user.ID); err == nil {
+		t.Error("Expected the user's sessions to be revoked")
+	}
+
+	// Later requests, including HTMX ones, are turned away by the middleware
+	req = httptest.NewRequest(http.MethodGet, "/dashboard/content", nil)
+	req.Header.Set("HX-Request", "true")
+	rec = env.serve(NewDashboardContentHandler(env.db), req, sessionID)
+	if rec.Header().Get("HX-Redirect") != "/login?reason=revoked" {
+		t.Errorf("Expected HX-Redirect to re-login, got %d %q", rec.Code, rec.Header().Get("HX-Redirect"))
+	}
+}
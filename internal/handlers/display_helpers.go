@@ -1,6 +1,9 @@
 package handlers
 
-import "github.com/skywall34/fantasy-trading/internal/database"
+import (
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/templates"
+)
 
 // getDisplayName returns the display name for a user in priority order:
 // 1. Nickname (if set)
@@ -28,3 +31,13 @@ func getInitials(user *database.User) string {
 	}
 	return "U"
 }
+
+// templateUserFor builds the layout user for the signed-in user
+func templateUserFor(user *database.User) *templates.User {
+	return &templates.User{
+		ID:          user.ID,
+		DisplayName: getDisplayName(user),
+		Initials:    getInitials(user),
+		IsAdmin:     user.IsAdmin,
+	}
+}
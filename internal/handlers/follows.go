@@ -6,15 +6,21 @@ import (
 	"strconv"
 
 	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/live"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
 )
 
 type FollowHandler struct {
-	db *database.DB
+	db  *database.DB
+	hub *live.Hub
 }
 
 func NewFollowHandler(db *database.DB) *FollowHandler {
-	return &FollowHandler{db: db}
+	return &FollowHandler{db: db, hub: nil}
+}
+
+func (h *FollowHandler) SetHub(hub *live.Hub) {
+	h.hub = hub
 }
 
 // ServeHTTP handles POST /follow/{userID} and DELETE /follow/{userID}
@@ -54,6 +60,11 @@ func (h *FollowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Failed to follow user", http.StatusInternalServerError)
 			return
 		}
+		notify(h.db, h.hub, database.Notification{
+			UserID:  targetUserID,
+			ActorID: currentUserID,
+			Type:    database.NotificationFollow,
+		})
 
 		// Return success with HTMX trigger to refresh follow button
 		w.Header().Set("HX-Trigger", "followChanged")
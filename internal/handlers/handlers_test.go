@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+)
+
+func TestMain(m *testing.M) {
+	// A fixed key keeps InitEncryption from generating one and writing it to .env
+	os.Setenv("ENCRYPTION_KEY", "dGVzdC1lbmNyeXB0aW9uLWtleS0zMi1ieXRlcy1sbmc=")
+	if err := database.InitEncryption(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to init encryption: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// testEnv is a fresh database plus a fake Alpaca server that every client in
+// the handlers talks to
+type testEnv struct {
+	t    *testing.T
+	db   *database.DB
+	fake *alpacatest.Server
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	fake := alpacatest.NewServer()
+	t.Cleanup(fake.Close)
+	t.Cleanup(fake.UseAsDefault())
+
+	return &testEnv{t: t, db: db, fake: fake}
+}
+
+// addUser registers a fake Alpaca account and a logged-in user for it,
+// returning the user and their session ID
+func (e *testEnv) addUser(apiKey, displayName string, fixture *alpacatest.Fixture) (*database.User, string) {
+	e.t.Helper()
+
+	e.fake.SetFixture(apiKey, fixture)
+
+	user, err := e.db.CreateUser(fixture.Account.ID, nil, displayName)
+	if err != nil {
+		e.t.Fatalf("Failed to create user: %v", err)
+	}
+
+	sessionID := uuid.New().String()
+	_, err = e.db.CreateSession(sessionID, user.ID, apiKey, fixture.Secret, fixture.Live, time.Now().Add(time.Hour))
+	if err != nil {
+		e.t.Fatalf("Failed to create session: %v", err)
+	}
+
+	return user, sessionID
+}
+
+// serve runs a request through the auth middleware as the session's user
+func (e *testEnv) serve(handler http.Handler, req *http.Request, sessionID string) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	if sessionID != "" {
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+	}
+
+	rec := httptest.NewRecorder()
+	middleware.AuthMiddleware(e.db)(handler).ServeHTTP(rec, req)
+	return rec
+}
@@ -1,15 +1,28 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strconv"
+	"log"
+	"net/http"
 	"time"
 
 	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
 	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
 
+// Limits for pages that fetch every trader's Alpaca data at once. Fetches run
+// on a bounded worker pool, and whatever hasn't arrived by the deadline is left
+// out of the page (it still lands in the cache for the next view).
+const (
+	fanoutWorkers = 8
+	fanoutTimeout = 5 * time.Second
+)
+
 // formatTimeAgo converts a time to a human-readable relative time string
 func formatTimeAgo(t time.Time) string {
 	duration := time.Since(t)
@@ -94,45 +107,43 @@ func convertActivityToTemplateData(db *database.DB, act database.Activity) (temp
 	}, nil
 }
 
-
-// AccountData holds parsed account information
+// AccountData holds account amounts and the gains derived from them.
+// Amounts stay exact until they are converted for display.
 type AccountData struct {
-	Equity        float64
-	LastEquity    float64
-	Cash          float64
-	BuyingPower   float64
-	TodaysGain    float64
+	Equity        alpaca.Decimal
+	LastEquity    alpaca.Decimal
+	Cash          alpaca.Decimal
+	BuyingPower   alpaca.Decimal
+	TodaysGain    alpaca.Decimal
 	TodaysGainPct float64
-	TotalGain     float64
+	TotalGain     alpaca.Decimal
 	TotalGainPct  float64
 }
 
-// parseAccountData converts raw account data from Alpaca to structured account data with calculations
-func parseAccountData(account *alpaca.Account) AccountData {
-	equity, _ := strconv.ParseFloat(account.Equity, 64)
-	lastEquity, _ := strconv.ParseFloat(account.LastEquity, 64)
-	cash, _ := strconv.ParseFloat(account.Cash, 64)
-	buyingPower, _ := strconv.ParseFloat(account.BuyingPower, 64)
+// parseAccountData derives today's and total gains from an Alpaca account.
+// Total gain is measured against the user's starting equity baseline.
+func parseAccountData(account *alpaca.Account, startingEquity float64) AccountData {
+	baseline := alpaca.NewDecimalFromFloat(startingEquity)
 
 	// Calculate today's gain
-	todaysGain := equity - lastEquity
+	todaysGain := account.Equity.Sub(account.LastEquity)
 	todaysGainPct := 0.0
-	if lastEquity > 0 {
-		todaysGainPct = (todaysGain / lastEquity) * 100
+	if account.LastEquity.Sign() > 0 {
+		todaysGainPct = todaysGain.Div(account.LastEquity).Float64() * 100
 	}
 
-	// For now, use mock data for total gain (we'll calculate this properly later)
-	totalGain := equity - 100000 // Assuming starting value of $100k
+	// Calculate total gain against the starting equity baseline
+	totalGain := account.Equity.Sub(baseline)
 	totalGainPct := 0.0
-	if equity > 0 {
-		totalGainPct = (totalGain / 100000) * 100
+	if baseline.Sign() > 0 {
+		totalGainPct = totalGain.Div(baseline).Float64() * 100
 	}
 
 	return AccountData{
-		Equity:        equity,
-		LastEquity:    lastEquity,
-		Cash:          cash,
-		BuyingPower:   buyingPower,
+		Equity:        account.Equity,
+		LastEquity:    account.LastEquity,
+		Cash:          account.Cash,
+		BuyingPower:   account.BuyingPower,
 		TodaysGain:    todaysGain,
 		TodaysGainPct: todaysGainPct,
 		TotalGain:     totalGain,
@@ -140,26 +151,234 @@ func parseAccountData(account *alpaca.Account) AccountData {
 	}
 }
 
-// convertPositionsToTemplateData converts Alpaca positions to template data
-func convertPositionsToTemplateData(positions []alpaca.Position) []templates.PositionData {
-	positionData := make([]templates.PositionData, 0, len(positions))
+// convertPositionsToTemplateData converts Alpaca positions to template data,
+// naming each from the asset catalog
+func convertPositionsToTemplateData(db *database.DB, positions []alpaca.Position) []templates.PositionData {
+	symbols := make([]string, 0, len(positions))
 	for _, pos := range positions {
-		qty, _ := strconv.ParseFloat(pos.Qty, 64)
-		avgEntryPrice, _ := strconv.ParseFloat(pos.AvgEntryPrice, 64)
-		marketValue, _ := strconv.ParseFloat(pos.MarketValue, 64)
-		unrealizedPL, _ := strconv.ParseFloat(pos.UnrealizedPL, 64)
-		unrealizedPct, _ := strconv.ParseFloat(pos.UnrealizedPLPC, 64)
+		symbols = append(symbols, pos.Symbol)
+	}
+	names := getAssetNames(db, symbols)
 
+	positionData := make([]templates.PositionData, 0, len(positions))
+	for _, pos := range positions {
+		name, ok := names[pos.Symbol]
+		if !ok {
+			name = pos.Symbol
+		}
 		positionData = append(positionData, templates.PositionData{
 			Symbol:        pos.Symbol,
-			Name:          pos.Symbol, // TODO: Get actual company name
+			Name:          name,
 			AssetClass:    pos.AssetClass,
-			Qty:           qty,
-			Price:         avgEntryPrice,
-			MarketValue:   marketValue,
-			UnrealizedPL:  unrealizedPL,
-			UnrealizedPct: unrealizedPct * 100,
+			Qty:           pos.Qty.Float64(),
+			Price:         pos.AvgEntryPrice.Float64(),
+			MarketValue:   pos.MarketValue.Float64(),
+			UnrealizedPL:  pos.UnrealizedPL.Float64(),
+			UnrealizedPct: pos.UnrealizedPLPC.Float64() * 100,
 		})
 	}
 	return positionData
 }
+
+// positionsFromSnapshots rebuilds Alpaca positions from the rows the sync
+// worker captured so they can be shown like live ones
+func positionsFromSnapshots(snapshots []database.PositionSnapshot) []alpaca.Position {
+	positions := make([]alpaca.Position, 0, len(snapshots))
+	for _, snap := range snapshots {
+		// Alpaca's unrealized_plpc is relative to the cost basis
+		plpc := 0.0
+		if costBasis := snap.MarketValue - snap.UnrealizedPL; costBasis != 0 {
+			plpc = snap.UnrealizedPL / costBasis
+		}
+		positions = append(positions, alpaca.Position{
+			Symbol:         snap.Symbol,
+			AssetClass:     snap.AssetClass,
+			Qty:            alpaca.NewDecimalFromFloat(snap.Qty),
+			AvgEntryPrice:  alpaca.NewDecimalFromFloat(snap.AvgEntryPrice),
+			MarketValue:    alpaca.NewDecimalFromFloat(snap.MarketValue),
+			UnrealizedPL:   alpaca.NewDecimalFromFloat(snap.UnrealizedPL),
+			UnrealizedPLPC: alpaca.NewDecimalFromFloat(plpc),
+		})
+	}
+	return positions
+}
+
+// invalidateUserCache drops every cached Alpaca response for a user: their
+// account and positions, the trades behind the activity feed and the
+// histories and cash flows behind the leaderboard
+func invalidateUserCache(c *cache.Cache, userID int) {
+	c.Delete(fmt.Sprintf("account:%d", userID))
+	c.Delete(fmt.Sprintf("positions:%d", userID))
+	c.InvalidatePattern(fmt.Sprintf("activities:%d:", userID))
+	c.InvalidatePattern(fmt.Sprintf("history:%d:", userID))
+	c.Delete(fmt.Sprintf("cashflows:%d", userID))
+}
+
+// newClientForUser builds an Alpaca client from the user's most recent stored session
+func newClientForUser(db *database.DB, userID int) (*alpaca.Client, error) {
+	session, err := db.GetLatestSession(userID)
+	if err != nil {
+		return nil, fmt.Errorf("no session found for user %d: %w", userID, err)
+	}
+
+	apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(session.IsLive), revokeOnUnauthorized(db, userID)), nil
+}
+
+// revokeOnUnauthorized is a client option that revokes the user's stored
+// sessions once Alpaca rejects their API key. Revoked users drop out of
+// background work and are asked to log in again on their next request.
+func revokeOnUnauthorized(db *database.DB, userID int) alpaca.Option {
+	return alpaca.WithOnUnauthorized(func() {
+		if err := db.RevokeSessionsForUser(userID); err != nil {
+			log.Printf("Failed to revoke sessions for user %d: %v", userID, err)
+			return
+		}
+		log.Printf("Alpaca rejected the API key for user %d; sessions revoked", userID)
+	})
+}
+
+// redirectIfRevoked sends the user back to login when the request failed
+// because Alpaca rejected their API key. It reports whether it responded.
+func redirectIfRevoked(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, alpaca.ErrUnauthorized) {
+		return false
+	}
+	middleware.RedirectToLogin(w, r, middleware.LoginReasonRevoked)
+	return true
+}
+
+// getAccountForUser returns a user's Alpaca account, served from the shared
+// account cache when one is configured
+func getAccountForUser(ctx context.Context, db *database.DB, c *cache.Cache, userID int) (*alpaca.Account, error) {
+	refreshFunc := func(ctx context.Context) (any, error) {
+		client, err := newClientForUser(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		return client.GetAccount(ctx)
+	}
+
+	if c == nil {
+		data, err := refreshFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return data.(*alpaca.Account), nil
+	}
+
+	data, err := c.GetOrSetWithRefresh(fmt.Sprintf("account:%d", userID), 60*time.Second, refreshFunc)
+	if err != nil {
+		return nil, err
+	}
+	return data.(*alpaca.Account), nil
+}
+
+// getRecentTradesForUser returns a user's most recent trade fills, newest first,
+// through the cache when one is configured. Entries are keyed by limit so a
+// deeper page of the feed doesn't evict the shallow one.
+func getRecentTradesForUser(ctx context.Context, db *database.DB, c *cache.Cache, userID, limit int) ([]alpaca.Activity, error) {
+	refreshFunc := func(ctx context.Context) (any, error) {
+		client, err := newClientForUser(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		query := alpaca.ActivitiesQuery{
+			ActivityTypes: []string{alpaca.ActivityTypeFill},
+			Direction:     alpaca.DirectionDesc,
+		}
+		return client.ListActivities(ctx, query, limit)
+	}
+
+	if c == nil {
+		data, err := refreshFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return data.([]alpaca.Activity), nil
+	}
+
+	cacheKey := fmt.Sprintf("activities:%d:%d", userID, limit)
+	data, err := c.GetOrSetWithRefresh(cacheKey, 30*time.Second, refreshFunc)
+	if err != nil {
+		return nil, err
+	}
+	return data.([]alpaca.Activity), nil
+}
+
+// getOpenPositionsForUser returns a user's open positions, served from the
+// shared cache when one is configured
+func getOpenPositionsForUser(ctx context.Context, db *database.DB, c *cache.Cache, userID int) ([]alpaca.Position, error) {
+	refreshFunc := func(ctx context.Context) (any, error) {
+		client, err := newClientForUser(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		return client.GetPositions(ctx)
+	}
+
+	if c == nil {
+		data, err := refreshFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return data.([]alpaca.Position), nil
+	}
+
+	data, err := c.GetOrSetWithRefresh(fmt.Sprintf("positions:%d", userID), 60*time.Second, refreshFunc)
+	if err != nil {
+		return nil, err
+	}
+	return data.([]alpaca.Position), nil
+}
+
+// periodEquityRange returns the starting and ending equity of a portfolio history window.
+// The start is Alpaca's base value when present, otherwise the first non-zero equity point.
+// The end is the last non-zero equity point (Alpaca pads future intraday slots with nulls).
+func periodEquityRange(history *alpaca.PortfolioHistory) (float64, float64, bool) {
+	if history == nil {
+		return 0, 0, false
+	}
+
+	start := history.BaseValue
+	end := 0.0
+	for _, equity := range history.Equity {
+		if equity <= 0 {
+			continue
+		}
+		if start <= 0 {
+			start = equity
+		}
+		end = equity
+	}
+
+	if start <= 0 || end <= 0 {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// deriveStartingEquity determines a user's starting equity from their all-time portfolio
+// history, falling back to their first stored snapshot, and saves it as their baseline.
+// The history's start comes from periodEquityRange, so Alpaca's base value is used
+// when it reports one and the first funded equity point otherwise.
+func deriveStartingEquity(ctx context.Context, db *database.DB, client *alpaca.Client, userID int) error {
+	history, err := client.GetPortfolioHistory(ctx, "all", "1D")
+	if err == nil {
+		if startingEquity, _, ok := periodEquityRange(history); ok {
+			return db.SetStartingEquity(userID, startingEquity, database.StartingEquitySourcePortfolioHistory, nil, "")
+		}
+	} else {
+		log.Printf("Failed to get portfolio history for starting equity of user %d: %v", userID, err)
+	}
+
+	snapshot, err := db.GetFirstPortfolioSnapshot(userID)
+	if err != nil {
+		return fmt.Errorf("no portfolio history or snapshot available: %w", err)
+	}
+	return db.SetStartingEquity(userID, snapshot.Equity, database.StartingEquitySourceSnapshot, nil, "")
+}
@@ -1,15 +1,9 @@
 package handlers
 
 import (
-	"context"
-	"fmt"
 	"log"
 	"net/http"
-	"sort"
-	"strconv"
-	"time"
 
-	"github.com/skywall34/fantasy-trading/internal/alpaca"
 	"github.com/skywall34/fantasy-trading/internal/cache"
 	"github.com/skywall34/fantasy-trading/internal/database"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
@@ -44,144 +38,60 @@ func (h *LeaderboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	period := r.URL.Query().Get("period")
-	if period == "" {
-		period = "weekly"
+	if _, ok := leaderboardPeriods[period]; !ok {
+		period = defaultRankingPeriod
 	}
 
-	// Get all public users
-	publicUsers, err := h.db.GetAllPublicUsers()
-	if err != nil {
-		log.Printf("Error getting public users: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	// Live and paper accounts are ranked separately, defaulting to the viewer's own kind
+	mode := r.URL.Query().Get("mode")
+	if mode != "paper" && mode != "live" {
+		mode = accountMode(middleware.GetIsLive(r.Context()))
 	}
 
-	// Fetch live data from Alpaca for each user
-	type userPerformance struct {
-		UserID        int
-		DisplayName   string
-		Nickname      string
-		AvatarURL     string
-		CurrentEquity float64
-		GainAmount    float64
-		GainPercent   float64
-		ShowAmounts   bool
+	sortKey := r.URL.Query().Get("sort")
+	sortBy, ok := leaderboardSorts[sortKey]
+	if !ok {
+		sortKey, sortBy = "gain", leaderboardSorts["gain"]
 	}
 
-	var performances []userPerformance
-	for _, u := range publicUsers {
-		var account *alpaca.Account
-
-		// Try to use cache if available
-		if h.cache != nil {
-			cacheKey := fmt.Sprintf("account:%d", u.ID)
-
-			// Define refresh function for this user
-			userID := u.ID // Capture for closure
-			refreshFunc := func(ctx context.Context) (any, error) {
-				session, err := h.db.GetLatestSession(userID)
-				if err != nil {
-					return nil, err
-				}
-
-				apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
-				if err != nil {
-					return nil, err
-				}
-
-				client := alpaca.NewClient(apiKey, apiSecret)
-				return client.GetAccount(ctx)
-			}
-
-			// Get or set with auto-refresh
-			data, err := h.cache.GetOrSetWithRefresh(cacheKey, 60*time.Second, refreshFunc)
-			if err != nil {
-				log.Printf("Failed to get account for user %d: %v", u.ID, err)
-				continue
-			}
-
-			account = data.(*alpaca.Account)
-		} else {
-			// Fallback to direct API call if cache is not available
-			session, err := h.db.GetLatestSession(u.ID)
-			if err != nil {
-				log.Printf("No session found for user %d: %v", u.ID, err)
-				continue
-			}
-
-			apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
-			if err != nil {
-				log.Printf("Failed to decrypt API keys for user %d: %v", u.ID, err)
-				continue
-			}
-
-			client := alpaca.NewClient(apiKey, apiSecret)
-			account, err = client.GetAccount(r.Context())
-			if err != nil {
-				log.Printf("Failed to get Alpaca account for user %d: %v", u.ID, err)
-				continue
-			}
-		}
-
-		// Parse account data
-		equity, _ := strconv.ParseFloat(account.Equity, 64)
-
-		// Calculate gain based on hardcoded starting equity (same as helpers.go)
-		startingEquity := 100000.0
-		totalGain := equity - startingEquity
-		totalGainPct := 0.0
-		if startingEquity > 0 {
-			totalGainPct = (totalGain / startingEquity) * 100
-		}
-
-		displayName := "Unknown"
-		if u.Nickname.Valid && u.Nickname.String != "" {
-			displayName = u.Nickname.String
-		} else if u.DisplayName.Valid && u.DisplayName.String != "" {
-			displayName = u.DisplayName.String
-		}
-
-		nickname := ""
-		if u.Nickname.Valid {
-			nickname = u.Nickname.String
-		}
+	// Rank every public user who hasn't opted out of the leaderboard
+	standings, err := getStandings(r.Context(), h.db, h.cache, period, mode)
+	if err != nil {
+		log.Printf("Error getting leaderboard standings: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-		avatarURL := ""
-		if u.AvatarURL.Valid {
-			avatarURL = u.AvatarURL.String
-		}
+	// Ranks stay by gain; the chosen metric only reorders the rows
+	traders := append([]rankedTrader(nil), standings.Traders...)
+	addTradingStats(r.Context(), h.db, h.cache, traders, userID)
+	sortTraders(traders, sortBy)
 
-		performances = append(performances, userPerformance{
-			UserID:        u.ID,
-			DisplayName:   displayName,
-			Nickname:      nickname,
-			AvatarURL:     avatarURL,
-			CurrentEquity: equity,
-			GainAmount:    totalGain,
-			GainPercent:   totalGainPct,
-			ShowAmounts:   u.ShowAmounts,
-		})
+	sortOptions := make([]templates.SortOption, 0, len(leaderboardSortOrder))
+	for _, key := range leaderboardSortOrder {
+		sortOptions = append(sortOptions, templates.SortOption{Key: key, Label: leaderboardSorts[key].Label})
 	}
 
-	// Sort by gain percentage descending
-	sort.Slice(performances, func(i, j int) bool {
-		return performances[i].GainPercent > performances[j].GainPercent
-	})
-
 	// Convert to template entries with ranks
-	templateEntries := make([]templates.LeaderboardEntryData, 0, len(performances))
-	for rank, perf := range performances {
+	templateEntries := make([]templates.LeaderboardEntryData, 0, len(traders))
+	for _, trader := range traders {
+		change, hasChange := trader.RankChange()
 		templateEntries = append(templateEntries, templates.LeaderboardEntryData{
-			UserID:        perf.UserID,
-			DisplayName:   perf.DisplayName,
-			Nickname:      perf.Nickname,
-			AvatarURL:     perf.AvatarURL,
-			CurrentEquity: perf.CurrentEquity,
-			GainAmount:    perf.GainAmount,
-			GainPercent:   perf.GainPercent,
-			Rank:          rank + 1,
-			ShowAmounts:   perf.ShowAmounts,
-			IsCurrentUser: perf.UserID == userID,
+			UserID:        trader.UserID,
+			DisplayName:   trader.DisplayName,
+			Nickname:      trader.Nickname,
+			AvatarURL:     trader.AvatarURL,
+			CurrentEquity: trader.CurrentEquity,
+			GainAmount:    trader.GainAmount,
+			GainPercent:   trader.GainPercent,
+			Rank:          trader.Rank,
+			RankChange:    change,
+			HasRankChange: hasChange,
+			DaysAtFirst:   trader.DaysAtFirst,
+			Resets:        trader.Resets,
+			Metrics:       convertMetrics(trader.Risk, trader.Trading),
+			ShowAmounts:   trader.ShowAmounts,
+			IsCurrentUser: trader.UserID == userID,
 		})
 	}
 
@@ -189,6 +99,11 @@ func (h *LeaderboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Entries:       templateEntries,
 		CurrentUserID: userID,
 		Period:        period,
+		Mode:          mode,
+		Sort:          sortKey,
+		SortOptions:   sortOptions,
+		CurrentRank:   standings.rankData(userID),
+		Unavailable:   standings.Unavailable,
 	}
 
 	if r.Header.Get("HX-Request") == "true" {
@@ -211,6 +126,7 @@ func (h *LeaderboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ID:          user.ID,
 		DisplayName: displayName,
 		Initials:    initials,
+		IsAdmin:     user.IsAdmin,
 	}
 
 	if err := templates.Leaderboard(templateUser, data).Render(r.Context(), w); err != nil {
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func leaderboardFixture(accountID string, live bool, equities ...float64) *alpacatest.Fixture {
+	last := equities[len(equities)-1]
+	return &alpacatest.Fixture{
+		Secret:  "secret",
+		Live:    live,
+		Account: alpacatest.NewAccount(accountID, last, last),
+		History: map[string]*alpaca.PortfolioHistory{
+			"": alpacatest.NewHistory(equities[0], equities...),
+		},
+	}
+}
+
+func TestLeaderboardRanksByPeriodReturn(t *testing.T) {
+	env := newTestEnv(t)
+	_, sessionID := env.addUser("PK1", "Steady", leaderboardFixture("acct-1", false, 100000, 101000, 102000))
+	env.addUser("PK2", "Rocket", leaderboardFixture("acct-2", false, 100000, 105000, 110000))
+	env.addUser("PK3", "Sinker", leaderboardFixture("acct-3", false, 100000, 97000, 95000))
+
+	// Render just the section so the viewer's name in the nav doesn't skew positions
+	req := httptest.NewRequest(http.MethodGet, "/leaderboard?period=weekly", nil)
+	req.Header.Set("HX-Request", "true")
+	rec := env.serve(NewLeaderboardHandler(env.db), req, sessionID)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	rocket := strings.Index(body, "Rocket")
+	steady := strings.Index(body, "Steady")
+	sinker := strings.Index(body, "Sinker")
+	if rocket < 0 || steady < 0 || sinker < 0 {
+		t.Fatalf("Expected all three users on the leaderboard")
+	}
+	if !(rocket < steady && steady < sinker) {
+		t.Errorf("Expected order Rocket, Steady, Sinker; got positions %d, %d, %d", rocket, steady, sinker)
+	}
+	for _, want := range []string{"+10.00%", "+2.00%", "-5.00%"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected leaderboard to contain %q", want)
+		}
+	}
+}
+
+func TestLeaderboardSeparatesLiveAndPaper(t *testing.T) {
+	env := newTestEnv(t)
+	_, paperSession := env.addUser("PK1", "PaperTrader", leaderboardFixture("acct-1", false, 100000, 101000))
+	_, liveSession := env.addUser("AK2", "LiveTrader", leaderboardFixture("acct-2", true, 5000, 5500))
+
+	handler := NewLeaderboardHandler(env.db)
+
+	rec := env.serve(handler, httptest.NewRequest(http.MethodGet, "/leaderboard", nil), paperSession)
+	body := rec.Body.String()
+	if !strings.Contains(body, "PaperTrader") || strings.Contains(body, "LiveTrader") {
+		t.Error("Expected the paper leaderboard to only rank paper accounts")
+	}
+
+	rec = env.serve(handler, httptest.NewRequest(http.MethodGet, "/leaderboard", nil), liveSession)
+	body = rec.Body.String()
+	if !strings.Contains(body, "LiveTrader") || strings.Contains(body, "PaperTrader") {
+		t.Error("Expected a live viewer to default to the live leaderboard")
+	}
+
+	rec = env.serve(handler, httptest.NewRequest(http.MethodGet, "/leaderboard?mode=paper", nil), liveSession)
+	if !strings.Contains(rec.Body.String(), "PaperTrader") {
+		t.Error("Expected mode=paper to show paper accounts")
+	}
+}
+
+func TestLeaderboardFlagsUnavailableTraders(t *testing.T) {
+	env := newTestEnv(t)
+	_, sessionID := env.addUser("PK1", "Steady", leaderboardFixture("acct-1", false, 100000, 101000))
+	down := leaderboardFixture("acct-2", false, 100000, 110000)
+	down.Status = http.StatusServiceUnavailable
+	down.RetryAfter = "0"
+	env.addUser("PK2", "Offline", down)
+
+	req := httptest.NewRequest(http.MethodGet, "/leaderboard?period=weekly", nil)
+	req.Header.Set("HX-Request", "true")
+	rec := env.serve(NewLeaderboardHandler(env.db), req, sessionID)
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "Steady") || strings.Contains(body, "Offline") {
+		t.Error("Expected only the reachable trader to be ranked")
+	}
+	if !strings.Contains(body, "Some traders unavailable (1)") {
+		t.Error("Expected the partial results notice")
+	}
+}
+
+func TestRanksAgreeAcrossPages(t *testing.T) {
+	env := newTestEnv(t)
+	// Rocket led at the previous close but Steady has overtaken them today
+	rocket, rocketSession := env.addUser("PK1", "Rocket", leaderboardFixture("acct-1", false, 100000, 110000, 101000))
+	steady, _ := env.addUser("PK2", "Steady", leaderboardFixture("acct-2", false, 100000, 102000, 105000))
+
+	req := httptest.NewRequest(http.MethodGet, "/leaderboard", nil)
+	req.Header.Set("HX-Request", "true")
+	body := env.serve(NewLeaderboardHandler(env.db), req, rocketSession).Body.String()
+	if !(strings.Index(body, "Steady") < strings.Index(body, "Rocket")) {
+		t.Error("Expected Steady to lead the leaderboard")
+	}
+	for _, want := range []string{"▲1", "▼1", "Your Rank: <span class=\"font-bold text-eog-black\">#2</span>", "0th percentile"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected leaderboard to contain %q", want)
+		}
+	}
+
+	body = env.serve(NewUserHandler(env.db), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/user/%d", steady.ID), nil), rocketSession).Body.String()
+	if !strings.Contains(body, "#1</span> of 2") || !strings.Contains(body, "100th percentile") {
+		t.Error("Expected the profile to show Steady's leaderboard rank and percentile")
+	}
+
+	body = env.serve(NewDashboardHandler(env.db), httptest.NewRequest(http.MethodGet, "/dashboard", nil), rocketSession).Body.String()
+	if !strings.Contains(body, "#2</span> of 2") || !strings.Contains(body, "▼1") {
+		t.Errorf("Expected the dashboard to show user %d ranked #2 and down one place", rocket.ID)
+	}
+}
+
+func TestLeaderboardSortsByMetric(t *testing.T) {
+	env := newTestEnv(t)
+	_, sessionID := env.addUser("PK1", "Swinger", leaderboardFixture("acct-1", false, 100000, 120000, 95000, 125000))
+	env.addUser("PK2", "Steady", leaderboardFixture("acct-2", false, 100000, 101000, 102000, 103000))
+
+	order := func(sort string) (int, int) {
+		req := httptest.NewRequest(http.MethodGet, "/leaderboard?period=monthly&sort="+sort, nil)
+		req.Header.Set("HX-Request", "true")
+		body := env.serve(NewLeaderboardHandler(env.db), req, sessionID).Body.String()
+		return strings.Index(body, "Swinger"), strings.Index(body, "Steady")
+	}
+
+	if swinger, steady := order("gain"); !(swinger < steady) {
+		t.Error("Expected the bigger gain to lead by default")
+	}
+	if swinger, steady := order("volatility"); !(steady < swinger) {
+		t.Error("Expected the calmer portfolio to lead when sorting by volatility")
+	}
+	if swinger, steady := order("drawdown"); !(steady < swinger) {
+		t.Error("Expected the portfolio without a drawdown to lead when sorting by drawdown")
+	}
+}
+
+func TestLeaderboardStripsCashFlows(t *testing.T) {
+	env := newTestEnv(t)
+
+	// A 50,000 deposit on the last day shouldn't look like a 51% gain
+	depositor := leaderboardFixture("acct-1", false, 100000, 101000, 151000)
+	lastDay := time.Unix(depositor.History[""].Timestamp[2], 0)
+	depositor.Activities = []alpaca.Activity{alpacatest.NewCashFlow("csd-1", alpaca.ActivityTypeDeposit, 50000, lastDay)}
+	_, sessionID := env.addUser("PK1", "Depositor", depositor)
+
+	// A paper account put back to 100,000 keeps only its trading gain
+	env.addUser("PK2", "Resetter", leaderboardFixture("acct-2", false, 20000, 21000, 100000))
+
+	req := httptest.NewRequest(http.MethodGet, "/leaderboard?period=weekly", nil)
+	req.Header.Set("HX-Request", "true")
+	body := env.serve(NewLeaderboardHandler(env.db), req, sessionID).Body.String()
+
+	if !(strings.Index(body, "Resetter") < strings.Index(body, "Depositor")) {
+		t.Error("Expected Resetter's 5% to rank above Depositor's 1%")
+	}
+	for _, want := range []string{"+1.00%", "+5.00%", "⚠ Reset", "Account reset on " + alpaca.MarketDate(lastDay)} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected leaderboard to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "+51.00%") {
+		t.Error("Expected the deposit to be left out of the gain")
+	}
+}
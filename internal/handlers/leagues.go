@@ -0,0 +1,678 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/metrics"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// LeaguesHandler serves the /leagues route family: listing, creating and joining
+// leagues, roster management and per-league standings
+type LeaguesHandler struct {
+	db    *database.DB
+	cache *cache.Cache
+}
+
+func NewLeaguesHandler(db *database.DB) *LeaguesHandler {
+	return &LeaguesHandler{db: db, cache: nil}
+}
+
+func (h *LeaguesHandler) SetCache(c *cache.Cache) {
+	h.cache = c
+}
+
+// ServeHTTP routes:
+//
+//	GET  /leagues                  list the current user's leagues
+//	POST /leagues                  create a league
+//	POST /leagues/join             join a league by invite code
+//	GET  /leagues/{id}             league standings
+//	POST /leagues/{id}/members     creator adds a member
+//	POST /leagues/{id}/leave       member leaves the league
+func (h *LeaguesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/leagues"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.listLeagues(w, r, userID, "")
+		case http.MethodPost:
+			h.createLeague(w, r, userID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if path == "join" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.joinLeague(w, r, userID)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	leagueID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid league ID", http.StatusBadRequest)
+		return
+	}
+
+	league, err := h.db.GetLeagueByID(leagueID)
+	if err != nil {
+		http.Error(w, "League not found", http.StatusNotFound)
+		return
+	}
+
+	isMember, err := h.db.IsLeagueMember(league.ID, userID)
+	if err != nil {
+		log.Printf("Error checking league membership: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !isMember {
+		http.Error(w, "You are not a member of this league", http.StatusForbidden)
+		return
+	}
+
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.showLeague(w, r, league, userID)
+	case action == "members" && r.Method == http.MethodPost:
+		h.addMember(w, r, league, userID)
+	case action == "leave" && r.Method == http.MethodPost:
+		h.leaveLeague(w, r, league, userID)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func (h *LeaguesHandler) listLeagues(w http.ResponseWriter, r *http.Request, userID int, errorMsg string) {
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	leagues, err := h.db.GetLeaguesForUser(userID)
+	if err != nil {
+		log.Printf("Error getting leagues: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]templates.LeagueSummary, 0, len(leagues))
+	for _, league := range leagues {
+		members, err := h.db.GetLeagueMembers(league.ID)
+		if err != nil {
+			log.Printf("Error getting members for league %d: %v", league.ID, err)
+		}
+
+		summaries = append(summaries, templates.LeagueSummary{
+			ID:          league.ID,
+			Name:        league.Name,
+			Status:      leagueStatus(&league),
+			StartDate:   formatLeagueDate(league.StartAt),
+			EndDate:     formatLeagueDate(league.EndAt.Add(-time.Second)),
+			MemberCount: len(members),
+		})
+	}
+
+	data := templates.LeaguesData{
+		Leagues: summaries,
+		Error:   errorMsg,
+	}
+
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	if err := templates.Leagues(templateUserFor(user), data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering leagues: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *LeaguesHandler) createLeague(w http.ResponseWriter, r *http.Request, userID int) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	description := strings.TrimSpace(r.FormValue("description"))
+	rules := strings.TrimSpace(r.FormValue("rules"))
+
+	if name == "" || len(name) > 100 {
+		h.listLeagues(w, r, userID, "League name is required (max 100 characters)")
+		return
+	}
+	if len(description) > 500 || len(rules) > 1000 {
+		h.listLeagues(w, r, userID, "Description or rules are too long")
+		return
+	}
+
+	startAt, err := time.ParseInLocation("2006-01-02", r.FormValue("start_date"), time.Local)
+	if err != nil {
+		h.listLeagues(w, r, userID, "Invalid start date")
+		return
+	}
+
+	// End dates are inclusive, so the league runs until the end of that day
+	endDate, err := time.ParseInLocation("2006-01-02", r.FormValue("end_date"), time.Local)
+	if err != nil {
+		h.listLeagues(w, r, userID, "Invalid end date")
+		return
+	}
+	endAt := endDate.AddDate(0, 0, 1)
+
+	if !endAt.After(startAt) {
+		h.listLeagues(w, r, userID, "End date must be on or after the start date")
+		return
+	}
+
+	league, err := h.db.CreateLeague(userID, name, description, rules, startAt, endAt)
+	if err != nil {
+		log.Printf("Error creating league: %v", err)
+		http.Error(w, "Failed to create league", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/leagues/%d", league.ID), http.StatusSeeOther)
+}
+
+func (h *LeaguesHandler) joinLeague(w http.ResponseWriter, r *http.Request, userID int) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	league, err := h.db.GetLeagueByInviteCode(r.FormValue("invite_code"))
+	if err != nil {
+		h.listLeagues(w, r, userID, "No league found for that invite code")
+		return
+	}
+
+	if league.HasEnded() {
+		h.listLeagues(w, r, userID, "That league has already ended")
+		return
+	}
+
+	if err := h.db.AddLeagueMember(league.ID, userID); err != nil {
+		log.Printf("Error joining league: %v", err)
+		http.Error(w, "Failed to join league", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/leagues/%d", league.ID), http.StatusSeeOther)
+}
+
+func (h *LeaguesHandler) addMember(w http.ResponseWriter, r *http.Request, league *database.League, userID int) {
+	if league.CreatorID != userID {
+		http.Error(w, "Only the league creator can invite members", http.StatusForbidden)
+		return
+	}
+	if league.HasEnded() {
+		http.Error(w, "League has ended", http.StatusBadRequest)
+		return
+	}
+
+	memberID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.db.GetUserByID(memberID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	// Private users can only join by themselves, since standings show every
+	// member's returns to the rest of the league
+	if !member.IsPublic {
+		http.Error(w, "Profile is private", http.StatusForbidden)
+		return
+	}
+
+	if err := h.db.AddLeagueMember(league.ID, memberID); err != nil {
+		log.Printf("Error adding league member: %v", err)
+		http.Error(w, "Failed to add member", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/leagues/%d", league.ID), http.StatusSeeOther)
+}
+
+func (h *LeaguesHandler) leaveLeague(w http.ResponseWriter, r *http.Request, league *database.League, userID int) {
+	if league.CreatorID == userID {
+		http.Error(w, "The league creator cannot leave", http.StatusBadRequest)
+		return
+	}
+	if league.HasEnded() {
+		http.Error(w, "League has ended", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.RemoveLeagueMember(league.ID, userID); err != nil {
+		log.Printf("Error leaving league: %v", err)
+		http.Error(w, "Failed to leave league", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/leagues", http.StatusSeeOther)
+}
+
+func (h *LeaguesHandler) showLeague(w http.ResponseWriter, r *http.Request, league *database.League, userID int) {
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	members, err := h.db.GetLeagueMembers(league.ID)
+	if err != nil {
+		log.Printf("Error getting league members: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Freeze final standings the first time an ended league is viewed
+	if league.HasEnded() && !league.FinalizedAt.Valid {
+		if err := h.finalizeLeague(r.Context(), league, members); err != nil {
+			log.Printf("League %d not finalized yet: %v", league.ID, err)
+		} else {
+			league.FinalizedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+
+	var results []leagueResult
+	if league.FinalizedAt.Valid {
+		results, err = h.finalResults(league.ID)
+		if err != nil {
+			log.Printf("Error getting league standings: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		results = h.liveResults(r.Context(), league, members)
+	}
+
+	standings := make([]templates.LeagueStandingData, 0, len(results))
+	unavailable := 0
+	for _, result := range results {
+		member, err := h.db.GetUserByID(result.UserID)
+		if err != nil {
+			continue
+		}
+		if league.HasStarted() && !result.HasResult {
+			unavailable++
+		}
+
+		// Leagues may mix paper and live accounts, so badge each member
+		isLive := false
+		if session, err := h.db.GetLatestSession(result.UserID); err == nil {
+			isLive = session.IsLive
+		}
+
+		standings = append(standings, templates.LeagueStandingData{
+			UserID:        result.UserID,
+			DisplayName:   getDisplayName(member),
+			Rank:          result.Rank,
+			StartEquity:   result.StartEquity,
+			CurrentEquity: result.EndEquity,
+			GainPercent:   result.GainPercent,
+			Resets:        result.Resets,
+			HasResult:     result.HasResult,
+			ShowAmounts:   member.ShowAmounts || member.ID == userID,
+			IsCurrentUser: member.ID == userID,
+			IsLive:        isLive,
+		})
+	}
+
+	var invitable []templates.LeagueInviteOption
+	if league.CreatorID == userID && !league.HasEnded() {
+		invitable = h.invitableUsers(members)
+	}
+
+	data := templates.LeagueDetailData{
+		ID:            league.ID,
+		Name:          league.Name,
+		Description:   league.Description.String,
+		Rules:         league.Rules.String,
+		Status:        leagueStatus(league),
+		StartDate:     formatLeagueDate(league.StartAt),
+		EndDate:       formatLeagueDate(league.EndAt.Add(-time.Second)),
+		InviteCode:    league.InviteCode,
+		IsCreator:     league.CreatorID == userID,
+		IsFinal:       league.FinalizedAt.Valid,
+		Standings:     standings,
+		Unavailable:   unavailable,
+		Invitable:     invitable,
+		CurrentUserID: userID,
+	}
+
+	if err := templates.LeagueDetail(templateUserFor(user), data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering league: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// leagueResult is a member's return over a league window
+type leagueResult struct {
+	UserID      int
+	Rank        int
+	StartEquity float64
+	EndEquity   float64
+	GainPercent float64
+	Resets      []string // trading days in the window the account appears to have been reset
+	HasResult   bool
+}
+
+// liveResults ranks members by return since the league start using current equity.
+// Members whose data can't be fetched are listed unranked at the bottom.
+func (h *LeaguesHandler) liveResults(ctx context.Context, league *database.League, members []database.LeagueMember) []leagueResult {
+	results := make([]leagueResult, 0, len(members))
+	for _, member := range members {
+		result := leagueResult{UserID: member.UserID}
+
+		if league.HasStarted() {
+			startEquity, err := h.memberStartEquity(ctx, league, member)
+			if err != nil {
+				log.Printf("Failed to get league start equity for user %d: %v", member.UserID, err)
+			} else if account, err := getAccountForUser(ctx, h.db, h.cache, member.UserID); err != nil {
+				log.Printf("Failed to get account for user %d: %v", member.UserID, err)
+			} else {
+				equity := account.Equity.Float64()
+				result.StartEquity = startEquity
+				result.EndEquity = equity
+				result.GainPercent = (equity - startEquity) / startEquity * 100
+				result.HasResult = true
+
+				// Prefer the time-weighted return so deposits and resets
+				// during the league don't count as gains
+				if history, err := h.leagueHistory(ctx, league, member.UserID); err != nil {
+					log.Printf("Failed to get league history for user %d: %v", member.UserID, err)
+				} else if ret, ok := h.memberReturn(ctx, member.UserID, history, startEquity); ok {
+					result.GainPercent = ret.Percent
+					result.Resets = ret.Resets
+				}
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	rankLeagueResults(results)
+	return results
+}
+
+// finalResults loads a finalized league's frozen standings
+func (h *LeaguesHandler) finalResults(leagueID int) ([]leagueResult, error) {
+	standings, err := h.db.GetLeagueStandings(leagueID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]leagueResult, 0, len(standings))
+	for _, standing := range standings {
+		results = append(results, leagueResult{
+			UserID:      standing.UserID,
+			Rank:        standing.Rank,
+			StartEquity: standing.StartEquity,
+			EndEquity:   standing.EndEquity,
+			GainPercent: standing.GainPercent,
+			Resets:      standing.Resets,
+			HasResult:   standing.Rank > 0,
+		})
+	}
+	return results, nil
+}
+
+// finalizeLeague computes every member's return over the full league window from
+// portfolio history and freezes it. It fails without writing anything if a
+// member's history is temporarily unavailable, so the league can be finalized on
+// a later view.
+func (h *LeaguesHandler) finalizeLeague(ctx context.Context, league *database.League, members []database.LeagueMember) error {
+	results := make([]leagueResult, 0, len(members))
+	for _, member := range members {
+		result, err := h.finalMemberResult(ctx, league, member)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	rankLeagueResults(results)
+
+	standings := make([]database.LeagueStanding, 0, len(results))
+	for _, result := range results {
+		standings = append(standings, database.LeagueStanding{
+			LeagueID:    league.ID,
+			UserID:      result.UserID,
+			Rank:        result.Rank,
+			StartEquity: result.StartEquity,
+			EndEquity:   result.EndEquity,
+			GainPercent: result.GainPercent,
+			Resets:      result.Resets,
+		})
+	}
+
+	return h.db.FinalizeLeague(league.ID, standings)
+}
+
+// finalMemberResult computes a member's return over the full league window.
+// Members who can no longer be fetched, because they logged out or their key
+// was revoked, are frozen from their last synced snapshot instead.
+func (h *LeaguesHandler) finalMemberResult(ctx context.Context, league *database.League, member database.LeagueMember) (leagueResult, error) {
+	client, err := newClientForUser(h.db, member.UserID)
+	if err != nil {
+		log.Printf("Finalizing league %d from stored data for user %d: %v", league.ID, member.UserID, err)
+		return h.snapshotResult(league, member), nil
+	}
+
+	history, err := client.GetPortfolioHistoryRange(ctx, league.StartAt, league.EndAt, "1D")
+	if errors.Is(err, alpaca.ErrUnauthorized) {
+		return h.snapshotResult(league, member), nil
+	}
+	if err != nil {
+		return leagueResult{}, fmt.Errorf("failed to get league history for user %d: %w", member.UserID, err)
+	}
+
+	startEquity, endEquity, ok := periodEquityRange(history)
+	if !ok {
+		return leagueResult{}, fmt.Errorf("no equity history for user %d during league", member.UserID)
+	}
+	if member.StartEquity.Valid {
+		startEquity = member.StartEquity.Float64
+	}
+
+	result := leagueResult{
+		UserID:      member.UserID,
+		StartEquity: startEquity,
+		EndEquity:   endEquity,
+		GainPercent: (endEquity - startEquity) / startEquity * 100,
+		HasResult:   true,
+	}
+	if ret, ok := h.memberReturn(ctx, member.UserID, history, startEquity); ok {
+		result.GainPercent = ret.Percent
+		result.Resets = ret.Resets
+	}
+	return result, nil
+}
+
+// snapshotResult computes a member's return from their stored league start
+// equity and the last portfolio snapshot synced during the league. Without
+// both the member is left unranked.
+func (h *LeaguesHandler) snapshotResult(league *database.League, member database.LeagueMember) leagueResult {
+	result := leagueResult{UserID: member.UserID}
+	if !member.StartEquity.Valid {
+		return result
+	}
+
+	snapshot, err := h.db.GetPortfolioSnapshotBefore(member.UserID, league.EndAt)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to get portfolio snapshot for user %d: %v", member.UserID, err)
+		}
+		return result
+	}
+	if snapshot.TakenAt.Before(league.StartAt) || snapshot.Equity <= 0 {
+		return result
+	}
+
+	startEquity := member.StartEquity.Float64
+	result.StartEquity = startEquity
+	result.EndEquity = snapshot.Equity
+	result.GainPercent = (snapshot.Equity - startEquity) / startEquity * 100
+	result.HasResult = true
+	return result
+}
+
+// memberStartEquity returns a member's equity at the league start, reading it from
+// portfolio history the first time and storing it on the roster afterwards
+func (h *LeaguesHandler) memberStartEquity(ctx context.Context, league *database.League, member database.LeagueMember) (float64, error) {
+	if member.StartEquity.Valid {
+		return member.StartEquity.Float64, nil
+	}
+
+	history, err := h.leagueHistory(ctx, league, member.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	startEquity, _, ok := periodEquityRange(history)
+	if !ok {
+		return 0, errors.New("no equity history since league start")
+	}
+
+	if err := h.db.SetLeagueMemberStartEquity(league.ID, member.UserID, startEquity); err != nil {
+		log.Printf("Failed to store league start equity for user %d: %v", member.UserID, err)
+	}
+	return startEquity, nil
+}
+
+// leagueHistory returns a member's daily portfolio history since the league
+// start, served from the cache when one is configured
+func (h *LeaguesHandler) leagueHistory(ctx context.Context, league *database.League, userID int) (*alpaca.PortfolioHistory, error) {
+	refreshFunc := func(ctx context.Context) (any, error) {
+		client, err := newClientForUser(h.db, userID)
+		if err != nil {
+			return nil, err
+		}
+		return client.GetPortfolioHistoryRange(ctx, league.StartAt, time.Time{}, "1D")
+	}
+
+	if h.cache == nil {
+		data, err := refreshFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return data.(*alpaca.PortfolioHistory), nil
+	}
+
+	cacheKey := fmt.Sprintf("history:%d:league:%d", userID, league.ID)
+	data, err := h.cache.GetOrSetWithRefresh(cacheKey, 15*time.Minute, refreshFunc)
+	if err != nil {
+		return nil, err
+	}
+	return data.(*alpaca.PortfolioHistory), nil
+}
+
+// memberReturn is a member's time-weighted return over a league window's
+// history, with deposits, withdrawals and resets stripped out
+func (h *LeaguesHandler) memberReturn(ctx context.Context, userID int, history *alpaca.PortfolioHistory, startEquity float64) (metrics.Return, bool) {
+	flows, err := getCashFlowsForUser(ctx, h.db, h.cache, userID)
+	if err != nil {
+		log.Printf("Failed to get cash flows for user %d: %v", userID, err)
+	}
+	return metrics.TimeWeightedReturn(history.Timestamp, history.Equity, startEquity, flows, alpaca.MarketLocation)
+}
+
+// invitableUsers lists public users not already on the roster
+func (h *LeaguesHandler) invitableUsers(members []database.LeagueMember) []templates.LeagueInviteOption {
+	onRoster := make(map[int]bool, len(members))
+	for _, member := range members {
+		onRoster[member.UserID] = true
+	}
+
+	users, err := h.db.GetAllPublicUsers()
+	if err != nil {
+		log.Printf("Error getting public users: %v", err)
+		return nil
+	}
+
+	options := make([]templates.LeagueInviteOption, 0, len(users))
+	for i := range users {
+		if onRoster[users[i].ID] {
+			continue
+		}
+		options = append(options, templates.LeagueInviteOption{
+			UserID:      users[i].ID,
+			DisplayName: getDisplayName(&users[i]),
+		})
+	}
+	return options
+}
+
+// rankLeagueResults sorts results by gain descending and assigns ranks.
+// Members without a result sort last and stay unranked.
+func rankLeagueResults(results []leagueResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].HasResult != results[j].HasResult {
+			return results[i].HasResult
+		}
+		return results[i].GainPercent > results[j].GainPercent
+	})
+
+	for i := range results {
+		if results[i].HasResult {
+			results[i].Rank = i + 1
+		}
+	}
+}
+
+// leagueStatus describes where a league is in its lifecycle
+func leagueStatus(league *database.League) string {
+	if !league.HasStarted() {
+		return "upcoming"
+	}
+	if league.HasEnded() {
+		return "ended"
+	}
+	return "active"
+}
+
+func formatLeagueDate(t time.Time) string {
+	return t.Local().Format("Jan 2, 2006")
+}
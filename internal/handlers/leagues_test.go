@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+func TestEndedLeagueFinalizesWithoutMembersSessions(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	alice, aliceSession := env.addUser("PK1", "Alice", leaderboardFixture("acct-1", false, 100000, 110000))
+	bob, bobSession := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+	carol, carolSession := env.addUser("PK3", "Carol", leaderboardFixture("acct-3", false, 100000, 100000))
+
+	// The league ended long enough ago that its snapshots have been pruned
+	endDay := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -20)
+	league, err := env.db.CreateLeague(alice.ID, "Weekly", "", "", endDay.AddDate(0, 0, -7), endDay.Add(23*time.Hour))
+	if err != nil {
+		t.Fatalf("CreateLeague: %v", err)
+	}
+	for _, userID := range []int{bob.ID, carol.ID} {
+		if err := env.db.AddLeagueMember(league.ID, userID); err != nil {
+			t.Fatalf("AddLeagueMember: %v", err)
+		}
+		if err := env.db.SetLeagueMemberStartEquity(league.ID, userID, 100000); err != nil {
+			t.Fatalf("SetLeagueMemberStartEquity: %v", err)
+		}
+	}
+
+	// Bob was synced through the league's last day before logging out; Carol never was
+	for _, snap := range []struct {
+		equity  float64
+		takenAt time.Time
+	}{
+		{100000, endDay.AddDate(0, 0, -6).Add(10 * time.Hour)},
+		{101000, endDay.AddDate(0, 0, -6).Add(14 * time.Hour)},
+		{103000, endDay.Add(9 * time.Hour)},
+		{104000, endDay.Add(15 * time.Hour)},
+		{105000, endDay.Add(20 * time.Hour)},
+	} {
+		snapshot, err := env.db.CreatePortfolioSnapshot(database.PortfolioSnapshot{UserID: bob.ID, Equity: snap.equity, LastEquity: 100000, Cash: 5000}, nil)
+		if err != nil {
+			t.Fatalf("CreatePortfolioSnapshot: %v", err)
+		}
+		takenAt := snap.takenAt.Format("2006-01-02 15:04:05")
+		if _, err := env.db.Exec(`UPDATE portfolio_snapshots SET taken_at = ? WHERE id = ?`, takenAt, snapshot.ID); err != nil {
+			t.Fatalf("Failed to backdate snapshot: %v", err)
+		}
+	}
+	if pruned, err := env.db.PrunePortfolioSnapshots(now.AddDate(0, 0, -7)); err != nil || pruned != 2 {
+		t.Fatalf("Expected the day's earlier snapshots pruned, got %d (%v)", pruned, err)
+	}
+	if first, err := env.db.GetFirstPortfolioSnapshot(bob.ID); err != nil || first.Equity != 100000 {
+		t.Fatalf("Expected Bob's oldest snapshot to survive pruning, got %+v (%v)", first, err)
+	}
+	for _, sessionID := range []string{bobSession, carolSession} {
+		if err := env.db.DeleteSession(sessionID); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+	}
+
+	rec := env.serve(NewLeaguesHandler(env.db), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/leagues/%d", league.ID), nil), aliceSession)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "+5.00%") || !strings.Contains(body, "1 member(s) could not be ranked.") {
+		t.Errorf("Expected Bob ranked from his snapshot and Carol unranked:\n%s", body)
+	}
+
+	finalized, err := env.db.GetLeagueByID(league.ID)
+	if err != nil || !finalized.FinalizedAt.Valid {
+		t.Fatalf("Expected the league to be finalized (%v)", err)
+	}
+
+	standings, err := env.db.GetLeagueStandings(league.ID)
+	if err != nil || len(standings) != 3 {
+		t.Fatalf("Expected three frozen standings, got %d (%v)", len(standings), err)
+	}
+	want := []struct{ userID, rank int }{{alice.ID, 1}, {bob.ID, 2}, {carol.ID, 0}}
+	for i, w := range want {
+		if standings[i].UserID != w.userID || standings[i].Rank != w.rank {
+			t.Errorf("Expected user %d at rank %d in position %d, got %+v", w.userID, w.rank, i, standings[i])
+		}
+	}
+	if standings[1].EndEquity != 105000 {
+		t.Errorf("Expected Bob's end equity from his last snapshot, got %v", standings[1].EndEquity)
+	}
+}
+
+func TestLeagueCreatorCannotAddPrivateUsers(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	alice, aliceSession := env.addUser("PK1", "Alice", leaderboardFixture("acct-1", false, 100000))
+	private, _ := env.addUser("PK2", "Private", leaderboardFixture("acct-2", false, 100000))
+	if err := env.db.UpdatePrivacySettings(private.ID, database.PrivacySettings{IsPublic: false}); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+	public, _ := env.addUser("PK3", "Public", leaderboardFixture("acct-3", false, 100000))
+	if err := env.db.UpdatePrivacySettings(public.ID, database.PrivacySettings{IsPublic: true}); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+
+	league, err := env.db.CreateLeague(alice.ID, "Weekly", "", "", now.Add(time.Hour), now.Add(72*time.Hour))
+	if err != nil {
+		t.Fatalf("CreateLeague: %v", err)
+	}
+
+	addMember := func(userID int) int {
+		form := url.Values{"user_id": {strconv.Itoa(userID)}}
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/leagues/%d/members", league.ID), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return env.serve(NewLeaguesHandler(env.db), req, aliceSession).Code
+	}
+
+	if code := addMember(private.ID); code != http.StatusForbidden {
+		t.Errorf("Expected 403 adding a private user, got %d", code)
+	}
+	if code := addMember(public.ID); code != http.StatusSeeOther {
+		t.Errorf("Expected a redirect adding a public user, got %d", code)
+	}
+
+	if joined, err := env.db.IsLeagueMember(league.ID, private.ID); err != nil || joined {
+		t.Errorf("Expected the private user to be left out of the league (%v)", err)
+	}
+}
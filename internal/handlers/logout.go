@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 
@@ -47,10 +46,7 @@ func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Invalidate cache entries for this user
 	if hasUserID && h.cache != nil {
-		accountKey := fmt.Sprintf("account:%d", userID)
-		activitiesKey := fmt.Sprintf("activities:%d", userID)
-		h.cache.Delete(accountKey)
-		h.cache.Delete(activitiesKey)
+		invalidateUserCache(h.cache, userID)
 		log.Printf("Invalidated cache for user %d on logout", userID)
 	}
 
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/metrics"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// LotMethodHandler handles changes to how a user's exits are matched to entries
+type LotMethodHandler struct {
+	db *database.DB
+}
+
+// NewLotMethodHandler creates a new lot method handler
+func NewLotMethodHandler(db *database.DB) *LotMethodHandler {
+	return &LotMethodHandler{db: db}
+}
+
+// ServeHTTP saves the submitted lot matching method and returns the refreshed form
+func (h *LotMethodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	method := metrics.LotMethod(r.FormValue("lot_method"))
+	if !metrics.ValidLotMethod(method) {
+		http.Error(w, "Invalid lot method", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.SetLotMethod(userID, string(method)); err != nil {
+		log.Printf("Failed to update lot method: %v", err)
+		http.Error(w, "Failed to update lot method", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.LotMethodForm(string(method), true).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering lot method form: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// LotSelectionHandler records which entry lot a user's exit closes under
+// specific-lot matching
+type LotSelectionHandler struct {
+	db    *database.DB
+	cache *cache.Cache
+}
+
+// NewLotSelectionHandler creates a new lot selection handler
+func NewLotSelectionHandler(db *database.DB) *LotSelectionHandler {
+	return &LotSelectionHandler{db: db, cache: nil}
+}
+
+func (h *LotSelectionHandler) SetCache(c *cache.Cache) {
+	h.cache = c
+}
+
+// ServeHTTP saves the chosen lot and returns the refreshed realized P&L panel
+func (h *LotSelectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	exitID := r.FormValue("exit_id")
+	entryID := r.FormValue("entry_id")
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if lotMethodFor(user) != metrics.LotSpecific {
+		http.Error(w, "Specific-lot matching is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	trades, err := getRealizedTrades(r.Context(), h.db, h.cache, user, userID)
+	if err != nil {
+		if redirectIfRevoked(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get realized trades for user %d: %v", userID, err)
+		http.Error(w, "Failed to get trades", http.StatusInternalServerError)
+		return
+	}
+
+	// The entry must have been open when the exit filled
+	if !isLotCandidate(trades, exitID, entryID) {
+		http.Error(w, "Invalid lot selection", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.SetLotSelection(userID, exitID, entryID); err != nil {
+		log.Printf("Failed to save lot selection: %v", err)
+		http.Error(w, "Failed to save lot selection", http.StatusInternalServerError)
+		return
+	}
+
+	trades, err = getRealizedTrades(r.Context(), h.db, h.cache, user, userID)
+	if err != nil {
+		log.Printf("Failed to get realized trades for user %d: %v", userID, err)
+		http.Error(w, "Failed to get trades", http.StatusInternalServerError)
+		return
+	}
+
+	data := convertRealized(trades, metrics.LotSpecific, true, true, time.Now())
+	if err := templates.RealizedPanel(data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering realized P&L: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// isLotCandidate reports whether entryID was an open lot when exitID filled
+func isLotCandidate(trades []metrics.RealizedTrade, exitID, entryID string) bool {
+	for _, trade := range trades {
+		if trade.ExitID != exitID {
+			continue
+		}
+		for _, candidate := range trade.Candidates {
+			if candidate.EntryID == entryID {
+				return true
+			}
+		}
+	}
+	return false
+}
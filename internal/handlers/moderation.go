@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+const (
+	// defaultReportHideThreshold is how many open reports hide a comment
+	// pending review
+	defaultReportHideThreshold = 3
+	// reportDetailsLength caps the details a reporter can add
+	reportDetailsLength = 300
+	// moderationLogShown caps the audit log entries on the moderation page
+	moderationLogShown = 50
+)
+
+// WordFilter turns away comments containing blocked words, matched as whole
+// words regardless of case. A nil filter blocks nothing.
+type WordFilter struct {
+	pattern *regexp.Regexp
+}
+
+// NewWordFilter builds a filter for the given words, returning nil when
+// there are none
+func NewWordFilter(words []string) *WordFilter {
+	var quoted []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return &WordFilter{pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// Match returns the first blocked word in content, or "" when there is none
+func (f *WordFilter) Match(content string) string {
+	if f == nil {
+		return ""
+	}
+	return f.pattern.FindString(content)
+}
+
+// rejectFiltered answers the request with an error and records the attempt
+// in the moderation log when content contains a blocked word. commentID is
+// nil for a new comment.
+func rejectFiltered(w http.ResponseWriter, db *database.DB, filter *WordFilter, userID int, commentID *int, content string) bool {
+	word := filter.Match(content)
+	if word == "" {
+		return false
+	}
+
+	a := database.ModerationAction{
+		UserID: userID,
+		Action: database.ModerationFilter,
+		Detail: strings.ToLower(word),
+	}
+	if commentID != nil {
+		a.CommentID = sql.NullInt64{Int64: int64(*commentID), Valid: true}
+	}
+	if err := db.LogModerationAction(a); err != nil {
+		log.Printf("Failed to log filtered comment: %v", err)
+	}
+
+	http.Error(w, "Comment contains language that isn't allowed", http.StatusBadRequest)
+	return true
+}
+
+// ModerationHandler serves the moderation queue of reported comments and
+// applies moderators' decisions. Only admins can use it.
+type ModerationHandler struct {
+	db *database.DB
+}
+
+func NewModerationHandler(db *database.DB) *ModerationHandler {
+	return &ModerationHandler{db: db}
+}
+
+// ServeHTTP handles GET /moderation and POST /moderation/comments/{id}
+func (h *ModerationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !user.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/moderation")
+	switch {
+	case path == "" || path == "/":
+		h.queue(w, r, user)
+	case strings.HasPrefix(path, "/comments/"):
+		h.moderate(w, r, user, strings.TrimPrefix(path, "/comments/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *ModerationHandler) queue(w http.ResponseWriter, r *http.Request, user *database.User) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := h.moderationData()
+	if err != nil {
+		log.Printf("Error getting moderation queue: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		if err := templates.ModerationQueue(data).Render(r.Context(), w); err != nil {
+			log.Printf("Error rendering moderation queue: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := templates.ModerationPage(templateUserFor(user), data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering moderation page: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// moderate applies the action form value (remove, dismiss or restore) to a
+// comment and returns the refreshed queue
+func (h *ModerationHandler) moderate(w http.ResponseWriter, r *http.Request, user *database.User, idStr string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	commentID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.db.GetCommentByID(commentID)
+	if err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	// Removal can only be undone by restoring; only removed comments can be restored
+	action := r.FormValue("action")
+	var allowed bool
+	switch action {
+	case database.ModerationRemove, database.ModerationDismiss:
+		allowed = comment.Status != database.CommentRemoved && comment.Status != database.CommentDeleted
+	case database.ModerationRestore:
+		allowed = comment.Status == database.CommentRemoved
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Comment is already "+comment.Status, http.StatusConflict)
+		return
+	}
+
+	// The log keeps what the comment said, since authors can still delete it
+	detail := truncateRunes(comment.Content, notificationExcerptLength)
+	if err := h.db.ModerateComment(comment.ID, &user.ID, action, detail); err != nil {
+		log.Printf("Error moderating comment %d: %v", comment.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := h.moderationData()
+	if err != nil {
+		log.Printf("Error getting moderation queue: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.ModerationQueue(data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering moderation queue: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// moderationData builds the queue and the recent audit log for display
+func (h *ModerationHandler) moderationData() (templates.ModerationData, error) {
+	queue, err := h.db.GetModerationQueue()
+	if err != nil {
+		return templates.ModerationData{}, err
+	}
+	actions, err := h.db.GetModerationActions(moderationLogShown)
+	if err != nil {
+		return templates.ModerationData{}, err
+	}
+
+	data := templates.ModerationData{
+		Queue: make([]templates.ModerationItemData, 0, len(queue)),
+		Log:   make([]templates.ModerationLogData, 0, len(actions)),
+	}
+	for _, item := range queue {
+		name := item.UserNickname
+		if name == "" {
+			name = item.UserDisplayName
+		}
+		reports := make([]templates.ModerationReportData, 0, len(item.Reports))
+		for _, report := range item.Reports {
+			reports = append(reports, templates.ModerationReportData{
+				ReporterName: report.ReporterName,
+				Reason:       report.Reason,
+				Details:      report.Details,
+				TimeAgo:      formatTimeAgo(report.CreatedAt),
+			})
+		}
+		data.Queue = append(data.Queue, templates.ModerationItemData{
+			CommentID:  item.ID,
+			AuthorID:   item.UserID,
+			AuthorName: name,
+			Content:    item.Content,
+			Status:     item.Status,
+			TimeAgo:    formatTimeAgo(item.CreatedAt),
+			Reports:    reports,
+		})
+	}
+	for _, a := range actions {
+		entry := templates.ModerationLogData{
+			Action:        a.Action,
+			ModeratorName: a.ModeratorName,
+			AuthorID:      a.UserID,
+			AuthorName:    a.UserName,
+			Detail:        a.Detail,
+			TimeAgo:       formatTimeAgo(a.CreatedAt),
+			CanRestore:    a.Action == database.ModerationRemove && a.CommentStatus == database.CommentRemoved,
+		}
+		if a.CommentID.Valid {
+			entry.CommentID = int(a.CommentID.Int64)
+		}
+		if !a.ModeratorID.Valid {
+			entry.ModeratorName = "Automatic"
+		}
+		data.Log = append(data.Log, entry)
+	}
+	return data, nil
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+func TestCommentModeration(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	_, aliceSession := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	})
+	_, bobSession := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+	_, carolSession := env.addUser("PK3", "Carol", leaderboardFixture("acct-3", false, 100000, 100000))
+
+	env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), aliceSession)
+
+	filter := NewWordFilter([]string{"scam"})
+	comments := NewCommentsHandler(env.db)
+	comments.SetWordFilter(filter)
+	actions := NewCommentActionsHandler(env.db)
+	actions.SetWordFilter(filter)
+	actions.SetReportHideThreshold(2)
+	moderation := NewModerationHandler(env.db)
+
+	post := func(handler http.Handler, path string, form url.Values, sessionID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return env.serve(handler, req, sessionID)
+	}
+	thread := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/api/activities/a-1/comments", nil)
+		return env.serve(comments, req, carolSession).Body.String()
+	}
+
+	// The word filter turns the comment away and logs it
+	if rec := post(comments, "/api/activities/a-1/comments", url.Values{"content": {"Total SCAM"}}, bobSession); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected the filtered comment to be rejected, got %d", rec.Code)
+	}
+	if rec := post(comments, "/api/activities/a-1/comments", url.Values{"content": {"Buy now before it moons"}}, bobSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected comment to succeed, got %d", rec.Code)
+	}
+	posted, err := env.db.GetCommentsByActivity("a-1")
+	if err != nil || len(posted) != 1 {
+		t.Fatalf("Expected one comment, got %d (%v)", len(posted), err)
+	}
+	commentID := posted[0].ID
+	reply := url.Values{"content": {"Not financial advice"}, "parent_id": {fmt.Sprint(commentID)}}
+	if rec := post(comments, "/api/activities/a-1/comments", reply, carolSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected reply to succeed, got %d", rec.Code)
+	}
+
+	reportPath := fmt.Sprintf("/api/comments/%d/report", commentID)
+	if rec := post(actions, reportPath, url.Values{"reason": {database.ReportSpam}}, bobSession); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected reporting your own comment to fail, got %d", rec.Code)
+	}
+	if rec := post(actions, reportPath, url.Values{"reason": {"boring"}}, carolSession); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown reason to fail, got %d", rec.Code)
+	}
+
+	// One report leaves the comment up; the second hides it, keeping the reply threaded
+	if rec := post(actions, reportPath, url.Values{"reason": {database.ReportSpam}, "details": {"pump"}}, carolSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected report to succeed, got %d", rec.Code)
+	}
+	if body := thread(); !strings.Contains(body, "Buy now before it moons") {
+		t.Errorf("Expected one report to leave the comment up:\n%s", body)
+	}
+	if rec := post(actions, reportPath, url.Values{"reason": {database.ReportMisleading}}, aliceSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected report to succeed, got %d", rec.Code)
+	}
+	body := thread()
+	if strings.Contains(body, "Buy now before it moons") || !strings.Contains(body, "[hidden pending review]") || !strings.Contains(body, "Not financial advice") {
+		t.Errorf("Expected the comment hidden behind a tombstone with its reply kept:\n%s", body)
+	}
+
+	edit := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/comments/%d", commentID), strings.NewReader("content=edited"))
+	edit.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if rec := env.serve(actions, edit, bobSession); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a hidden comment to be locked against edits, got %d", rec.Code)
+	}
+
+	// Only admins see the queue
+	queueReq := func(sessionID string) *httptest.ResponseRecorder {
+		return env.serve(moderation, httptest.NewRequest(http.MethodGet, "/moderation", nil), sessionID)
+	}
+	if rec := queueReq(aliceSession); rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected non-admins to be turned away, got %d", rec.Code)
+	}
+	if err := env.db.SetAdmins([]string{"acct-1"}); err != nil {
+		t.Fatalf("Failed to set admins: %v", err)
+	}
+	rec := queueReq(aliceSession)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the admin to see the queue, got %d", rec.Code)
+	}
+	for _, want := range []string{"Buy now before it moons", "Spam", "Misleading", "pump", "Hidden"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected the queue to show %q:\n%s", want, rec.Body.String())
+		}
+	}
+
+	modPath := fmt.Sprintf("/moderation/comments/%d", commentID)
+	if rec := post(moderation, modPath, url.Values{"action": {database.ModerationRemove}}, aliceSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected removal to succeed, got %d", rec.Code)
+	}
+	if body := thread(); !strings.Contains(body, "[removed by moderator]") || !strings.Contains(body, "Not financial advice") {
+		t.Errorf("Expected a removal tombstone with the reply kept:\n%s", body)
+	}
+	if rec := post(moderation, modPath, url.Values{"action": {database.ModerationRemove}}, aliceSession); rec.Code != http.StatusConflict {
+		t.Errorf("Expected removing twice to conflict, got %d", rec.Code)
+	}
+	if rec := post(moderation, modPath, url.Values{"action": {database.ModerationRestore}}, aliceSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected restore to succeed, got %d", rec.Code)
+	}
+	if body := thread(); !strings.Contains(body, "Buy now before it moons") {
+		t.Errorf("Expected the restored comment back:\n%s", body)
+	}
+
+	logged, err := env.db.GetModerationActions(10)
+	if err != nil {
+		t.Fatalf("Failed to get moderation actions: %v", err)
+	}
+	var got []string
+	for i := len(logged) - 1; i >= 0; i-- {
+		got = append(got, logged[i].Action)
+	}
+	want := []string{database.ModerationFilter, database.ModerationHide, database.ModerationRemove, database.ModerationRestore}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected audit log %v, got %v", want, got)
+	}
+	if logged[1].ModeratorName != "Alice" || logged[2].ModeratorID.Valid {
+		t.Errorf("Expected the removal credited to Alice and the hide to no one, got %+v", logged)
+	}
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/live"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+const (
+	// notificationsShown caps the notifications listed on the notifications page
+	notificationsShown = 50
+	// notificationExcerptLength caps the comment text kept with a notification
+	notificationExcerptLength = 100
+)
+
+// NotificationsHandler serves the notifications page, the unread count behind
+// the bell in the navigation and marking notifications read
+type NotificationsHandler struct {
+	db *database.DB
+}
+
+func NewNotificationsHandler(db *database.DB) *NotificationsHandler {
+	return &NotificationsHandler{db: db}
+}
+
+// ServeHTTP handles GET /notifications, GET /notifications/count and
+// POST /notifications/read
+func (h *NotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/notifications") {
+	case "", "/":
+		h.list(w, r, userID)
+	case "/count":
+		h.count(w, r, userID)
+	case "/read":
+		h.markRead(w, r, userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *NotificationsHandler) list(w http.ResponseWriter, r *http.Request, userID int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := h.notificationsData(userID)
+	if err != nil {
+		log.Printf("Error getting notifications: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		if err := templates.NotificationsList(data).Render(r.Context(), w); err != nil {
+			log.Printf("Error rendering notifications: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := templates.NotificationsPage(templateUserFor(user), data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering notifications page: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *NotificationsHandler) count(w http.ResponseWriter, r *http.Request, userID int) {
+	unread, err := h.db.CountUnreadNotifications(userID)
+	if err != nil {
+		log.Printf("Error counting notifications: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.NotificationBadge(unread).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering notification badge: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// markRead marks the notification in the id form value as read, or every
+// notification when all is set, and returns the refreshed list
+func (h *NotificationsHandler) markRead(w http.ResponseWriter, r *http.Request, userID int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if r.FormValue("all") != "" {
+		err = h.db.MarkAllNotificationsRead(userID)
+	} else {
+		id, convErr := strconv.Atoi(r.FormValue("id"))
+		if convErr != nil {
+			http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+			return
+		}
+		err = h.db.MarkNotificationRead(userID, id)
+	}
+	if err != nil {
+		log.Printf("Error marking notifications read: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := h.notificationsData(userID)
+	if err != nil {
+		log.Printf("Error getting notifications: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Refresh the bell's unread count
+	w.Header().Set("HX-Trigger", "notificationsChanged")
+	if err := templates.NotificationsList(data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering notifications: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (h *NotificationsHandler) notificationsData(userID int) (templates.NotificationsData, error) {
+	notifications, err := h.db.GetNotifications(userID, notificationsShown)
+	if err != nil {
+		return templates.NotificationsData{}, err
+	}
+
+	data := templates.NotificationsData{
+		Notifications: make([]templates.NotificationData, 0, len(notifications)),
+	}
+	for _, n := range notifications {
+		data.Notifications = append(data.Notifications, convertNotification(n))
+		if !n.ReadAt.Valid {
+			data.Unread++
+		}
+	}
+	return data, nil
+}
+
+// convertNotification converts a notification to template data
+func convertNotification(n database.NotificationWithActor) templates.NotificationData {
+	actorName := n.ActorNickname
+	if actorName == "" {
+		actorName = n.ActorDisplayName
+	}
+	if actorName == "" {
+		actorName = fmt.Sprintf("User %d", n.ActorID)
+	}
+
+	return templates.NotificationData{
+		ID:        n.ID,
+		Type:      n.Type,
+		ActorID:   n.ActorID,
+		ActorName: actorName,
+		Detail:    n.Detail,
+		TimeAgo:   formatTimeAgo(n.CreatedAt),
+		Read:      n.ReadAt.Valid,
+	}
+}
+
+// NotificationPreferencesHandler saves which notification types a user receives
+type NotificationPreferencesHandler struct {
+	db *database.DB
+}
+
+func NewNotificationPreferencesHandler(db *database.DB) *NotificationPreferencesHandler {
+	return &NotificationPreferencesHandler{db: db}
+}
+
+// ServeHTTP saves the submitted preferences and returns the refreshed form
+func (h *NotificationPreferencesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// Unchecked checkboxes aren't submitted, so absence means off
+	prefs := make(map[string]bool, len(database.NotificationTypes))
+	for _, t := range database.NotificationTypes {
+		prefs[t] = r.FormValue("notify_"+t) == "on"
+	}
+
+	if err := h.db.SetNotificationPreferences(userID, prefs); err != nil {
+		log.Printf("Failed to update notification preferences: %v", err)
+		http.Error(w, "Failed to update notification preferences", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.NotificationPreferencesForm(convertNotificationPreferences(prefs), true).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering notification preferences: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// convertNotificationPreferences converts notification preferences to
+// template data, in display order. Types missing from prefs are on.
+func convertNotificationPreferences(prefs map[string]bool) []templates.NotificationPreferenceData {
+	data := make([]templates.NotificationPreferenceData, 0, len(database.NotificationTypes))
+	for _, t := range database.NotificationTypes {
+		enabled, ok := prefs[t]
+		data = append(data, templates.NotificationPreferenceData{Type: t, Enabled: enabled || !ok})
+	}
+	return data
+}
+
+// notify records a notification and pushes the recipient's new unread count
+// to their bell, logging rather than failing the request that caused it
+func notify(db *database.DB, hub *live.Hub, n database.Notification) {
+	created, err := db.CreateNotification(n)
+	if err != nil {
+		log.Printf("Failed to notify user %d: %v", n.UserID, err)
+		return
+	}
+	if created != nil {
+		hub.Publish(live.Event{Type: liveNotification, UserID: n.UserID})
+	}
+}
+
+// notifyComment tells the author of the parent comment about a reply, the
+// trade's owner about a comment on their trade and the mentioned users about
+// their mentions. Each user hears about the comment once, the reply taking
+// precedence over the comment and the comment over the mention.
+func notifyComment(db *database.DB, hub *live.Hub, comment *database.Comment, mentioned []int) {
+	notified := make(map[int]bool)
+	send := func(userID int, notificationType string) {
+		if notified[userID] {
+			return
+		}
+		notified[userID] = true
+		notify(db, hub, database.Notification{
+			UserID:     userID,
+			ActorID:    comment.UserID,
+			Type:       notificationType,
+			ActivityID: sql.NullString{String: comment.ActivityID, Valid: true},
+			CommentID:  sql.NullInt64{Int64: int64(comment.ID), Valid: true},
+			Detail:     truncateRunes(comment.Content, notificationExcerptLength),
+		})
+	}
+
+	if comment.ParentID.Valid {
+		parent, err := db.GetCommentByID(int(comment.ParentID.Int64))
+		if err != nil {
+			log.Printf("Failed to get parent comment %d: %v", comment.ParentID.Int64, err)
+		} else {
+			send(parent.UserID, database.NotificationReply)
+		}
+	}
+
+	owner, err := db.GetTradeOwner(comment.ActivityID)
+	if err != nil {
+		log.Printf("Failed to get owner of trade %s: %v", comment.ActivityID, err)
+	} else {
+		send(owner, database.NotificationComment)
+	}
+
+	for _, userID := range mentioned {
+		send(userID, database.NotificationMention)
+	}
+}
+
+// notifyMentions tells users they've been mentioned in a comment
+func notifyMentions(db *database.DB, hub *live.Hub, comment *database.Comment, mentioned []int) {
+	for _, userID := range mentioned {
+		notify(db, hub, database.Notification{
+			UserID:     userID,
+			ActorID:    comment.UserID,
+			Type:       database.NotificationMention,
+			ActivityID: sql.NullString{String: comment.ActivityID, Valid: true},
+			CommentID:  sql.NullInt64{Int64: int64(comment.ID), Valid: true},
+			Detail:     truncateRunes(comment.Content, notificationExcerptLength),
+		})
+	}
+}
+
+// notifyReaction tells a trade's owner about a new reaction to it
+func notifyReaction(db *database.DB, hub *live.Hub, activityID string, actorID int, emoji string) {
+	owner, err := db.GetTradeOwner(activityID)
+	if err != nil {
+		log.Printf("Failed to get owner of trade %s: %v", activityID, err)
+		return
+	}
+	notify(db, hub, database.Notification{
+		UserID:     owner,
+		ActorID:    actorID,
+		Type:       database.NotificationReaction,
+		ActivityID: sql.NullString{String: activityID, Valid: true},
+		Detail:     emoji,
+	})
+}
+
+// truncateRunes shortens s to at most n characters, marking the cut with an ellipsis
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func TestSocialEventsNotify(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	alice, aliceSession := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	})
+	bob, bobSession := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+
+	env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), aliceSession)
+
+	postForm := func(handler http.Handler, path string, form url.Values, sessionID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return env.serve(handler, req, sessionID)
+	}
+	react := func(sessionID string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/activities/a-1/reactions", strings.NewReader(`{"emoji":"🚀"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if rec := env.serve(NewReactionsHandler(env.db), req, sessionID); rec.Code != http.StatusOK {
+			t.Fatalf("Expected reaction to succeed, got %d", rec.Code)
+		}
+	}
+	unread := func(userID int) int {
+		count, err := env.db.CountUnreadNotifications(userID)
+		if err != nil {
+			t.Fatalf("Failed to count notifications: %v", err)
+		}
+		return count
+	}
+
+	// Bob comments on Alice's trade, then Alice replies to him on her own trade
+	if rec := postForm(NewCommentsHandler(env.db), "/api/activities/a-1/comments", url.Values{"content": {"Nice entry"}}, bobSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected comment to succeed, got %d", rec.Code)
+	}
+	comments, err := env.db.GetCommentsByActivity("a-1")
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("Expected one comment, got %d (%v)", len(comments), err)
+	}
+	reply := url.Values{"content": {"Thanks"}, "parent_id": {fmt.Sprint(comments[0].ID)}}
+	if rec := postForm(NewCommentsHandler(env.db), "/api/activities/a-1/comments", reply, aliceSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected reply to succeed, got %d", rec.Code)
+	}
+
+	// Toggling the reaction off and on again doesn't notify twice
+	react(bobSession)
+	react(bobSession)
+	react(bobSession)
+	if rec := postForm(NewFollowHandler(env.db), "/api/follow", url.Values{"user_id": {fmt.Sprint(alice.ID)}}, bobSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected follow to succeed, got %d", rec.Code)
+	}
+
+	if got := unread(alice.ID); got != 3 {
+		t.Errorf("Expected Alice to have 3 unread notifications, got %d", got)
+	}
+	if got := unread(bob.ID); got != 1 {
+		t.Errorf("Expected Bob to have 1 reply notification, got %d", got)
+	}
+
+	page := env.serve(NewNotificationsHandler(env.db), httptest.NewRequest(http.MethodGet, "/notifications", nil), aliceSession)
+	for _, want := range []string{"commented on your trade", "reacted 🚀 to your trade", "started following you", "Nice entry"} {
+		if !strings.Contains(page.Body.String(), want) {
+			t.Errorf("Expected notifications page to contain %q", want)
+		}
+	}
+
+	badge := env.serve(NewNotificationsHandler(env.db), httptest.NewRequest(http.MethodGet, "/notifications/count", nil), aliceSession)
+	if !strings.Contains(badge.Body.String(), "3") {
+		t.Errorf("Expected the badge to show 3, got %q", badge.Body.String())
+	}
+
+	rec := postForm(NewNotificationsHandler(env.db), "/notifications/read", url.Values{"all": {"1"}}, aliceSession)
+	if rec.Code != http.StatusOK || rec.Header().Get("HX-Trigger") != "notificationsChanged" {
+		t.Fatalf("Expected mark all read to succeed and refresh the bell, got %d", rec.Code)
+	}
+	if got := unread(alice.ID); got != 0 {
+		t.Errorf("Expected no unread notifications after marking all read, got %d", got)
+	}
+
+	// With reactions turned off, removing and re-adding one notifies nobody
+	prefs := url.Values{"notify_comment": {"on"}, "notify_reply": {"on"}, "notify_follow": {"on"}}
+	if rec := postForm(NewNotificationPreferencesHandler(env.db), "/api/profile/notifications", prefs, aliceSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected preferences to save, got %d", rec.Code)
+	}
+	react(bobSession)
+	react(bobSession)
+	if got := unread(alice.ID); got != 0 {
+		t.Errorf("Expected no notification for a disabled type, got %d", got)
+	}
+}
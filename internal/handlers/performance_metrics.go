@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/fanout"
+	"github.com/skywall34/fantasy-trading/internal/metrics"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// maxMetricFills bounds how many of a user's most recent fills win rate and
+// hold time are computed from
+const maxMetricFills = 400
+
+// leaderboardSort orders the leaderboard by one metric
+type leaderboardSort struct {
+	Label     string
+	Ascending bool // lower is better, e.g. volatility
+	// value returns the trader's metric, or false when it can't be measured
+	value func(t rankedTrader) (float64, bool)
+}
+
+// leaderboardSorts maps the leaderboard's sort query parameter to a metric
+var leaderboardSorts = map[string]leaderboardSort{
+	"gain":       {Label: "Gain", value: func(t rankedTrader) (float64, bool) { return t.GainPercent, true }},
+	"sharpe":     {Label: "Sharpe", value: riskValue(func(r metrics.Risk) float64 { return r.Sharpe })},
+	"sortino":    {Label: "Sortino", value: riskValue(func(r metrics.Risk) float64 { return r.Sortino })},
+	"volatility": {Label: "Volatility", Ascending: true, value: riskValue(func(r metrics.Risk) float64 { return r.Volatility })},
+	"drawdown":   {Label: "Max Drawdown", value: riskValue(func(r metrics.Risk) float64 { return r.MaxDrawdown })},
+	"best_day":   {Label: "Best Day", value: riskValue(func(r metrics.Risk) float64 { return r.BestDay })},
+	"worst_day":  {Label: "Worst Day", value: riskValue(func(r metrics.Risk) float64 { return r.WorstDay })},
+	"win_rate":   {Label: "Win Rate", value: tradingValue(func(t metrics.Trading) float64 { return t.WinRate })},
+	"avg_hold":   {Label: "Avg Hold", value: tradingValue(func(t metrics.Trading) float64 { return t.AvgHold.Hours() })},
+}
+
+// leaderboardSortOrder lists the sorts in the order they're offered
+var leaderboardSortOrder = []string{"gain", "sharpe", "sortino", "volatility", "drawdown", "best_day", "worst_day", "win_rate", "avg_hold"}
+
+// riskValue reads a metric that needs at least two daily returns
+func riskValue(metric func(metrics.Risk) float64) func(rankedTrader) (float64, bool) {
+	return func(t rankedTrader) (float64, bool) {
+		return metric(t.Risk), t.Risk.Days >= 2
+	}
+}
+
+// tradingValue reads a metric that needs at least one closed trade
+func tradingValue(metric func(metrics.Trading) float64) func(rankedTrader) (float64, bool) {
+	return func(t rankedTrader) (float64, bool) {
+		return metric(t.Trading), t.Trading.ClosedTrades > 0
+	}
+}
+
+// sortTraders orders traders best first by a metric, leaving those it can't
+// be measured for at the end in rank order
+func sortTraders(traders []rankedTrader, by leaderboardSort) {
+	sort.SliceStable(traders, func(i, j int) bool {
+		vi, oki := by.value(traders[i])
+		vj, okj := by.value(traders[j])
+		if oki != okj {
+			return oki
+		}
+		if !oki || vi == vj {
+			return traders[i].Rank < traders[j].Rank
+		}
+		if by.Ascending {
+			return vi < vj
+		}
+		return vi > vj
+	})
+}
+
+// addTradingStats fills in each trader's win rate and hold time over the
+// standings period. Traders whose fills can't be fetched in time keep empty stats.
+func addTradingStats(ctx context.Context, db *database.DB, c *cache.Cache, traders []rankedTrader, viewerID int) {
+	ctx, cancel := context.WithTimeout(ctx, fanoutTimeout)
+	defer cancel()
+
+	type userTrading struct {
+		UserID  int
+		Trading metrics.Trading
+	}
+	results := fanout.Run(ctx, fanoutWorkers, traders, func(ctx context.Context, t rankedTrader) (userTrading, error) {
+		user, err := db.GetUserByID(t.UserID)
+		if err != nil {
+			return userTrading{}, err
+		}
+		trading, err := getTradingStats(ctx, db, c, user, t.PeriodStart, viewerID)
+		if err != nil {
+			log.Printf("Failed to get trading stats for user %d: %v", t.UserID, err)
+			return userTrading{}, err
+		}
+		return userTrading{UserID: t.UserID, Trading: trading}, nil
+	})
+
+	stats := make(map[int]metrics.Trading, len(results.Values))
+	for _, v := range results.Values {
+		stats[v.UserID] = v.Trading
+	}
+	for i := range traders {
+		traders[i].Trading = stats[traders[i].UserID]
+	}
+}
+
+// riskFromHistory measures the daily returns of a portfolio history
+func riskFromHistory(history *alpaca.PortfolioHistory) metrics.Risk {
+	if history == nil {
+		return metrics.Risk{}
+	}
+	return metrics.ComputeRisk(metrics.DailyCloses(history.Timestamp, history.Equity, history.BaseValue, alpaca.MarketLocation))
+}
+
+// getTradingStats computes a user's win rate and hold time from their recent
+// fills, closed since the given time. Other traders only see stats built from
+// the fills the user has published.
+func getTradingStats(ctx context.Context, db *database.DB, c *cache.Cache, user *database.User, since time.Time, viewerID int) (metrics.Trading, error) {
+	var activities []alpaca.Activity
+	var err error
+	if user.ID == viewerID {
+		activities, err = getRecentTradesForUser(ctx, db, c, user.ID, maxMetricFills)
+	} else {
+		activities, err = getVisibleTradesForUser(ctx, db, c, user, maxMetricFills)
+	}
+	if err != nil {
+		return metrics.Trading{}, err
+	}
+
+	return metrics.ComputeTrading(fillsFromActivities(activities), since), nil
+}
+
+// convertMetrics converts risk and trading metrics to template data
+func convertMetrics(risk metrics.Risk, trading metrics.Trading) templates.MetricsData {
+	return templates.MetricsData{
+		HasRisk:      risk.Days >= 2,
+		Volatility:   risk.Volatility,
+		Sharpe:       risk.Sharpe,
+		Sortino:      risk.Sortino,
+		MaxDrawdown:  risk.MaxDrawdown,
+		BestDay:      risk.BestDay,
+		WorstDay:     risk.WorstDay,
+		HasTrading:   trading.ClosedTrades > 0,
+		ClosedTrades: trading.ClosedTrades,
+		WinRate:      trading.WinRate,
+		AvgHold:      formatHoldTime(trading.AvgHold),
+	}
+}
+
+// formatHoldTime formats a holding period in its largest sensible unit
+func formatHoldTime(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(math.Round(d.Minutes())))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%.1fh", d.Hours())
+	default:
+		return fmt.Sprintf("%.1fd", d.Hours()/24)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -46,11 +47,16 @@ func (h *PortfolioHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Create Alpaca client
-	alpacaClient := alpaca.NewClient(apiKey, apiSecret)
+	alpacaClient := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(middleware.GetIsLive(r.Context())))
 	ctx := context.Background()
 
 	// Get portfolio history
 	history, err := alpacaClient.GetPortfolioHistory(ctx, period, timeframe)
+	if errors.Is(err, alpaca.ErrUnauthorized) {
+		// The dashboard's next page load sends the user back to login
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to get portfolio history: %v", err)
 		http.Error(w, "Failed to get portfolio history", http.StatusInternalServerError)
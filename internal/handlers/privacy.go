@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// PrivacyHandler handles updates to a user's privacy settings
+type PrivacyHandler struct {
+	db    *database.DB
+	cache *cache.Cache
+}
+
+// NewPrivacyHandler creates a new privacy settings handler
+func NewPrivacyHandler(db *database.DB) *PrivacyHandler {
+	return &PrivacyHandler{db: db, cache: nil}
+}
+
+func (h *PrivacyHandler) SetCache(c *cache.Cache) {
+	h.cache = c
+}
+
+// ServeHTTP saves the submitted privacy settings and returns the refreshed form
+func (h *PrivacyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	tradeDelay := 0
+	if value := r.FormValue("trade_delay_minutes"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 0 || minutes > database.MaxTradeDelayMinutes {
+			http.Error(w, "Invalid trade delay", http.StatusBadRequest)
+			return
+		}
+		tradeDelay = minutes
+	}
+
+	// Unchecked checkboxes aren't submitted, so absence means false
+	settings := database.PrivacySettings{
+		IsPublic:            r.FormValue("is_public") == "on",
+		ShowAmounts:         r.FormValue("show_amounts") == "on",
+		HideFromLeaderboard: r.FormValue("hide_from_leaderboard") == "on",
+		HideFromFeed:        r.FormValue("hide_from_feed") == "on",
+		HidePositions:       r.FormValue("hide_positions") == "on",
+		TradeDelayMinutes:   tradeDelay,
+		HideOpenEntries:     r.FormValue("hide_open_entries") == "on",
+	}
+
+	if err := h.db.UpdatePrivacySettings(userID, settings); err != nil {
+		log.Printf("Failed to update privacy settings: %v", err)
+		http.Error(w, "Failed to update privacy settings", http.StatusInternalServerError)
+		return
+	}
+
+	// Drop cached leaderboard and feed data so the change shows up immediately
+	if h.cache != nil {
+		invalidateUserCache(h.cache, userID)
+	}
+
+	if err := templates.PrivacySettingsForm(convertPrivacySettings(settings), true).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering privacy settings: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// convertPrivacySettings converts privacy settings to template data
+func convertPrivacySettings(settings database.PrivacySettings) templates.PrivacySettingsData {
+	return templates.PrivacySettingsData{
+		IsPublic:            settings.IsPublic,
+		ShowAmounts:         settings.ShowAmounts,
+		HideFromLeaderboard: settings.HideFromLeaderboard,
+		HideFromFeed:        settings.HideFromFeed,
+		HidePositions:       settings.HidePositions,
+		TradeDelayMinutes:   settings.TradeDelayMinutes,
+		HideOpenEntries:     settings.HideOpenEntries,
+	}
+}
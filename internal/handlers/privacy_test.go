@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+func TestPrivacySettingsUpdateAndInvalidateCache(t *testing.T) {
+	env := newTestEnv(t)
+	user, sessionID := env.addUser("PK1", "Quiet", leaderboardFixture("acct-1", false, 100000, 101000))
+
+	c := cache.NewCache(time.Minute, 10*time.Second)
+	t.Cleanup(c.Stop)
+	c.Set("history:1:weekly", "cached")
+	c.Set("activities:1:21", "cached")
+
+	handler := NewPrivacyHandler(env.db)
+	handler.SetCache(c)
+
+	form := url.Values{"is_public": {"on"}, "show_amounts": {"on"}, "hide_from_leaderboard": {"on"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/profile/privacy", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := env.serve(handler, req, sessionID)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "Privacy settings saved") {
+		t.Error("Expected the refreshed form to confirm the save")
+	}
+
+	updated, err := env.db.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if !updated.IsPublic || !updated.ShowAmounts || !updated.HideFromLeaderboard || updated.HideFromFeed || updated.HidePositions {
+		t.Errorf("Unexpected settings after update: %+v", updated.Privacy())
+	}
+
+	for _, key := range []string{"history:1:weekly", "activities:1:21"} {
+		if _, found, _ := c.Get(key); found {
+			t.Errorf("Expected %s to be invalidated", key)
+		}
+	}
+}
+
+func TestPrivacySettingsHideUserFromPages(t *testing.T) {
+	env := newTestEnv(t)
+	_, viewerSession := env.addUser("PK1", "Viewer", leaderboardFixture("acct-1", false, 100000, 101000))
+
+	hidden := leaderboardFixture("acct-2", false, 100000, 110000)
+	hidden.Positions = []alpaca.Position{alpacatest.NewPosition("NVDA", 10, 100, 120)}
+	hidden.Activities = []alpaca.Activity{alpacatest.NewFill("h-1", "AMZN", "buy", 1, 180, time.Now())}
+	hiddenUser, _ := env.addUser("PK2", "Hidden", hidden)
+
+	err := env.db.UpdatePrivacySettings(hiddenUser.ID, database.PrivacySettings{
+		IsPublic:            true,
+		HideFromLeaderboard: true,
+		HideFromFeed:        true,
+		HidePositions:       true,
+	})
+	if err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/leaderboard", nil)
+	req.Header.Set("HX-Request", "true")
+	if body := env.serve(NewLeaderboardHandler(env.db), req, viewerSession).Body.String(); strings.Contains(body, "Hidden") {
+		t.Error("Expected the user to be left off the leaderboard")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/activity", nil)
+	req.Header.Set("HX-Request", "true")
+	if body := env.serve(NewActivityHandler(env.db), req, viewerSession).Body.String(); strings.Contains(body, "AMZN") {
+		t.Error("Expected the user's trades to be left out of the feed")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/user/%d", hiddenUser.ID), nil)
+	body := env.serve(NewUserHandler(env.db), req, viewerSession).Body.String()
+	if strings.Contains(body, "NVDA") || !strings.Contains(body, "Positions hidden by user") {
+		t.Error("Expected the profile to hide positions")
+	}
+	if !strings.Contains(body, "+10.00%") {
+		t.Error("Expected the profile to keep showing performance")
+	}
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/fanout"
+	"github.com/skywall34/fantasy-trading/internal/metrics"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// leaderboardPeriod describes how a leaderboard period maps onto Alpaca portfolio history
+type leaderboardPeriod struct {
+	Period    string        // Alpaca history period
+	Timeframe string        // Alpaca history resolution
+	CacheTTL  time.Duration // How long a user's history stays cached for this period
+}
+
+// leaderboardPeriods maps the leaderboard's period query parameter to portfolio history requests
+var leaderboardPeriods = map[string]leaderboardPeriod{
+	"daily":   {Period: "1D", Timeframe: "15Min", CacheTTL: 60 * time.Second},
+	"weekly":  {Period: "1W", Timeframe: "1H", CacheTTL: 5 * time.Minute},
+	"monthly": {Period: "1M", Timeframe: "1D", CacheTTL: 15 * time.Minute},
+	"all":     {Period: "all", Timeframe: "1D", CacheTTL: 15 * time.Minute},
+}
+
+// defaultRankingPeriod is the period ranks are shown for when none is chosen
+const defaultRankingPeriod = "weekly"
+
+// rankHistoryDays is how far back a profile's rank history chart reaches
+const rankHistoryDays = 90
+
+// accountMode names the leaderboard an account is ranked on
+func accountMode(isLive bool) string {
+	if isLive {
+		return "live"
+	}
+	return "paper"
+}
+
+// userPerformance is one user's gain over a leaderboard period
+type userPerformance struct {
+	UserID        int
+	DisplayName   string
+	Nickname      string
+	AvatarURL     string
+	CurrentEquity float64
+	GainAmount    float64
+	GainPercent   float64
+	ShowAmounts   bool
+	Resets        []string // trading days in the period the account appears to have been reset
+
+	// The gain as of the previous session's close, when the period covers it
+	PreviousGainPercent float64
+	HasPrevious         bool
+
+	PeriodStart time.Time       // first point of the period's history
+	PeriodEnd   time.Time       // last point of the period's history
+	Risk        metrics.Risk    // daily return statistics over the period
+	Trading     metrics.Trading // closed trades over the period; filled in on request
+}
+
+// rankedTrader is a user's place in one period's standings
+type rankedTrader struct {
+	userPerformance
+	Rank         int
+	PreviousRank int // rank at the previous session's close; 0 when unknown
+	DaysAtFirst  int // recorded trading days the user finished first
+}
+
+// RankChange returns how many places the trader moved since the previous
+// session's close, positive when they climbed
+func (t rankedTrader) RankChange() (int, bool) {
+	if t.PreviousRank == 0 {
+		return 0, false
+	}
+	return t.PreviousRank - t.Rank, true
+}
+
+// standings ranks every leaderboard user of one account mode over a period.
+// The leaderboard, profile and dashboard all read ranks from here so they
+// agree with each other.
+type standings struct {
+	Period      string
+	Mode        string
+	Traders     []rankedTrader // best first
+	Unavailable int            // users left out because their data couldn't be fetched
+}
+
+// find returns a user's place in the standings
+func (s *standings) find(userID int) (rankedTrader, bool) {
+	for _, t := range s.Traders {
+		if t.UserID == userID {
+			return t, true
+		}
+	}
+	return rankedTrader{}, false
+}
+
+// percentile returns the share of other ranked traders that a rank beats
+func (s *standings) percentile(rank int) float64 {
+	if len(s.Traders) <= 1 {
+		return 100
+	}
+	return float64(len(s.Traders)-rank) / float64(len(s.Traders)-1) * 100
+}
+
+// rankData returns a user's rank summary for templates. Users who aren't
+// ranked get a zero Rank.
+func (s *standings) rankData(userID int) templates.RankData {
+	data := templates.RankData{Period: s.Period, Total: len(s.Traders)}
+	t, ok := s.find(userID)
+	if !ok {
+		return data
+	}
+	data.Rank = t.Rank
+	data.Percentile = s.percentile(t.Rank)
+	data.Change, data.HasChange = t.RankChange()
+	data.DaysAtFirst = t.DaysAtFirst
+	return data
+}
+
+// getStandings ranks every leaderboard user of an account mode by their gain
+// over the period. Users are fetched concurrently and whoever responds before
+// the deadline is ranked.
+func getStandings(ctx context.Context, db *database.DB, c *cache.Cache, period, mode string) (*standings, error) {
+	users, err := db.GetLeaderboardUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fanoutTimeout)
+	defer cancel()
+
+	results := fanout.Run(ctx, fanoutWorkers, users, func(ctx context.Context, u database.User) (userPerformance, error) {
+		return getUserPerformance(ctx, db, c, u, period, mode)
+	})
+	if results.Partial() {
+		log.Printf("Standings missing %d of %d users", results.Unavailable, len(users))
+	}
+	performances := results.Values
+
+	// Rank as of the previous close first. Recorded end-of-day standings are
+	// used when there are any; until then ranks are estimated from the
+	// portfolio histories of those whose window covers the previous close.
+	previous := make([]userPerformance, 0, len(performances))
+	for _, perf := range performances {
+		if perf.HasPrevious {
+			previous = append(previous, perf)
+		}
+	}
+	sort.SliceStable(previous, func(i, j int) bool {
+		return previous[i].PreviousGainPercent > previous[j].PreviousGainPercent
+	})
+	previousRanks := make(map[int]int, len(previous))
+	for i, perf := range previous {
+		previousRanks[perf.UserID] = i + 1
+	}
+	recorded, err := db.GetPreviousLeaderboardRanks(period, mode, alpaca.MarketDate(time.Now()))
+	if err != nil {
+		log.Printf("Failed to get recorded %s %s standings: %v", mode, period, err)
+	} else if len(recorded) > 0 {
+		previousRanks = recorded
+	}
+
+	daysAtFirst, err := db.GetDaysAtFirst(period, mode)
+	if err != nil {
+		log.Printf("Failed to get days at first for %s %s: %v", mode, period, err)
+	}
+
+	// Sort by gain percentage descending
+	sort.SliceStable(performances, func(i, j int) bool {
+		return performances[i].GainPercent > performances[j].GainPercent
+	})
+
+	traders := make([]rankedTrader, 0, len(performances))
+	for i, perf := range performances {
+		traders = append(traders, rankedTrader{
+			userPerformance: perf,
+			Rank:            i + 1,
+			PreviousRank:    previousRanks[perf.UserID],
+			DaysAtFirst:     daysAtFirst[perf.UserID],
+		})
+	}
+
+	return &standings{
+		Period:      period,
+		Mode:        mode,
+		Traders:     traders,
+		Unavailable: results.Unavailable,
+	}, nil
+}
+
+// getUserRank returns a user's rank summary for a period on their account
+// mode's leaderboard, or a zero Rank when they aren't ranked
+func getUserRank(ctx context.Context, db *database.DB, c *cache.Cache, userID int, isLive bool, period string) (templates.RankData, error) {
+	s, err := getStandings(ctx, db, c, period, accountMode(isLive))
+	if err != nil {
+		return templates.RankData{Period: period}, err
+	}
+	return s.rankData(userID), nil
+}
+
+// getUserPerformance computes a user's gain for the period from their Alpaca
+// portfolio history. Users of the other account mode, or without history for
+// the period, are skipped rather than reported as unavailable.
+func getUserPerformance(ctx context.Context, db *database.DB, c *cache.Cache, u database.User, period, mode string) (userPerformance, error) {
+	session, err := db.GetLatestSession(u.ID)
+	if err != nil || accountMode(session.IsLive) != mode {
+		return userPerformance{}, fanout.ErrSkip
+	}
+
+	history, err := getPeriodHistory(ctx, db, c, u.ID, period)
+	if err != nil {
+		log.Printf("Failed to get %s portfolio history for user %d: %v", period, u.ID, err)
+		return userPerformance{}, err
+	}
+
+	// Deposits, withdrawals and resets are stripped out of the gain; without
+	// them the simple gain over the window is used
+	flows, err := getCashFlowsForUser(ctx, db, c, u.ID)
+	if err != nil {
+		log.Printf("Failed to get cash flows for user %d: %v", u.ID, err)
+	}
+
+	// Calculate gain over the selected period from the portfolio history window
+	ret, ok := periodGain(history, period, u.Baseline(), flows)
+	if !ok {
+		return userPerformance{}, fanout.ErrSkip
+	}
+	previous, hasPrevious := periodGain(historyBeforeLastSession(history), period, u.Baseline(), flows)
+
+	displayName := "Unknown"
+	if u.Nickname.Valid && u.Nickname.String != "" {
+		displayName = u.Nickname.String
+	} else if u.DisplayName.Valid && u.DisplayName.String != "" {
+		displayName = u.DisplayName.String
+	}
+
+	nickname := ""
+	if u.Nickname.Valid {
+		nickname = u.Nickname.String
+	}
+
+	avatarURL := ""
+	if u.AvatarURL.Valid {
+		avatarURL = u.AvatarURL.String
+	}
+
+	return userPerformance{
+		UserID:              u.ID,
+		DisplayName:         displayName,
+		Nickname:            nickname,
+		AvatarURL:           avatarURL,
+		CurrentEquity:       ret.Equity,
+		GainAmount:          ret.Gain,
+		GainPercent:         ret.GainPercent,
+		ShowAmounts:         u.ShowAmounts,
+		Resets:              ret.Resets,
+		PreviousGainPercent: previous.GainPercent,
+		HasPrevious:         hasPrevious,
+		PeriodStart:         periodStart(history),
+		PeriodEnd:           periodEnd(history),
+		Risk:                riskFromHistory(history),
+	}, nil
+}
+
+// periodStart returns when a portfolio history window begins
+func periodStart(history *alpaca.PortfolioHistory) time.Time {
+	if history == nil || len(history.Timestamp) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(history.Timestamp[0], 0)
+}
+
+// periodEnd returns the time of a portfolio history window's last point
+func periodEnd(history *alpaca.PortfolioHistory) time.Time {
+	if history == nil || len(history.Timestamp) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(history.Timestamp[len(history.Timestamp)-1], 0)
+}
+
+// historyBeforeLastSession trims a portfolio history to the points before the
+// trading day of its last point, i.e. the window as of the previous close
+func historyBeforeLastSession(history *alpaca.PortfolioHistory) *alpaca.PortfolioHistory {
+	if history == nil || len(history.Timestamp) == 0 {
+		return nil
+	}
+
+	last := time.Unix(history.Timestamp[len(history.Timestamp)-1], 0).In(alpaca.MarketLocation)
+	sessionStart := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, alpaca.MarketLocation).Unix()
+
+	n := 0
+	for n < len(history.Timestamp) && n < len(history.Equity) && history.Timestamp[n] < sessionStart {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	return &alpaca.PortfolioHistory{
+		Timestamp: history.Timestamp[:n],
+		Equity:    history.Equity[:n],
+		BaseValue: history.BaseValue,
+		Timeframe: history.Timeframe,
+	}
+}
+
+// getPeriodHistory returns a user's portfolio history for a leaderboard period,
+// served from the cache when available so switching tabs doesn't refetch every user
+func getPeriodHistory(ctx context.Context, db *database.DB, c *cache.Cache, userID int, period string) (*alpaca.PortfolioHistory, error) {
+	p := leaderboardPeriods[period]
+
+	refreshFunc := func(ctx context.Context) (any, error) {
+		client, err := newClientForUser(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		return client.GetPortfolioHistory(ctx, p.Period, p.Timeframe)
+	}
+
+	if c == nil {
+		data, err := refreshFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return data.(*alpaca.PortfolioHistory), nil
+	}
+
+	cacheKey := fmt.Sprintf("history:%d:%s", userID, period)
+	data, err := c.GetOrSetWithRefresh(cacheKey, p.CacheTTL, refreshFunc)
+	if err != nil {
+		return nil, err
+	}
+	return data.(*alpaca.PortfolioHistory), nil
+}
@@ -7,16 +7,22 @@ import (
 	"strings"
 
 	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/live"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
 
 type ReactionsHandler struct {
-	db *database.DB
+	db  *database.DB
+	hub *live.Hub
 }
 
 func NewReactionsHandler(db *database.DB) *ReactionsHandler {
-	return &ReactionsHandler{db: db}
+	return &ReactionsHandler{db: db, hub: nil}
+}
+
+func (h *ReactionsHandler) SetHub(hub *live.Hub) {
+	h.hub = hub
 }
 
 func (h *ReactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -68,12 +74,20 @@ func (h *ReactionsHandler) toggleReaction(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	_, err := h.db.AddReaction(activityID, userID, req.Emoji)
+	if !requirePublishedTrade(w, h.db, activityID) {
+		return
+	}
+
+	added, err := h.db.AddReaction(activityID, userID, req.Emoji)
 	if err != nil {
 		log.Printf("Error toggling reaction: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	if added {
+		notifyReaction(h.db, h.hub, activityID, userID, req.Emoji)
+	}
+	publishReactions(h.hub, activityID)
 
 	reactionCounts, err := h.db.GetReactionCounts(activityID)
 	if err != nil {
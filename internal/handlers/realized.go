@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/fanout"
+	"github.com/skywall34/fantasy-trading/internal/metrics"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// Rows shown in the realized P&L panel
+const (
+	realizedTradesShown  = 10
+	realizedSymbolsShown = 10
+)
+
+// realizedPeriod is a window realized P&L is totalled over
+type realizedPeriod struct {
+	Label string
+	Since func(now time.Time) time.Time
+}
+
+// realizedPeriods are the windows shown in the realized P&L panel
+var realizedPeriods = []realizedPeriod{
+	{Label: "Today", Since: func(now time.Time) time.Time {
+		t := now.In(alpaca.MarketLocation)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, alpaca.MarketLocation)
+	}},
+	{Label: "7 days", Since: func(now time.Time) time.Time { return now.AddDate(0, 0, -7) }},
+	{Label: "30 days", Since: func(now time.Time) time.Time { return now.AddDate(0, 0, -30) }},
+	{Label: "All time", Since: func(time.Time) time.Time { return time.Time{} }},
+}
+
+// lotMethodFor returns a user's lot matching method, defaulting to FIFO
+func lotMethodFor(user *database.User) metrics.LotMethod {
+	method := metrics.LotMethod(user.LotMethod)
+	if !metrics.ValidLotMethod(method) {
+		return metrics.LotFIFO
+	}
+	return method
+}
+
+// fillsFromActivities converts Alpaca fill activities to metrics fills,
+// skipping any without a readable fill time
+func fillsFromActivities(activities []alpaca.Activity) []metrics.Fill {
+	fills := make([]metrics.Fill, 0, len(activities))
+	for _, act := range activities {
+		filledAt, err := time.Parse(time.RFC3339, act.TransactionTime)
+		if err != nil {
+			continue
+		}
+		fills = append(fills, metrics.Fill{
+			ID:     act.ID,
+			Symbol: act.Symbol,
+			Side:   act.Side,
+			Qty:    act.Qty.Float64(),
+			Price:  act.Price.Float64(),
+			Time:   filledAt,
+		})
+	}
+	return fills
+}
+
+// getRealizedTrades matches a user's recent fills into realized trades using
+// their lot matching method. Like the trading stats, only the most recent
+// maxMetricFills fills are replayed, and other traders only see trades built
+// from the fills the user has published.
+func getRealizedTrades(ctx context.Context, db *database.DB, c *cache.Cache, user *database.User, viewerID int) ([]metrics.RealizedTrade, error) {
+	var activities []alpaca.Activity
+	var err error
+	if user.ID == viewerID {
+		activities, err = getRecentTradesForUser(ctx, db, c, user.ID, maxMetricFills)
+	} else {
+		activities, err = getVisibleTradesForUser(ctx, db, c, user, maxMetricFills)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	method := lotMethodFor(user)
+	var selections map[string]string
+	if method == metrics.LotSpecific {
+		selections, err = db.GetLotSelections(user.ID)
+		if err != nil {
+			log.Printf("Failed to get lot selections for user %d: %v", user.ID, err)
+		}
+	}
+	return metrics.MatchLots(fillsFromActivities(activities), method, selections), nil
+}
+
+// getRealizedSales returns the realized trades for the sell fills among the
+// given activities, keyed by activity ID. Each seller's fills are matched
+// concurrently; sellers who can't be fetched in time are left unannotated.
+func getRealizedSales(ctx context.Context, db *database.DB, c *cache.Cache, activities []database.Activity, viewerID int) map[string]metrics.RealizedTrade {
+	var sellers []int
+	seen := make(map[int]bool)
+	for _, act := range activities {
+		if act.Side.String == "sell" && !seen[act.UserID] {
+			seen[act.UserID] = true
+			sellers = append(sellers, act.UserID)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fanoutTimeout)
+	defer cancel()
+
+	results := fanout.Run(ctx, fanoutWorkers, sellers, func(ctx context.Context, uid int) ([]metrics.RealizedTrade, error) {
+		user, err := db.GetUserByID(uid)
+		if err != nil {
+			return nil, err
+		}
+		trades, err := getRealizedTrades(ctx, db, c, user, viewerID)
+		if err != nil {
+			log.Printf("Failed to get realized trades for user %d: %v", uid, err)
+			return nil, err
+		}
+		return trades, nil
+	})
+
+	sales := make(map[string]metrics.RealizedTrade)
+	for _, trades := range results.Values {
+		for _, trade := range trades {
+			if trade.Side == "sell" {
+				sales[trade.ExitID] = trade
+			}
+		}
+	}
+	return sales
+}
+
+// convertRealized summarizes realized trades for the realized P&L panel.
+// Editable panels let the owner choose lots when using specific-lot matching.
+func convertRealized(trades []metrics.RealizedTrade, method metrics.LotMethod, showAmounts, editable bool, now time.Time) templates.RealizedData {
+	data := templates.RealizedData{
+		Method:      string(method),
+		ShowAmounts: showAmounts,
+		Editable:    editable && method == metrics.LotSpecific,
+	}
+
+	for _, period := range realizedPeriods {
+		r := metrics.SummarizeRealized(trades, period.Since(now))
+		data.Periods = append(data.Periods, templates.RealizedPeriodData{
+			Label:      period.Label,
+			Trades:     r.Trades,
+			PnL:        r.PnL,
+			PnLPercent: r.PnLPercent(),
+		})
+	}
+
+	for i, s := range metrics.RealizedBySymbol(trades, time.Time{}) {
+		if i >= realizedSymbolsShown {
+			break
+		}
+		data.Symbols = append(data.Symbols, templates.RealizedSymbolData{
+			Symbol:     s.Symbol,
+			Trades:     s.Trades,
+			PnL:        s.PnL,
+			PnLPercent: s.PnLPercent(),
+		})
+	}
+
+	recent := append([]metrics.RealizedTrade(nil), trades...)
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].Time.After(recent[j].Time)
+	})
+	for i, trade := range recent {
+		if i >= realizedTradesShown {
+			break
+		}
+		data.Trades = append(data.Trades, convertRealizedTrade(trade, data.Editable))
+	}
+	return data
+}
+
+// convertRealizedTrade converts a realized trade to template data
+func convertRealizedTrade(trade metrics.RealizedTrade, withCandidates bool) templates.RealizedTradeData {
+	lots := make([]string, 0, len(trade.Lots))
+	for _, l := range trade.Lots {
+		lots = append(lots, fmt.Sprintf("%s @ $%.2f (%s)", formatQty(l.Qty), l.Price, l.Time.In(alpaca.MarketLocation).Format("Jan 2")))
+	}
+
+	data := templates.RealizedTradeData{
+		ExitID:     trade.ExitID,
+		Symbol:     trade.Symbol,
+		Side:       trade.Side,
+		Qty:        trade.Qty,
+		Price:      trade.Price,
+		PnL:        trade.PnL,
+		PnLPercent: trade.PnLPercent(),
+		ClosedAt:   trade.Time.In(alpaca.MarketLocation).Format("Jan 2, 2006"),
+		Lots:       strings.Join(lots, ", "),
+	}
+	if withCandidates && len(trade.Candidates) > 1 {
+		for _, candidate := range trade.Candidates {
+			data.Candidates = append(data.Candidates, templates.LotOptionData{
+				EntryID:  candidate.EntryID,
+				Label:    fmt.Sprintf("%s @ $%.2f (%s)", formatQty(math.Abs(candidate.Qty)), candidate.Price, candidate.Time.In(alpaca.MarketLocation).Format("Jan 2")),
+				Selected: len(trade.Lots) > 0 && trade.Lots[0].EntryID == candidate.EntryID,
+			})
+		}
+	}
+	return data
+}
+
+// formatQty formats a share quantity without trailing zeros
+func formatQty(qty float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", qty), "0"), ".")
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+)
+
+func realizedFixture(accountID string) *alpacatest.Fixture {
+	now := time.Now()
+	return &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount(accountID, 100000, 100000),
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill(accountID+"-s1", "AAPL", "sell", 10, 120, now.Add(-1*time.Hour)),
+			alpacatest.NewFill(accountID+"-b2", "AAPL", "buy", 10, 110, now.Add(-2*time.Hour)),
+			alpacatest.NewFill(accountID+"-b1", "AAPL", "buy", 10, 100, now.Add(-3*time.Hour)),
+		},
+	}
+}
+
+func TestRealizedPnLOnDashboardAndFeed(t *testing.T) {
+	env := newTestEnv(t)
+	_, traderSession := env.addUser("PK1", "Trader", realizedFixture("acct-1"))
+	_, viewerSession := env.addUser("PK2", "Viewer", &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount("acct-2", 100000, 100000),
+	})
+
+	// First in, first out closes the $100 lot
+	body := env.serve(NewDashboardHandler(env.db), httptest.NewRequest(http.MethodGet, "/dashboard", nil), traderSession).Body.String()
+	for _, want := range []string{"Realized P&amp;L", "First in, first out", "+$200.00", "closed 10 @ $100.00"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the dashboard to contain %q", want)
+		}
+	}
+
+	// Other traders see the realized gain on the sale, as a percentage
+	// unless the seller shows amounts
+	req := httptest.NewRequest(http.MethodGet, "/activity", nil)
+	req.Header.Set("HX-Request", "true")
+	body = env.serve(NewActivityHandler(env.db), req, viewerSession).Body.String()
+	if !strings.Contains(body, "Realized") || !strings.Contains(body, "+20.00%") {
+		t.Error("Expected the sale to be annotated with its realized gain")
+	}
+	if strings.Contains(body, "+$200.00") {
+		t.Error("Expected the realized amount to stay hidden")
+	}
+}
+
+func TestSpecificLotSelection(t *testing.T) {
+	env := newTestEnv(t)
+	_, sessionID := env.addUser("PK1", "Trader", realizedFixture("acct-1"))
+
+	post := func(handler http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return env.serve(handler, req, sessionID)
+	}
+	selection := NewLotSelectionHandler(env.db)
+
+	choose := url.Values{"exit_id": {"acct-1-s1"}, "entry_id": {"acct-1-b2"}}
+	if rec := post(selection, "/api/lots/select", choose); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected lot selection to need specific-lot matching, got %d", rec.Code)
+	}
+
+	if rec := post(NewLotMethodHandler(env.db), "/api/profile/lot-method", url.Values{"lot_method": {"hifo"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown lot method to be rejected, got %d", rec.Code)
+	}
+	if rec := post(NewLotMethodHandler(env.db), "/api/profile/lot-method", url.Values{"lot_method": {"specific"}}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the lot method to be saved, got %d", rec.Code)
+	}
+
+	bogus := url.Values{"exit_id": {"acct-1-s1"}, "entry_id": {"acct-1-s1"}}
+	if rec := post(selection, "/api/lots/select", bogus); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a lot that wasn't open to be rejected, got %d", rec.Code)
+	}
+
+	rec := post(selection, "/api/lots/select", choose)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the selection to be saved, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "+$100.00") || !strings.Contains(body, "closed 10 @ $110.00") {
+		t.Error("Expected the sale to close the chosen $110 lot")
+	}
+}
@@ -3,12 +3,16 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/skywall34/fantasy-trading/internal/database"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
 
+// symbolSuggestionLimit caps the symbols suggested for a search
+const symbolSuggestionLimit = 8
+
 type SearchHandler struct {
 	db *database.DB
 }
@@ -33,6 +37,24 @@ func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	searchQuery := r.URL.Query().Get("q")
 
+	// Suggest symbols from the asset catalog as the user types
+	var symbols []templates.SymbolSuggestion
+	if strings.TrimSpace(searchQuery) != "" {
+		assets, err := h.db.SearchAssets(searchQuery, symbolSuggestionLimit)
+		if err != nil {
+			log.Printf("Error searching assets: %v", err)
+		}
+		for _, asset := range assets {
+			symbols = append(symbols, templates.SymbolSuggestion{
+				Symbol:       asset.Symbol,
+				Name:         asset.Name,
+				Exchange:     asset.Exchange,
+				AssetClass:   asset.AssetClass,
+				Fractionable: asset.Fractionable,
+			})
+		}
+	}
+
 	var results []templates.SearchResult
 	if searchQuery != "" && len(searchQuery) >= 2 {
 		users, err := h.db.SearchUsers(searchQuery, 20)
@@ -74,6 +96,7 @@ func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	data := templates.SearchData{
 		Query:   searchQuery,
+		Symbols: symbols,
 		Results: results,
 	}
 
@@ -98,6 +121,7 @@ func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ID:          user.ID,
 		DisplayName: displayName,
 		Initials:    initials,
+		IsAdmin:     user.IsAdmin,
 	}
 
 	if err := templates.SearchPage(templateUser, data).Render(r.Context(), w); err != nil {
@@ -59,18 +59,56 @@ func (h *SettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		currentNickname = user.Nickname.String
 	}
 
+	// Get starting equity audit trail
+	changes, err := h.db.GetStartingEquityHistory(userID)
+	if err != nil {
+		log.Printf("Failed to get starting equity history: %v", err)
+	}
+
+	// Get notification preferences
+	notificationPrefs, err := h.db.GetNotificationPreferences(userID)
+	if err != nil {
+		log.Printf("Failed to get notification preferences: %v", err)
+	}
+
+	data := templates.SettingsData{
+		Nickname:              currentNickname,
+		StartingEquity:        user.Baseline(),
+		StartingEquityHistory: convertStartingEquityChanges(changes),
+		Privacy:               convertPrivacySettings(user.Privacy()),
+		LotMethod:             string(lotMethodFor(user)),
+		Notifications:         convertNotificationPreferences(notificationPrefs),
+	}
+
 	// Create template user
 	templateUser := &templates.User{
 		ID:          user.ID,
 		DisplayName: displayName,
 		Initials:    initials,
+		IsAdmin:     user.IsAdmin,
 	}
 
 	// Render settings template
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	err = templates.Settings(templateUser, currentNickname).Render(r.Context(), w)
+	err = templates.Settings(templateUser, data).Render(r.Context(), w)
 	if err != nil {
 		log.Printf("Failed to render settings template: %v", err)
 		http.Error(w, "Failed to render settings", http.StatusInternalServerError)
 	}
 }
+
+// convertStartingEquityChanges converts starting equity audit entries to template data
+func convertStartingEquityChanges(changes []database.StartingEquityChange) []templates.StartingEquityChangeData {
+	changeData := make([]templates.StartingEquityChangeData, 0, len(changes))
+	for _, change := range changes {
+		changeData = append(changeData, templates.StartingEquityChangeData{
+			OldValue:  change.OldValue.Float64,
+			HasOld:    change.OldValue.Valid,
+			NewValue:  change.NewValue,
+			Source:    change.Source,
+			Reason:    change.Reason.String,
+			ChangedAt: change.CreatedAt.Format("Jan 2, 2006 3:04 PM"),
+		})
+	}
+	return changeData
+}
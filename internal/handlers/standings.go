@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	syncworker "github.com/skywall34/fantasy-trading/internal/sync"
+)
+
+// StandingsRecorder persists each period's leaderboard at the end of the
+// trading day, giving rank movement, days at #1 and rank history something
+// to compare against
+type StandingsRecorder struct {
+	db    *database.DB
+	cache *cache.Cache
+}
+
+// NewStandingsRecorder creates a recorder for end-of-day leaderboard standings
+func NewStandingsRecorder(db *database.DB) *StandingsRecorder {
+	return &StandingsRecorder{db: db, cache: nil}
+}
+
+func (s *StandingsRecorder) SetCache(c *cache.Cache) {
+	s.cache = c
+}
+
+// Record ranks every period and account mode and stores the standings under
+// day's trading date, replacing any recorded earlier that day. Days without a
+// trading session are skipped. Standings missing users whose data couldn't be
+// fetched are left for a retry to record in full, until the job's final
+// attempt, which stores the users it could rank.
+func (s *StandingsRecorder) Record(ctx context.Context, day time.Time) error {
+	date := alpaca.MarketDate(day)
+
+	// On market holidays the latest session is still the previous one, and
+	// recording it again would count it twice
+	open, err := s.hadSession(ctx, date)
+	if err != nil {
+		return err
+	}
+	if !open {
+		log.Printf("No trading session on %s; standings not recorded", date)
+		return nil
+	}
+
+	periods := make([]string, 0, len(leaderboardPeriods))
+	for period := range leaderboardPeriods {
+		periods = append(periods, period)
+	}
+	sort.Strings(periods)
+
+	var errs []error
+	for _, mode := range []string{"paper", "live"} {
+		for _, period := range periods {
+			standings, err := getStandings(ctx, s.db, s.cache, period, mode)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", mode, period, err))
+				continue
+			}
+			if standings.Unavailable > 0 {
+				errs = append(errs, fmt.Errorf("%s %s: %d users unavailable", mode, period, standings.Unavailable))
+				if !syncworker.IsFinalAttempt(ctx) {
+					continue
+				}
+			}
+
+			records := make([]database.LeaderboardStanding, 0, len(standings.Traders))
+			for _, t := range standings.Traders {
+				records = append(records, database.LeaderboardStanding{
+					UserID:      t.UserID,
+					Rank:        t.Rank,
+					Total:       len(standings.Traders),
+					GainPercent: t.GainPercent,
+				})
+			}
+			if err := s.db.SaveLeaderboardStandings(date, period, mode, records); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", mode, period, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// hadSession reports whether the market traded on date, judged by whether any
+// ranked user's daily portfolio history reaches it
+func (s *StandingsRecorder) hadSession(ctx context.Context, date string) (bool, error) {
+	for _, mode := range []string{"paper", "live"} {
+		daily, err := getStandings(ctx, s.db, s.cache, "daily", mode)
+		if err != nil {
+			return false, err
+		}
+		for _, t := range daily.Traders {
+			if alpaca.MarketDate(t.PeriodEnd) == date {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	syncworker "github.com/skywall34/fantasy-trading/internal/sync"
+)
+
+// tradedAt gives a leaderboard fixture a daily history whose session is at's
+// trading day, which is how the recorder tells trading days from holidays
+func tradedAt(fixture *alpacatest.Fixture, at time.Time) *alpacatest.Fixture {
+	equity := fixture.Account.Equity.Float64()
+	fixture.History["1D"] = &alpaca.PortfolioHistory{
+		Timestamp: []int64{at.Unix()},
+		Equity:    []float64{equity},
+		BaseValue: equity,
+		Timeframe: "15Min",
+	}
+	return fixture
+}
+
+func TestRecordedStandingsDriveRankMovement(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+	rocket, sessionID := env.addUser("PK1", "Rocket", tradedAt(leaderboardFixture("acct-1", false, 100000, 101000), now))
+	steady, _ := env.addUser("PK2", "Steady", tradedAt(leaderboardFixture("acct-2", false, 100000, 105000), now))
+
+	// Rocket finished yesterday in first place
+	yesterday := alpaca.MarketDate(time.Now().AddDate(0, 0, -1))
+	err := env.db.SaveLeaderboardStandings(yesterday, "weekly", "paper", []database.LeaderboardStanding{
+		{UserID: rocket.ID, Rank: 1, Total: 2, GainPercent: 3},
+		{UserID: steady.ID, Rank: 2, Total: 2, GainPercent: 2},
+	})
+	if err != nil {
+		t.Fatalf("SaveLeaderboardStandings: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/leaderboard?period=weekly", nil)
+	req.Header.Set("HX-Request", "true")
+	body := env.serve(NewLeaderboardHandler(env.db), req, sessionID).Body.String()
+	for _, want := range []string{"▲1", "▼1", "👑 1 day at #1"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected leaderboard to contain %q", want)
+		}
+	}
+
+	if err := NewStandingsRecorder(env.db).Record(context.Background(), time.Now()); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	history, err := env.db.GetRankHistory(steady.ID, "weekly", "paper", yesterday)
+	if err != nil {
+		t.Fatalf("GetRankHistory: %v", err)
+	}
+	if len(history) != 2 || history[0].Rank != 2 || history[1].Rank != 1 || history[1].Total != 2 {
+		t.Fatalf("Expected Steady to climb from #2 to #1, got %+v", history)
+	}
+
+	// Recording again the same day replaces rather than duplicates
+	if err := NewStandingsRecorder(env.db).Record(context.Background(), time.Now()); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	days, err := env.db.GetDaysAtFirst("weekly", "paper")
+	if err != nil {
+		t.Fatalf("GetDaysAtFirst: %v", err)
+	}
+	if days[steady.ID] != 1 || days[rocket.ID] != 1 {
+		t.Errorf("Expected one day at #1 each, got %v", days)
+	}
+
+	body = env.serve(NewUserHandler(env.db), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/user/%d", steady.ID), nil), sessionID).Body.String()
+	if !strings.Contains(body, `id="rankChart"`) {
+		t.Error("Expected the profile to chart the recorded rank history")
+	}
+}
+
+func TestStandingsSkipHolidaysAndPartialResults(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+	today := alpaca.MarketDate(now)
+	yesterday := alpaca.MarketDate(now.AddDate(0, 0, -1))
+
+	// On a holiday the latest session is still yesterday's
+	rocket, _ := env.addUser("PK1", "Rocket", tradedAt(leaderboardFixture("acct-1", false, 100000, 101000), now.AddDate(0, 0, -1)))
+	steady, _ := env.addUser("PK2", "Steady", tradedAt(leaderboardFixture("acct-2", false, 100000, 105000), now.AddDate(0, 0, -1)))
+
+	recorder := NewStandingsRecorder(env.db)
+	recorded := func(userID int) []database.LeaderboardStanding {
+		t.Helper()
+		history, err := env.db.GetRankHistory(userID, "weekly", "paper", yesterday)
+		if err != nil {
+			t.Fatalf("GetRankHistory: %v", err)
+		}
+		return history
+	}
+
+	if err := recorder.Record(context.Background(), now); err != nil {
+		t.Fatalf("Expected a holiday to be skipped without error, got %v", err)
+	}
+	if got := recorded(rocket.ID); len(got) != 0 {
+		t.Fatalf("Expected nothing recorded on a holiday, got %+v", got)
+	}
+
+	// A trading day with a user whose data can't be fetched is left for a retry
+	env.fake.Update("PK1", func(f *alpacatest.Fixture) { tradedAt(f, now) })
+	env.fake.Update("PK2", func(f *alpacatest.Fixture) {
+		tradedAt(f, now)
+		f.Status = http.StatusServiceUnavailable
+		f.RetryAfter = "0"
+	})
+	if err := recorder.Record(context.Background(), now); err == nil {
+		t.Fatal("Expected recording to fail while a user is unavailable")
+	}
+	if got := recorded(rocket.ID); len(got) != 0 {
+		t.Fatalf("Expected no partial standings recorded, got %+v", got)
+	}
+
+	// Out of retries, the users who could be ranked are kept
+	if err := recorder.Record(syncworker.WithFinalAttempt(context.Background()), now); err == nil {
+		t.Fatal("Expected the final attempt to still report the unavailable user")
+	}
+	if got := recorded(rocket.ID); len(got) != 1 || got[0].Total != 1 {
+		t.Fatalf("Expected the available user recorded alone, got %+v", got)
+	}
+	if got := recorded(steady.ID); len(got) != 0 {
+		t.Fatalf("Expected nothing recorded for the unavailable user, got %+v", got)
+	}
+
+	// A later full run replaces the partial standings
+	env.fake.Update("PK2", func(f *alpacatest.Fixture) { f.Status = 0 })
+	if err := recorder.Record(context.Background(), now); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	for _, userID := range []int{rocket.ID, steady.ID} {
+		if got := recorded(userID); len(got) != 1 || got[0].Date != today || got[0].Total != 2 {
+			t.Errorf("Expected user %d recorded today among two, got %+v", userID, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// StartingEquityHandler handles manual updates to a user's starting equity baseline
+type StartingEquityHandler struct {
+	db *database.DB
+}
+
+// NewStartingEquityHandler creates a new starting equity handler
+func NewStartingEquityHandler(db *database.DB) *StartingEquityHandler {
+	return &StartingEquityHandler{db: db}
+}
+
+// ServeHTTP handles starting equity update requests and returns the refreshed audit trail
+func (h *StartingEquityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	startingEquity, err := strconv.ParseFloat(strings.TrimSpace(r.FormValue("starting_equity")), 64)
+	if err != nil || math.IsNaN(startingEquity) || startingEquity <= 0 {
+		http.Error(w, "Starting equity must be a positive number", http.StatusBadRequest)
+		return
+	}
+	if startingEquity > database.MaxStartingEquity {
+		http.Error(w, fmt.Sprintf("Starting equity must be at most $%.0f", database.MaxStartingEquity), http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if len(reason) > 200 {
+		http.Error(w, "Reason must be 200 characters or less", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.SetStartingEquity(userID, startingEquity, database.StartingEquitySourceUser, &userID, reason); err != nil {
+		log.Printf("Failed to update starting equity: %v", err)
+		http.Error(w, "Failed to update starting equity", http.StatusInternalServerError)
+		return
+	}
+
+	changes, err := h.db.GetStartingEquityHistory(userID)
+	if err != nil {
+		log.Printf("Failed to get starting equity history: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.StartingEquityHistory(convertStartingEquityChanges(changes)).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering starting equity history: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
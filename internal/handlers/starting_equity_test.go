@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStartingEquityRejectsInvalidAmounts(t *testing.T) {
+	env := newTestEnv(t)
+	user, sessionID := env.addUser("PK1", "Alice", leaderboardFixture("acct-1", false, 100000))
+
+	post := func(amount string) int {
+		form := url.Values{"starting_equity": {amount}, "reason": {"Funded late"}}
+		req := httptest.NewRequest(http.MethodPost, "/api/profile/starting-equity", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return env.serve(NewStartingEquityHandler(env.db), req, sessionID).Code
+	}
+
+	for _, amount := range []string{"NaN", "Inf", "-Inf", "1e400", "0", "-5", "2000000000"} {
+		if code := post(amount); code != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected, got %d", amount, code)
+		}
+	}
+	if code := post("25000"); code != http.StatusOK {
+		t.Fatalf("Expected a valid amount to be saved, got %d", code)
+	}
+
+	updated, err := env.db.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if updated.Baseline() != 25000 {
+		t.Errorf("Expected only the valid amount to be saved, got %v", updated.Baseline())
+	}
+}
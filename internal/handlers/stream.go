@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/live"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// Live event types, which are also the SSE event names the browser listens for
+const (
+	liveTrade        = "trade"        // Data is a templates.ActivityFeedItem
+	liveReactions    = "reactions"    // Data is the activity ID
+	liveComment      = "comment"      // Data is a database.CommentWithUser
+	liveNotification = "notification" // sent to the recipient only
+	liveResync       = "resync"       // missed events can't be replayed; reload instead
+)
+
+const (
+	// streamRetry is how long the browser waits before reconnecting
+	streamRetry = 3 * time.Second
+	// streamKeepAlive is how often an idle stream sends a comment so proxies
+	// don't close it
+	streamKeepAlive = 25 * time.Second
+	// tradeWatchInterval is the least time between checks of one user's trades
+	tradeWatchInterval = 10 * time.Second
+	// liveFeedTrades is how many of a user's newest visible trades are
+	// watched, matching the feed's first page
+	liveFeedTrades = 21
+)
+
+// StreamHandler streams live updates to the browser as server-sent events.
+// Each event is rendered for the viewer as HTML fragments that HTMX swaps
+// into the page out of band.
+type StreamHandler struct {
+	db  *database.DB
+	hub *live.Hub
+}
+
+func NewStreamHandler(db *database.DB, hub *live.Hub) *StreamHandler {
+	return &StreamHandler{db: db, hub: hub}
+}
+
+// ServeHTTP handles GET /events. A reconnecting browser sends Last-Event-ID
+// and is replayed the events it missed.
+func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var lastID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		lastID, _ = strconv.ParseUint(header, 10, 64)
+	}
+
+	sub, replay, complete := h.hub.Subscribe(lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	if !complete {
+		fmt.Fprintf(w, "event: %s\ndata:\n\n", liveResync)
+	}
+	for _, e := range replay {
+		h.writeEvent(r.Context(), w, userID, e)
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("Event stream for user %d can't be flushed: %v", userID, err)
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind; the browser reconnects and replays
+				return
+			}
+			h.writeEvent(r.Context(), w, userID, e)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent renders an event for the viewer and writes it to the stream,
+// skipping events that aren't meant for them
+func (h *StreamHandler) writeEvent(ctx context.Context, w http.ResponseWriter, userID int, e live.Event) {
+	if !e.For(userID) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.renderEvent(ctx, &buf, userID, e); err != nil {
+		log.Printf("Error rendering %s event for user %d: %v", e.Type, userID, err)
+		return
+	}
+	if buf.Len() == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\n", e.ID, e.Type)
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// renderEvent renders the fragments for an event as the viewer should see
+// them: their own reactions highlighted, amounts on their own trades, and
+// their followed traders' trades in the following feed
+func (h *StreamHandler) renderEvent(ctx context.Context, buf *bytes.Buffer, userID int, e live.Event) error {
+	switch e.Type {
+	case liveTrade:
+		activity := e.Data.(templates.ActivityFeedItem)
+		activity.ShowAmounts = activity.ShowAmounts || activity.UserID == userID
+		following, err := h.db.IsFollowing(userID, activity.UserID)
+		if err != nil {
+			return err
+		}
+		return templates.LiveTrade(activity, following).Render(ctx, buf)
+
+	case liveReactions:
+		activityID := e.Data.(string)
+		counts, err := h.db.GetReactionCounts(activityID)
+		if err != nil {
+			return err
+		}
+		userReactions, err := h.db.GetUserReactionsForActivity(activityID, userID)
+		if err != nil {
+			return err
+		}
+		activity := templates.ActivityFeedItem{
+			ID:             activityID,
+			ReactionCounts: counts,
+			UserReactions:  userReactions,
+		}
+		return templates.LiveReactions(activity).Render(ctx, buf)
+
+	case liveComment:
+		comment := e.Data.(database.CommentWithUser)
+		count, err := h.db.GetCommentCount(comment.ActivityID)
+		if err != nil {
+			return err
+		}
+		return templates.LiveComment(comment, count, comment.UserID != userID).Render(ctx, buf)
+
+	case liveNotification:
+		unread, err := h.db.CountUnreadNotifications(userID)
+		if err != nil {
+			return err
+		}
+		return templates.LiveNotificationBadge(unread).Render(ctx, buf)
+	}
+	return nil
+}
+
+// publishComment pushes a new comment to everyone watching its trade
+func publishComment(db *database.DB, hub *live.Hub, comment *database.Comment) {
+	if hub == nil {
+		return
+	}
+	withUser, err := db.GetCommentWithUser(comment.ID)
+	if err != nil {
+		log.Printf("Failed to get comment %d for the live stream: %v", comment.ID, err)
+		return
+	}
+	hub.Publish(live.Event{Type: liveComment, Data: *withUser})
+}
+
+// publishReactions pushes a trade's changed reaction counts
+func publishReactions(hub *live.Hub, activityID string) {
+	hub.Publish(live.Event{Type: liveReactions, Data: activityID})
+}
+
+// TradeWatcher pushes trades onto the live feed as cache refreshes of users'
+// fills reveal them. The first look at a user only records what's already
+// visible, so a restart doesn't replay their history.
+type TradeWatcher struct {
+	db    *database.DB
+	cache *cache.Cache
+	hub   *live.Hub
+
+	mu      sync.Mutex
+	seen    map[int]map[string]bool // user ID -> visible trade IDs
+	checked map[int]time.Time
+}
+
+func NewTradeWatcher(db *database.DB, c *cache.Cache, hub *live.Hub) *TradeWatcher {
+	return &TradeWatcher{
+		db:      db,
+		cache:   c,
+		hub:     hub,
+		seen:    make(map[int]map[string]bool),
+		checked: make(map[int]time.Time),
+	}
+}
+
+// Refreshed is registered with the cache and checks the trades of the user
+// whose fills were just refreshed
+func (tw *TradeWatcher) Refreshed(key string) {
+	var userID int
+	if _, err := fmt.Sscanf(key, "activities:%d:", &userID); err != nil {
+		return
+	}
+
+	// Each refresh touches several of a user's cache entries; one check covers them
+	tw.mu.Lock()
+	if time.Since(tw.checked[userID]) < tradeWatchInterval {
+		tw.mu.Unlock()
+		return
+	}
+	tw.checked[userID] = time.Now()
+	tw.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fanoutTimeout)
+	defer cancel()
+	if err := tw.Check(ctx, userID); err != nil {
+		log.Printf("Failed to check user %d for new trades: %v", userID, err)
+	}
+}
+
+// Check publishes any of the user's trades that have become visible on the
+// feed since the last check
+func (tw *TradeWatcher) Check(ctx context.Context, userID int) error {
+	user, err := tw.db.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.IsPublic || user.HideFromFeed {
+		return nil
+	}
+
+	trades, err := getVisibleTradesForUser(ctx, tw.db, tw.cache, user, liveFeedTrades)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool, len(trades))
+	for _, act := range trades {
+		current[act.ID] = true
+	}
+
+	tw.mu.Lock()
+	seen, known := tw.seen[userID]
+	tw.seen[userID] = current
+	tw.mu.Unlock()
+	if !known {
+		return nil
+	}
+
+	// Oldest first, so the newest ends up on top of the feed
+	userName := "Unknown"
+	if user.DisplayName.Valid && user.DisplayName.String != "" {
+		userName = user.DisplayName.String
+	}
+
+	var published []database.PublishedTrade
+	var items []templates.ActivityFeedItem
+	for i := len(trades) - 1; i >= 0; i-- {
+		act := trades[i]
+		if seen[act.ID] {
+			continue
+		}
+
+		timeAgo := "recently"
+		if filledAt, err := time.Parse(time.RFC3339, act.TransactionTime); err == nil {
+			timeAgo = formatTimeAgo(filledAt)
+		}
+
+		published = append(published, database.PublishedTrade{ActivityID: act.ID, UserID: userID})
+		items = append(items, templates.ActivityFeedItem{
+			ID:             act.ID,
+			UserID:         userID,
+			UserName:       userName,
+			UserNickname:   user.Nickname.String,
+			Action:         act.Side,
+			Symbol:         act.Symbol,
+			AssetClass:     "us_equity",
+			Qty:            act.Qty.Float64(),
+			Price:          act.Price.Float64(),
+			TimeAgo:        timeAgo,
+			ReactionCounts: map[string]int{},
+			ShowAmounts:    user.ShowAmounts,
+		})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	// Pushed trades are open for comments and reactions like those the feed shows
+	if err := tw.db.PublishTrades(published); err != nil {
+		return err
+	}
+	addFeedItemNames(tw.db, items)
+	for _, item := range items {
+		tw.hub.Publish(live.Event{Type: liveTrade, Data: item})
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/live"
+)
+
+// readStream replays the stream from after lastID as the session's user,
+// hanging up shortly after the replay is written
+func readStream(env *testEnv, hub *live.Hub, lastID uint64, sessionID string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", fmt.Sprint(lastID))
+	rec := env.serve(NewStreamHandler(env.db, hub), req, sessionID)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		env.t.Fatalf("Expected an event stream, got %d %q", rec.Code, ct)
+	}
+	return rec.Body.String()
+}
+
+func TestStreamReplaysSocialEvents(t *testing.T) {
+	env := newTestEnv(t)
+	hub := live.NewHub(100)
+	now := time.Now()
+
+	_, aliceSession := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	})
+	_, bobSession := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+	_, carolSession := env.addUser("PK3", "Carol", leaderboardFixture("acct-3", false, 100000, 100000))
+
+	env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), aliceSession)
+
+	sub, _, _ := hub.Subscribe(0)
+	defer sub.Close()
+
+	comments := NewCommentsHandler(env.db)
+	comments.SetHub(hub)
+	form := url.Values{"content": {"Nice entry"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/activities/a-1/comments", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if rec := env.serve(comments, req, bobSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected comment to succeed, got %d", rec.Code)
+	}
+
+	reactions := NewReactionsHandler(env.db)
+	reactions.SetHub(hub)
+	req = httptest.NewRequest(http.MethodPost, "/api/activities/a-1/reactions", strings.NewReader(`{"emoji":"🚀"}`))
+	if rec := env.serve(reactions, req, bobSession); rec.Code != http.StatusOK {
+		t.Fatalf("Expected reaction to succeed, got %d", rec.Code)
+	}
+
+	first := <-sub.Events()
+	lastID := first.ID - 1
+
+	carol := readStream(env, hub, lastID, carolSession)
+	for _, want := range []string{"event: comment", "Nice entry", "comment-count-a-1", "event: reactions", "reactions-a-1", "🚀"} {
+		if !strings.Contains(carol, want) {
+			t.Errorf("Expected Carol's stream to contain %q:\n%s", want, carol)
+		}
+	}
+	if strings.Contains(carol, "event: notification") {
+		t.Error("Expected Alice's notifications to stay off Carol's stream")
+	}
+
+	alice := readStream(env, hub, lastID, aliceSession)
+	if !strings.Contains(alice, "event: notification") || !strings.Contains(alice, "notification-badge") {
+		t.Errorf("Expected Alice's stream to update her bell:\n%s", alice)
+	}
+	if !strings.Contains(alice, fmt.Sprintf("id: %d\n", first.ID)) {
+		t.Error("Expected events to carry their IDs for Last-Event-ID")
+	}
+
+	// Bob's own thread was re-rendered by his post, so only the count is pushed
+	bob := readStream(env, hub, lastID, bobSession)
+	if !strings.Contains(bob, "comment-count-a-1") || strings.Contains(bob, "Nice entry") {
+		t.Errorf("Expected Bob's stream to carry only the comment count:\n%s", bob)
+	}
+
+	if stale := readStream(env, hub, 1, carolSession); !strings.Contains(stale, "event: resync") {
+		t.Errorf("Expected an unreplayable Last-Event-ID to ask for a reload:\n%s", stale)
+	}
+}
+
+func TestTradeWatcherPushesNewTrades(t *testing.T) {
+	env := newTestEnv(t)
+	hub := live.NewHub(100)
+	now := time.Now()
+
+	fixture := &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	}
+	alice, _ := env.addUser("PK1", "Alice", fixture)
+	_, bobSession := env.addUser("PK2", "Bob", leaderboardFixture("acct-2", false, 100000, 100000))
+
+	sub, _, _ := hub.Subscribe(0)
+	defer sub.Close()
+
+	watcher := NewTradeWatcher(env.db, nil, hub)
+	if err := watcher.Check(context.Background(), alice.ID); err != nil {
+		t.Fatalf("Failed to check trades: %v", err)
+	}
+
+	fixture.Activities = append([]alpaca.Activity{alpacatest.NewFill("a-2", "TSLA", "sell", 2, 250, now)}, fixture.Activities...)
+	env.fake.SetFixture("PK1", fixture)
+	if err := watcher.Check(context.Background(), alice.ID); err != nil {
+		t.Fatalf("Failed to check trades: %v", err)
+	}
+
+	select {
+	case e := <-sub.Events():
+		if e.Type != liveTrade {
+			t.Fatalf("Expected a trade event, got %q", e.Type)
+		}
+		stream := readStream(env, hub, e.ID-1, bobSession)
+		if !strings.Contains(stream, "activity-a-2") || !strings.Contains(stream, "feed-all") || strings.Contains(stream, "activity-a-1") {
+			t.Errorf("Expected only the new trade pushed onto the feed:\n%s", stream)
+		}
+	default:
+		t.Fatal("Expected the new trade to be published, but the first look at a user should only set a baseline")
+	}
+
+	if published, _ := env.db.IsTradePublished("a-2"); !published {
+		t.Error("Expected the pushed trade to be open for comments")
+	}
+	if published, _ := env.db.IsTradePublished("a-1"); published {
+		t.Error("Expected the baseline trade to be left for the feed to publish")
+	}
+}
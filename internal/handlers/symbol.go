@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/fanout"
+	"github.com/skywall34/fantasy-trading/internal/middleware"
+	"github.com/skywall34/fantasy-trading/templates"
+)
+
+// symbolPattern matches the tickers symbol pages accept, including crypto
+// pairs like BTC/USD
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9./-]{1,20}$`)
+
+// symbolFlowDays are the windows offered for a symbol's net buy/sell flow
+var symbolFlowDays = []int{7, 30, 90}
+
+const (
+	defaultSymbolFlowDays = 30
+	symbolTradesShown     = 50
+)
+
+// SymbolHandler serves the page showing platform-wide activity on one ticker
+type SymbolHandler struct {
+	db    *database.DB
+	cache *cache.Cache
+}
+
+func NewSymbolHandler(db *database.DB) *SymbolHandler {
+	return &SymbolHandler{db: db, cache: nil}
+}
+
+func (h *SymbolHandler) SetCache(c *cache.Cache) {
+	h.cache = c
+}
+
+// symbolActivity is one trader's holding and trades in a symbol
+type symbolActivity struct {
+	User      *database.User
+	Position  *alpaca.Position
+	Trades    []alpaca.Activity
+	Published map[string]bool // trades visible to everyone, open for comments and reactions
+}
+
+func (h *SymbolHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	symbol := strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/symbol/"))
+	if !symbolPattern.MatchString(symbol) {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	days := defaultSymbolFlowDays
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil {
+		for _, option := range symbolFlowDays {
+			if d == option {
+				days = d
+			}
+		}
+	}
+
+	users, err := h.db.GetAllPublicUsers()
+	if err != nil {
+		log.Printf("Error getting public users: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	activity, unavailable := h.fetchSymbolActivity(r.Context(), users, symbol, userID)
+
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+
+	var holders []templates.SymbolHolderData
+	var trades []templates.SymbolTradeData
+	var published []database.PublishedTrade
+	publishable := make(map[string]bool)
+	tradeLabels := make(map[string]string)
+	flow := templates.SymbolFlowData{Days: days}
+	buyers := make(map[int]bool)
+	sellers := make(map[int]bool)
+
+	for _, a := range activity {
+		showAmounts := a.User.ShowAmounts || a.User.ID == userID
+
+		if a.Position != nil {
+			holders = append(holders, templates.SymbolHolderData{
+				UserID:        a.User.ID,
+				DisplayName:   getDisplayName(a.User),
+				Side:          a.Position.Side,
+				Qty:           a.Position.Qty.Abs().Float64(),
+				MarketValue:   a.Position.MarketValue.Float64(),
+				UnrealizedPct: a.Position.UnrealizedPLPC.Float64() * 100,
+				ShowAmounts:   showAmounts,
+			})
+		}
+
+		for _, act := range a.Trades {
+			filledAt, err := time.Parse(time.RFC3339, act.TransactionTime)
+			if err != nil {
+				continue
+			}
+			qty := act.Qty.Float64()
+
+			if !filledAt.Before(since) {
+				if act.Side == "buy" {
+					flow.Buys++
+					flow.BuyQty += qty
+					buyers[a.User.ID] = true
+				} else if act.Side == "sell" {
+					flow.Sells++
+					flow.SellQty += qty
+					sellers[a.User.ID] = true
+				}
+			}
+
+			trades = append(trades, templates.SymbolTradeData{
+				ID:          act.ID,
+				UserID:      a.User.ID,
+				DisplayName: getDisplayName(a.User),
+				Side:        act.Side,
+				Qty:         qty,
+				Price:       act.Price.Float64(),
+				FilledAt:    filledAt,
+				TimeAgo:     formatTimeAgo(filledAt),
+				ShowAmounts: showAmounts,
+			})
+			tradeLabels[act.ID] = tradeLabel(getDisplayName(a.User), act.Side, qty)
+			publishable[act.ID] = a.Published[act.ID]
+		}
+	}
+	flow.NetQty = flow.BuyQty - flow.SellQty
+	flow.Buyers = len(buyers)
+	flow.Sellers = len(sellers)
+
+	// Largest holdings first by quantity, newest trades first
+	sort.SliceStable(holders, func(i, j int) bool {
+		return holders[i].Qty > holders[j].Qty
+	})
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].FilledAt.After(trades[j].FilledAt)
+	})
+
+	// Comments cover every fetched trade in the symbol, not just the ones listed
+	activityIDs := make([]string, 0, len(trades))
+	for _, trade := range trades {
+		activityIDs = append(activityIDs, trade.ID)
+	}
+	comments, err := h.db.GetCommentsForActivities(activityIDs)
+	if err != nil {
+		log.Printf("Error getting comments for %s: %v", symbol, err)
+	}
+
+	if len(trades) > symbolTradesShown {
+		trades = trades[:symbolTradesShown]
+	}
+
+	// Trades shown here are open for comments and reactions, as in the feed.
+	// The viewer's own delayed or hidden fills stay unpublished.
+	for _, trade := range trades {
+		if publishable[trade.ID] {
+			published = append(published, database.PublishedTrade{ActivityID: trade.ID, UserID: trade.UserID})
+		}
+	}
+	if err := h.db.PublishTrades(published); err != nil {
+		log.Printf("Error publishing trades: %v", err)
+	}
+
+	commentData := make([]templates.SymbolCommentData, 0, len(comments))
+	for _, comment := range comments {
+		// Out of thread, a moderated comment's tombstone says nothing
+		if comment.Status != database.CommentVisible {
+			continue
+		}
+		name := comment.UserNickname
+		if name == "" {
+			name = comment.UserDisplayName
+		}
+		commentData = append(commentData, templates.SymbolCommentData{
+			UserID:   comment.UserID,
+			UserName: name,
+			Content:  comment.Content,
+			Mentions: comment.Mentions,
+			Trade:    tradeLabels[comment.ActivityID],
+			TimeAgo:  formatTimeAgo(comment.CreatedAt),
+		})
+	}
+
+	data := templates.SymbolPageData{
+		Symbol:      symbol,
+		Name:        getAssetNames(h.db, []string{symbol})[symbol],
+		Holders:     holders,
+		Trades:      trades,
+		Flow:        flow,
+		DayOptions:  symbolFlowDays,
+		Comments:    commentData,
+		Unavailable: unavailable,
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		if err := templates.SymbolSection(data).Render(r.Context(), w); err != nil {
+			log.Printf("Error rendering symbol section: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	if err := templates.SymbolPage(templateUserFor(user), data).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering symbol page: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// fetchSymbolActivity fetches every public trader's position and recent
+// trades in a symbol concurrently. Holdings and trades are left out for
+// traders who hide them, and other traders only see published fills and
+// positions. Traders with nothing in the symbol are skipped.
+func (h *SymbolHandler) fetchSymbolActivity(ctx context.Context, users []database.User, symbol string, viewerID int) ([]symbolActivity, int) {
+	ctx, cancel := context.WithTimeout(ctx, fanoutTimeout)
+	defer cancel()
+
+	results := fanout.Run(ctx, fanoutWorkers, users, func(ctx context.Context, u database.User) (symbolActivity, error) {
+		if _, err := h.db.GetLatestSession(u.ID); err != nil {
+			return symbolActivity{}, fanout.ErrSkip
+		}
+		self := u.ID == viewerID
+		result := symbolActivity{User: &u}
+
+		if !u.HidePositions || self {
+			positions, err := getOpenPositionsForUser(ctx, h.db, h.cache, u.ID)
+			if err != nil {
+				log.Printf("Failed to get positions for user %d: %v", u.ID, err)
+				return symbolActivity{}, err
+			}
+			var held []alpaca.Position
+			for _, pos := range positions {
+				if pos.Symbol == symbol {
+					held = append(held, pos)
+				}
+			}
+			if !self && len(held) > 0 {
+				if held, err = filterVisiblePositions(ctx, h.db, h.cache, &u, held); err != nil {
+					log.Printf("Failed to filter positions for user %d: %v", u.ID, err)
+				}
+			}
+			if len(held) > 0 {
+				result.Position = &held[0]
+			}
+		}
+
+		if !u.HideFromFeed || self {
+			// Traders see all their own fills, but only the ones everyone can
+			// see are published
+			var fills, visible []alpaca.Activity
+			var err error
+			if !u.HideFromFeed {
+				visible, err = getVisibleTradesForUser(ctx, h.db, h.cache, &u, maxMetricFills)
+			}
+			fills = visible
+			if err == nil && self {
+				fills, err = getRecentTradesForUser(ctx, h.db, h.cache, u.ID, maxMetricFills)
+			}
+			if err != nil {
+				log.Printf("Failed to get activities for user %d: %v", u.ID, err)
+				return symbolActivity{}, err
+			}
+			for _, act := range fills {
+				if act.Symbol == symbol {
+					result.Trades = append(result.Trades, act)
+				}
+			}
+			result.Published = make(map[string]bool)
+			for _, act := range visible {
+				if act.Symbol == symbol {
+					result.Published[act.ID] = true
+				}
+			}
+		}
+
+		if result.Position == nil && len(result.Trades) == 0 {
+			return symbolActivity{}, fanout.ErrSkip
+		}
+		return result, nil
+	})
+	if results.Partial() {
+		log.Printf("Symbol page for %s missing %d of %d users", symbol, results.Unavailable, len(users))
+	}
+	return results.Values, results.Unavailable
+}
+
+// tradeLabel describes a trade for the comments it received, e.g. "Alice bought 10"
+func tradeLabel(name, side string, qty float64) string {
+	action := "traded"
+	switch side {
+	case "buy":
+		action = "bought"
+	case "sell":
+		action = "sold"
+	}
+	return name + " " + action + " " + formatQty(qty)
+}
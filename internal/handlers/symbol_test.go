@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+func TestSymbolPage(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	alice := leaderboardFixture("acct-1", false, 100000, 101000)
+	alice.Positions = []alpaca.Position{alpacatest.NewPosition("NVDA", 15, 100, 120)}
+	alice.Activities = []alpaca.Activity{
+		alpacatest.NewFill("a-2", "NVDA", "buy", 5, 110, now.Add(-2*24*time.Hour)),
+		alpacatest.NewFill("a-1", "NVDA", "buy", 10, 100, now.Add(-60*24*time.Hour)),
+		alpacatest.NewFill("a-0", "AAPL", "buy", 1, 180, now.Add(-3*24*time.Hour)),
+	}
+	aliceUser, viewerSession := env.addUser("PK1", "Alice", alice)
+
+	bob := leaderboardFixture("acct-2", false, 100000, 99000)
+	bob.Activities = []alpaca.Activity{alpacatest.NewFill("b-1", "NVDA", "sell", 2, 125, now.Add(-24*time.Hour))}
+	env.addUser("PK2", "Bob", bob)
+
+	hidden := leaderboardFixture("acct-3", false, 100000, 100000)
+	hidden.Positions = []alpaca.Position{alpacatest.NewPosition("NVDA", 50, 90, 120)}
+	hiddenUser, _ := env.addUser("PK3", "Hidden", hidden)
+	if err := env.db.UpdatePrivacySettings(hiddenUser.ID, database.PrivacySettings{IsPublic: true, HidePositions: true}); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+
+	if _, err := env.db.CreateComment("b-1", aliceUser.ID, nil, "Taking profits already?"); err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+
+	rec := env.serve(NewSymbolHandler(env.db), httptest.NewRequest(http.MethodGet, "/symbol/nvda?days=7", nil), viewerSession)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+
+	// Over 7 days Alice bought 5 and Bob sold 2; Alice's older buy is outside the window
+	for _, want := range []string{"Alice", "Bob", "+3 shares", "1 trades by 1 traders", "Taking profits already?", "on Bob sold 2"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the symbol page to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "Hidden") {
+		t.Error("Expected a trader hiding positions to be left out of holders")
+	}
+	if strings.Contains(body, "AAPL") {
+		t.Error("Expected trades in other symbols to be left out")
+	}
+
+	rec = env.serve(NewSymbolHandler(env.db), httptest.NewRequest(http.MethodGet, "/symbol/not$valid", nil), viewerSession)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid symbol to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestSymbolPageKeepsOwnDelayedTradesUnpublished(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	delayed := leaderboardFixture("acct-1", false, 100000, 100000)
+	delayed.Activities = []alpaca.Activity{
+		alpacatest.NewFill("d-2", "NVDA", "buy", 1, 900, now.Add(-10*time.Minute)),
+		alpacatest.NewFill("d-1", "NVDA", "buy", 2, 880, now.Add(-2*time.Hour)),
+	}
+	user, sessionID := env.addUser("PK1", "Delayed", delayed)
+	settings := user.Privacy()
+	settings.TradeDelayMinutes = 60
+	if err := env.db.UpdatePrivacySettings(user.ID, settings); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+
+	rec := env.serve(NewSymbolHandler(env.db), httptest.NewRequest(http.MethodGet, "/symbol/NVDA", nil), sessionID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "@ $900.00") {
+		t.Errorf("Expected traders to see their own delayed fill:\n%s", rec.Body.String())
+	}
+
+	for id, want := range map[string]bool{"d-1": true, "d-2": false} {
+		published, err := env.db.IsTradePublished(id)
+		if err != nil {
+			t.Fatalf("IsTradePublished: %v", err)
+		}
+		if published != want {
+			t.Errorf("Expected trade %s published=%v, got %v", id, want, published)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/activities/d-2/reactions", strings.NewReader(`{"emoji":"🚀"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if rec := env.serve(NewReactionsHandler(env.db), req, sessionID); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected reacting to the delayed fill to be refused, got %d", rec.Code)
+	}
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,6 +14,7 @@ import (
 	"github.com/skywall34/fantasy-trading/internal/alpaca"
 	"github.com/skywall34/fantasy-trading/internal/cache"
 	"github.com/skywall34/fantasy-trading/internal/database"
+	"github.com/skywall34/fantasy-trading/internal/metrics"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
 	"github.com/skywall34/fantasy-trading/templates"
 )
@@ -74,8 +77,12 @@ func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		// Continue without live data
 	}
 
-	var positions []templates.PositionData
+	var alpacaPositions []alpaca.Position
 	var performanceData templates.PerformanceData
+	haveAccount := false
+
+	// Users can hide their holdings from others while still showing performance
+	positionsHidden := profileUser.HidePositions && !isOwnProfile
 
 	if session != nil {
 		// Try to use cache for account data
@@ -88,86 +95,110 @@ func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				if err != nil {
 					return nil, err
 				}
-				client := alpaca.NewClient(apiKey, apiSecret)
+				client := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(session.IsLive), revokeOnUnauthorized(h.db, profileUserID))
 				return client.GetAccount(ctx)
 			}
 
 			// Get account data with 60s TTL (on-demand refresh, no background)
 			if data, err := h.cache.GetOrSetWithRefresh(cacheKey, 60*time.Second, refreshFunc); err == nil {
 				account := data.(*alpaca.Account)
-				accountData := parseAccountData(account)
+				accountData := parseAccountData(account, profileUser.Baseline())
+				adjustForCashFlows(r.Context(), h.db, h.cache, profileUserID, profileUser.Baseline(), &accountData)
 				performanceData = templates.PerformanceData{
-					CurrentEquity: accountData.Equity,
-					GainAmount:    accountData.TotalGain,
+					CurrentEquity: accountData.Equity.Float64(),
+					GainAmount:    accountData.TotalGain.Float64(),
 					GainPercent:   accountData.TotalGainPct,
 				}
+				haveAccount = true
 			}
 
 			// Get positions (not cached - fetched on demand)
 			apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
-			if err == nil {
-				client := alpaca.NewClient(apiKey, apiSecret)
-				alpacaPositions, err := client.GetPositions(r.Context())
-				if err == nil {
-					positions = convertPositionsToTemplateData(alpacaPositions)
+			if err == nil && !positionsHidden {
+				client := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(session.IsLive), revokeOnUnauthorized(h.db, profileUserID))
+				if alpacaPositions, err = client.GetPositions(r.Context()); err != nil {
+					alpacaPositions = nil
 				}
 			}
 		} else {
 			// Fallback to direct API call if cache not available
 			apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
 			if err == nil {
-				client := alpaca.NewClient(apiKey, apiSecret)
+				client := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(session.IsLive), revokeOnUnauthorized(h.db, profileUserID))
 
 				// Get account info
 				account, err := client.GetAccount(r.Context())
 				if err == nil {
-					accountData := parseAccountData(account)
+					accountData := parseAccountData(account, profileUser.Baseline())
+					adjustForCashFlows(r.Context(), h.db, h.cache, profileUserID, profileUser.Baseline(), &accountData)
 					performanceData = templates.PerformanceData{
-						CurrentEquity: accountData.Equity,
-						GainAmount:    accountData.TotalGain,
+						CurrentEquity: accountData.Equity.Float64(),
+						GainAmount:    accountData.TotalGain.Float64(),
 						GainPercent:   accountData.TotalGainPct,
 					}
+					haveAccount = true
 
 					// Get positions
-					alpacaPositions, err := client.GetPositions(r.Context())
-					if err == nil {
-						positions = convertPositionsToTemplateData(alpacaPositions)
+					if !positionsHidden {
+						if alpacaPositions, err = client.GetPositions(r.Context()); err != nil {
+							alpacaPositions = nil
+						}
 					}
 				}
 			}
 		}
 	}
 
-	// Get recent activities from Alpaca
-	recentActivities := make([]templates.ActivityData, 0)
-	if session != nil {
-		var alpacaActivities []alpaca.Activity
-
-		// Try to use cache for activities
-		if h.cache != nil {
-			cacheKey := fmt.Sprintf("activities:%d", profileUserID)
+	// Without a session or a reachable account, show the portfolio the sync
+	// worker last captured
+	var syncedAt string
+	if !haveAccount {
+		if snapshot, err := h.db.GetLatestPortfolioSnapshot(profileUserID); err == nil {
+			accountData := parseAccountData(&alpaca.Account{
+				Equity:     alpaca.NewDecimalFromFloat(snapshot.Equity),
+				LastEquity: alpaca.NewDecimalFromFloat(snapshot.LastEquity),
+				Cash:       alpaca.NewDecimalFromFloat(snapshot.Cash),
+			}, profileUser.Baseline())
+			performanceData = templates.PerformanceData{
+				CurrentEquity: accountData.Equity.Float64(),
+				GainAmount:    accountData.TotalGain.Float64(),
+				GainPercent:   accountData.TotalGainPct,
+			}
+			syncedAt = snapshot.TakenAt.Local().Format("Jan 2, 3:04 PM")
 
-			// Define refresh function
-			refreshFunc := func(ctx context.Context) (any, error) {
-				apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
+			if !positionsHidden {
+				snapshotPositions, err := h.db.GetPositionSnapshots(snapshot.ID)
 				if err != nil {
-					return nil, err
+					log.Printf("Failed to get position snapshots for user %d: %v", profileUserID, err)
 				}
-				client := alpaca.NewClient(apiKey, apiSecret)
-				return client.GetActivities(ctx)
+				alpacaPositions = positionsFromSnapshots(snapshotPositions)
 			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to get portfolio snapshot for user %d: %v", profileUserID, err)
+		}
+	}
 
-			// Get activities with 30s TTL (on-demand refresh)
-			if data, err := h.cache.GetOrSetWithRefresh(cacheKey, 30*time.Second, refreshFunc); err == nil {
-				alpacaActivities = data.([]alpaca.Activity)
-			}
+	// Other traders only see positions whose entries the user has published
+	if !isOwnProfile && len(alpacaPositions) > 0 {
+		alpacaPositions, err = filterVisiblePositions(r.Context(), h.db, h.cache, profileUser, alpacaPositions)
+		if err != nil {
+			log.Printf("Failed to filter positions for user %d: %v", profileUserID, err)
+		}
+	}
+	positions := convertPositionsToTemplateData(h.db, alpacaPositions)
+
+	// Get recent activities from Alpaca, applying the user's trade delay for
+	// everyone but themselves
+	recentActivities := make([]templates.ActivityData, 0)
+	if session != nil {
+		var alpacaActivities []alpaca.Activity
+		if isOwnProfile {
+			alpacaActivities, err = getRecentTradesForUser(r.Context(), h.db, h.cache, profileUserID, 10)
 		} else {
-			// Fallback to direct API call if cache not available
-			apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
-			if err == nil {
-				client := alpaca.NewClient(apiKey, apiSecret)
-				alpacaActivities, _ = client.GetActivities(r.Context())
-			}
+			alpacaActivities, err = getVisibleTradesForUser(r.Context(), h.db, h.cache, profileUser, 10)
+		}
+		if err != nil {
+			log.Printf("Failed to get activities for user %d: %v", profileUserID, err)
 		}
 
 		// Convert up to 10 most recent activities
@@ -176,8 +207,8 @@ func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				break
 			}
 
-			qty, _ := strconv.ParseFloat(act.Qty, 64)
-			price, _ := strconv.ParseFloat(act.Price, 64)
+			qty := act.Qty.Float64()
+			price := act.Price.Float64()
 
 			action := "traded"
 			if act.Side == "buy" {
@@ -205,12 +236,60 @@ func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				TimeAgo:  timeAgo,
 			})
 		}
+		addActivityNames(h.db, recentActivities)
 	}
 
-	// Get user rank - for now set to 0 as it requires fetching all users
-	// Users can see their rank on the leaderboard page
-	var rank int = 0
-	var totalUsers int = 0
+	// Rank the user against their account mode's leaderboard, with their
+	// recorded end-of-day ranks over the last few months
+	rank := templates.RankData{Period: defaultRankingPeriod}
+	var rankHistory []templates.RankPointData
+	if session != nil {
+		rank, err = getUserRank(r.Context(), h.db, h.cache, profileUserID, session.IsLive, defaultRankingPeriod)
+		if err != nil {
+			log.Printf("Failed to rank user %d: %v", profileUserID, err)
+		}
+
+		since := alpaca.MarketDate(time.Now().AddDate(0, 0, -rankHistoryDays))
+		standings, err := h.db.GetRankHistory(profileUserID, defaultRankingPeriod, accountMode(session.IsLive), since)
+		if err != nil {
+			log.Printf("Failed to get rank history for user %d: %v", profileUserID, err)
+		}
+		for _, standing := range standings {
+			rankHistory = append(rankHistory, templates.RankPointData{
+				Date:  standing.Date,
+				Rank:  standing.Rank,
+				Total: standing.Total,
+			})
+		}
+	}
+
+	// Risk-adjusted statistics over the user's whole history
+	var performanceMetrics templates.MetricsData
+	if session != nil {
+		var risk metrics.Risk
+		if history, err := getPeriodHistory(r.Context(), h.db, h.cache, profileUserID, "all"); err == nil {
+			risk = riskFromHistory(history)
+		} else {
+			log.Printf("Failed to get portfolio history for user %d: %v", profileUserID, err)
+		}
+		trading, err := getTradingStats(r.Context(), h.db, h.cache, profileUser, time.Time{}, currentUserID)
+		if err != nil {
+			log.Printf("Failed to get trading stats for user %d: %v", profileUserID, err)
+		}
+		performanceMetrics = convertMetrics(risk, trading)
+	}
+
+	// Realized P&L from closed trades, built from published fills for other traders
+	var realized *templates.RealizedData
+	if session != nil {
+		trades, err := getRealizedTrades(r.Context(), h.db, h.cache, profileUser, currentUserID)
+		if err != nil {
+			log.Printf("Failed to get realized trades for user %d: %v", profileUserID, err)
+		} else {
+			data := convertRealized(trades, lotMethodFor(profileUser), profileUser.ShowAmounts || isOwnProfile, false, time.Now())
+			realized = &data
+		}
+	}
 
 	// Get follower/following counts
 	followerCount, _ := h.db.GetFollowerCount(profileUserID)
@@ -241,6 +320,8 @@ func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		IsPublic:    profileUser.IsPublic,
 		ShowAmounts: profileUser.ShowAmounts,
 		MemberSince: memberSince,
+
+		PositionsHidden: positionsHidden,
 	}
 
 	data := templates.UserProfileData{
@@ -248,13 +329,16 @@ func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		IsOwnProfile:     isOwnProfile,
 		CurrentUserID:    currentUserID,
 		Rank:             rank,
-		TotalUsers:       totalUsers,
+		RankHistory:      rankHistory,
 		Positions:        positions,
 		RecentActivities: recentActivities,
 		PerformanceData:  performanceData,
+		Metrics:          performanceMetrics,
+		Realized:         realized,
 		FollowerCount:    followerCount,
 		FollowingCount:   followingCount,
 		IsFollowing:      isFollowing,
+		SyncedAt:         syncedAt,
 	}
 
 	// Prepare template user
@@ -269,6 +353,7 @@ func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ID:          currentUser.ID,
 		DisplayName: currentDisplayName,
 		Initials:    initials,
+		IsAdmin:     currentUser.IsAdmin,
 	}
 
 	// Render template
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+func TestProfileFallsBackToLastSnapshot(t *testing.T) {
+	env := newTestEnv(t)
+	_, viewerSession := env.addUser("PK1", "Viewer", leaderboardFixture("acct-1", false, 100000, 101000))
+	trader, traderSession := env.addUser("PK2", "Trader", leaderboardFixture("acct-2", false, 100000, 100000))
+
+	if err := env.db.UpdatePrivacySettings(trader.ID, database.PrivacySettings{IsPublic: true, ShowAmounts: true}); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+	_, err := env.db.CreatePortfolioSnapshot(
+		database.PortfolioSnapshot{UserID: trader.ID, Equity: 112000, LastEquity: 111000, Cash: 10000},
+		[]database.PositionSnapshot{{Symbol: "AAPL", AssetClass: "us_equity", Qty: 10, AvgEntryPrice: 150, MarketValue: 2000, UnrealizedPL: 500}},
+	)
+	if err != nil {
+		t.Fatalf("CreatePortfolioSnapshot: %v", err)
+	}
+	if err := env.db.DeleteSession(traderSession); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+
+	rec := env.serve(NewUserHandler(env.db), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/user/%d", trader.ID), nil), viewerSession)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "$112000.00") || !strings.Contains(body, "+12.00%") {
+		t.Error("Expected performance from the last snapshot")
+	}
+	if !strings.Contains(body, "AAPL") || !strings.Contains(body, "As of ") {
+		t.Error("Expected the snapshot's positions marked with when they were synced")
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+// maxVisibilityScan bounds how many of a user's fills are scanned to fill a
+// page when many of their recent trades are hidden
+const maxVisibilityScan = 400
+
+// tradeVisibility decides which of a user's trades other traders may see
+type tradeVisibility struct {
+	// cutoff is when the newest visible trade may have filled; zero means no delay
+	cutoff time.Time
+	// openEntrySides maps each hidden open position's symbol to the side of the
+	// fills that opened it ("buy" for longs, "sell" for shorts)
+	openEntrySides map[string]string
+}
+
+// visible reports whether a fill may be shown to other traders
+func (v tradeVisibility) visible(act alpaca.Activity) bool {
+	if !v.cutoff.IsZero() {
+		filledAt, err := time.Parse(time.RFC3339, act.TransactionTime)
+		if err != nil || filledAt.After(v.cutoff) {
+			return false
+		}
+	}
+	if side, open := v.openEntrySides[act.Symbol]; open && act.Side == side {
+		return false
+	}
+	return true
+}
+
+// restricted reports whether any of the user's trades can be hidden
+func (v tradeVisibility) restricted() bool {
+	return !v.cutoff.IsZero() || v.openEntrySides != nil
+}
+
+// visibilityForUser builds the visibility rules for a user's trades from their
+// privacy settings
+func visibilityForUser(ctx context.Context, db *database.DB, c *cache.Cache, user *database.User, now time.Time) (tradeVisibility, error) {
+	var v tradeVisibility
+
+	if delay := user.TradeDelay(); delay > 0 {
+		v.cutoff = now.Add(-delay)
+	}
+
+	if user.HideOpenEntries {
+		positions, err := getOpenPositionsForUser(ctx, db, c, user.ID)
+		if err != nil {
+			return v, err
+		}
+		v.openEntrySides = make(map[string]string, len(positions))
+		for _, pos := range positions {
+			side := "buy"
+			if pos.Side == "short" {
+				side = "sell"
+			}
+			v.openEntrySides[pos.Symbol] = side
+		}
+	}
+
+	return v, nil
+}
+
+// getVisibleTradesForUser returns up to limit of the user's most recent fills
+// that other traders may see, newest first
+func getVisibleTradesForUser(ctx context.Context, db *database.DB, c *cache.Cache, user *database.User, limit int) ([]alpaca.Activity, error) {
+	v, err := visibilityForUser(ctx, db, c, user, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !v.restricted() {
+		return getRecentTradesForUser(ctx, db, c, user.ID, limit)
+	}
+
+	// Delayed fills and hidden open entries thin out the newest fills, so
+	// widen the window until the page is full or the user's history runs out.
+	// The cutoff is applied here rather than upstream so the cached lists stay
+	// the same as it moves.
+	for fetch := limit; ; fetch *= 2 {
+		trades, err := getRecentTradesForUser(ctx, db, c, user.ID, fetch)
+		if err != nil {
+			return nil, err
+		}
+
+		visible := make([]alpaca.Activity, 0, limit)
+		for _, act := range trades {
+			if v.visible(act) {
+				visible = append(visible, act)
+				if len(visible) == limit {
+					return visible, nil
+				}
+			}
+		}
+
+		if len(trades) < fetch || fetch >= maxVisibilityScan {
+			return visible, nil
+		}
+	}
+}
+
+// filterVisiblePositions drops positions whose entries other traders can't
+// see yet: all of them while open entries are hidden, otherwise those traded
+// inside the delay window
+func filterVisiblePositions(ctx context.Context, db *database.DB, c *cache.Cache, user *database.User, positions []alpaca.Position) ([]alpaca.Position, error) {
+	if user.HideOpenEntries {
+		return nil, nil
+	}
+
+	delay := user.TradeDelay()
+	if delay <= 0 {
+		return positions, nil
+	}
+
+	recent, err := getRecentTradesForUser(ctx, db, c, user.ID, maxVisibilityScan)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-delay)
+	recentlyTraded := make(map[string]bool)
+	for _, act := range recent {
+		filledAt, err := time.Parse(time.RFC3339, act.TransactionTime)
+		if err != nil || filledAt.After(cutoff) {
+			recentlyTraded[act.Symbol] = true
+		}
+	}
+
+	visible := make([]alpaca.Position, 0, len(positions))
+	for _, pos := range positions {
+		if !recentlyTraded[pos.Symbol] {
+			visible = append(visible, pos)
+		}
+	}
+	return visible, nil
+}
+
+// requirePublishedTrade rejects comments and reactions on trades the feed
+// hasn't shown yet, so a delayed trade can't be discovered through them. It
+// reports whether the request may continue.
+func requirePublishedTrade(w http.ResponseWriter, db *database.DB, activityID string) bool {
+	published, err := db.IsTradePublished(activityID)
+	if err != nil {
+		log.Printf("Error checking trade %s: %v", activityID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if !published {
+		http.Error(w, "Trade not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/alpaca/alpacatest"
+	"github.com/skywall34/fantasy-trading/internal/cache"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+func TestActivityFeedAppliesTradeVisibility(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	_, sessionID := env.addUser("PK1", "Viewer", leaderboardFixture("acct-1", false, 100000, 101000))
+	delayed, _ := env.addUser("PK2", "Delayed", &alpacatest.Fixture{
+		Secret:  "secret",
+		Account: alpacatest.NewAccount("acct-2", 100000, 100000),
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill("d-2", "NVDA", "buy", 1, 900, now.Add(-10*time.Minute)),
+			alpacatest.NewFill("d-1", "MSFT", "buy", 1, 400, now.Add(-2*time.Hour)),
+		},
+	})
+	holder, _ := env.addUser("PK3", "Holder", &alpacatest.Fixture{
+		Secret:    "secret",
+		Account:   alpacatest.NewAccount("acct-3", 100000, 100000),
+		Positions: []alpaca.Position{alpacatest.NewPosition("AMD", 10, 150, 160)},
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill("h-2", "AMD", "buy", 10, 150, now.Add(-30*time.Minute)),
+			alpacatest.NewFill("h-1", "INTC", "sell", 5, 30, now.Add(-3*time.Hour)),
+		},
+	})
+
+	delayedSettings := delayed.Privacy()
+	delayedSettings.TradeDelayMinutes = 60
+	holderSettings := holder.Privacy()
+	holderSettings.HideOpenEntries = true
+	for id, settings := range map[int]database.PrivacySettings{delayed.ID: delayedSettings, holder.ID: holderSettings} {
+		if err := env.db.UpdatePrivacySettings(id, settings); err != nil {
+			t.Fatalf("UpdatePrivacySettings: %v", err)
+		}
+	}
+
+	rec := env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), sessionID)
+	body := rec.Body.String()
+
+	for _, symbol := range []string{"MSFT", "INTC"} {
+		if !strings.Contains(body, symbol) {
+			t.Errorf("Expected %s to be visible in the feed", symbol)
+		}
+	}
+	if strings.Contains(body, "NVDA") {
+		t.Error("Expected a trade inside the delay window to be hidden")
+	}
+	if strings.Contains(body, "AMD") {
+		t.Error("Expected the entry of an open position to be hidden")
+	}
+
+	for id, want := range map[string]bool{"d-1": true, "h-1": true, "d-2": false, "h-2": false} {
+		published, err := env.db.IsTradePublished(id)
+		if err != nil {
+			t.Fatalf("IsTradePublished: %v", err)
+		}
+		if published != want {
+			t.Errorf("Expected trade %s published=%v, got %v", id, want, published)
+		}
+	}
+}
+
+func TestCommentsRequirePublishedTrade(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+	_, sessionID := env.addUser("PK1", "Alice", &alpacatest.Fixture{
+		Secret:     "secret",
+		Account:    alpacatest.NewAccount("acct-1", 100000, 100000),
+		Activities: []alpaca.Activity{alpacatest.NewFill("a-1", "AAPL", "buy", 5, 190, now.Add(-time.Hour))},
+	})
+
+	comment := func() int {
+		form := url.Values{"content": {"Nice entry"}}
+		req := httptest.NewRequest(http.MethodPost, "/api/activities/a-1/comments", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return env.serve(NewCommentsHandler(env.db), req, sessionID).Code
+	}
+
+	if code := comment(); code != http.StatusNotFound {
+		t.Errorf("Expected 404 before the trade is published, got %d", code)
+	}
+
+	env.serve(NewActivityHandler(env.db), httptest.NewRequest(http.MethodGet, "/activity", nil), sessionID)
+
+	if code := comment(); code != http.StatusOK {
+		t.Errorf("Expected 200 once the feed has shown the trade, got %d", code)
+	}
+}
+
+func TestDelayedTradesReuseCachedFills(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	delayed, _ := env.addUser("PK1", "Delayed", &alpacatest.Fixture{
+		Secret:    "secret",
+		Account:   alpacatest.NewAccount("acct-1", 100000, 100000),
+		Positions: []alpaca.Position{alpacatest.NewPosition("NVDA", 1, 900, 950), alpacatest.NewPosition("MSFT", 1, 400, 410)},
+		Activities: []alpaca.Activity{
+			alpacatest.NewFill("d-2", "NVDA", "buy", 1, 900, now.Add(-10*time.Minute)),
+			alpacatest.NewFill("d-1", "MSFT", "buy", 1, 400, now.Add(-2*time.Hour)),
+		},
+	})
+	settings := delayed.Privacy()
+	settings.TradeDelayMinutes = 60
+	if err := env.db.UpdatePrivacySettings(delayed.ID, settings); err != nil {
+		t.Fatalf("UpdatePrivacySettings: %v", err)
+	}
+	delayed, err := env.db.GetUserByID(delayed.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+
+	c := cache.NewCache(time.Minute, 10*time.Second)
+	defer c.Stop()
+
+	view := func() {
+		t.Helper()
+		trades, err := getVisibleTradesForUser(context.Background(), env.db, c, delayed, 10)
+		if err != nil || len(trades) != 1 || trades[0].ID != "d-1" {
+			t.Fatalf("Expected only the fill outside the delay, got %v (%v)", trades, err)
+		}
+		positions, err := filterVisiblePositions(context.Background(), env.db, c, delayed, []alpaca.Position{alpacatest.NewPosition("NVDA", 1, 900, 950), alpacatest.NewPosition("MSFT", 1, 400, 410)})
+		if err != nil || len(positions) != 1 || positions[0].Symbol != "MSFT" {
+			t.Fatalf("Expected only the position traded outside the delay, got %v (%v)", positions, err)
+		}
+	}
+
+	// Later views are served from the same entries however the cutoff moves
+	view()
+	fetched := env.fake.RequestCount("/v2/account/activities")
+	view()
+	if got := env.fake.RequestCount("/v2/account/activities"); got != fetched {
+		t.Errorf("Expected later views to reuse cached fills, got %d requests after %d", got, fetched)
+	}
+}
@@ -0,0 +1,129 @@
+// Package live fans events out to connected browsers, keeping a short backlog
+// so a client that reconnects can catch up on what it missed.
+package live
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events may queue for a subscriber before it
+// is dropped as too slow; its client reconnects and replays from the backlog
+const subscriberBuffer = 64
+
+// Event is one update pushed to subscribers
+type Event struct {
+	ID     uint64
+	Type   string
+	UserID int // when non-zero, only this user should receive the event
+	Data   any
+}
+
+// For reports whether the event should be delivered to the user
+func (e Event) For(userID int) bool {
+	return e.UserID == 0 || e.UserID == userID
+}
+
+// Hub is an in-process publish/subscribe hub. A nil Hub discards events, so
+// publishers don't need to check whether live updates are enabled.
+type Hub struct {
+	mu      sync.Mutex
+	lastID  uint64
+	backlog []Event // oldest first
+	size    int
+	subs    map[*Subscription]struct{}
+}
+
+// NewHub creates a hub that keeps the last backlog events for replay. Event
+// IDs start from the current time so IDs from before a restart are never
+// mistaken for new ones.
+func NewHub(backlog int) *Hub {
+	return &Hub{
+		lastID: uint64(time.Now().UnixNano()),
+		size:   backlog,
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the event the next ID and delivers it to every subscriber
+func (h *Hub) Publish(e Event) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e.ID = h.lastID
+
+	h.backlog = append(h.backlog, e)
+	if len(h.backlog) > h.size {
+		h.backlog = h.backlog[len(h.backlog)-h.size:]
+	}
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- e:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// Subscribe registers a subscriber. When lastID is non-zero, the events
+// published after it are returned for replay; complete is false when some of
+// them have already left the backlog (or came from before a restart), so the
+// client should reload instead.
+func (h *Hub) Subscribe(lastID uint64) (sub *Subscription, replay []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscription{ch: make(chan Event, subscriberBuffer), hub: h}
+	h.subs[sub] = struct{}{}
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+	if lastID > h.lastID {
+		return sub, nil, false
+	}
+
+	oldest := h.lastID + 1
+	if len(h.backlog) > 0 {
+		oldest = h.backlog[0].ID
+	}
+	for _, e := range h.backlog {
+		if e.ID > lastID {
+			replay = append(replay, e)
+		}
+	}
+	return sub, replay, lastID+1 >= oldest
+}
+
+// remove unregisters a subscriber and closes its channel. Callers hold h.mu.
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Subscription receives a hub's events until it is closed
+type Subscription struct {
+	ch  chan Event
+	hub *Hub
+}
+
+// Events returns the channel events arrive on. It is closed when the
+// subscription is closed or falls too far behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close unregisters the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
@@ -0,0 +1,77 @@
+package live
+
+import "testing"
+
+func TestHubDeliversAndReplays(t *testing.T) {
+	hub := NewHub(3)
+
+	sub, replay, complete := hub.Subscribe(0)
+	defer sub.Close()
+	if len(replay) != 0 || !complete {
+		t.Fatalf("Expected a fresh subscription to start empty, got %d events", len(replay))
+	}
+
+	for _, typ := range []string{"a", "b", "c", "d"} {
+		hub.Publish(Event{Type: typ})
+	}
+
+	var ids []uint64
+	for range 4 {
+		e := <-sub.Events()
+		ids = append(ids, e.ID)
+	}
+	if ids[3] != ids[0]+3 {
+		t.Fatalf("Expected consecutive IDs, got %v", ids)
+	}
+
+	// The backlog holds b, c and d
+	replaySub, replay, complete := hub.Subscribe(ids[1])
+	defer replaySub.Close()
+	if !complete || len(replay) != 2 || replay[0].Type != "c" || replay[1].Type != "d" {
+		t.Errorf("Expected c and d replayed, got %+v (complete %v)", replay, complete)
+	}
+
+	gapSub, replay, complete := hub.Subscribe(ids[0] - 1)
+	defer gapSub.Close()
+	if complete || len(replay) != 3 {
+		t.Errorf("Expected an incomplete replay of the backlog, got %d events (complete %v)", len(replay), complete)
+	}
+
+	restartSub, _, complete := hub.Subscribe(ids[3] + 100)
+	defer restartSub.Close()
+	if complete {
+		t.Error("Expected an ID from the future to need a reload")
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(1)
+	sub, _, _ := hub.Subscribe(0)
+
+	for range subscriberBuffer + 1 {
+		hub.Publish(Event{Type: "tick"})
+	}
+
+	received := 0
+	for range sub.Events() {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("Expected the channel to close after %d events, got %d", subscriberBuffer, received)
+	}
+
+	// Closing an already dropped subscription is harmless
+	sub.Close()
+
+	var nilHub *Hub
+	nilHub.Publish(Event{Type: "ignored"})
+}
+
+func TestEventFor(t *testing.T) {
+	if !(Event{}).For(7) {
+		t.Error("Expected a broadcast event to reach everyone")
+	}
+	if (Event{UserID: 3}).For(7) || !(Event{UserID: 7}).For(7) {
+		t.Error("Expected a targeted event to reach only its user")
+	}
+}
@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// LotMethod chooses which open lots an exit closes first
+type LotMethod string
+
+const (
+	LotFIFO     LotMethod = "fifo"     // oldest entry first
+	LotLIFO     LotMethod = "lifo"     // newest entry first
+	LotSpecific LotMethod = "specific" // the entry chosen for each exit, then oldest first
+)
+
+// ValidLotMethod reports whether m is a supported lot matching method
+func ValidLotMethod(m LotMethod) bool {
+	return m == LotFIFO || m == LotLIFO || m == LotSpecific
+}
+
+// OpenLot is the open remainder of an entry fill
+type OpenLot struct {
+	EntryID string
+	Qty     float64 // positive for longs, negative for shorts
+	Price   float64
+	Time    time.Time
+}
+
+// ClosedLot is the part of an entry an exit closed
+type ClosedLot struct {
+	EntryID string
+	Qty     float64
+	Price   float64
+	Time    time.Time
+}
+
+// RealizedTrade is an exit fill and the profit it locked in against the
+// entries it closed
+type RealizedTrade struct {
+	ExitID string
+	Symbol string
+	Side   string // side of the exit: "sell" closes a long, "buy" covers a short
+	Qty    float64
+	Price  float64
+	Time   time.Time
+	Cost   float64 // entry value of the closed quantity
+	PnL    float64
+	Lots   []ClosedLot
+
+	// Candidates are the lots that were open when the exit filled, for
+	// choosing a specific lot
+	Candidates []OpenLot
+}
+
+// PnLPercent is the realized profit as a share of the closed entries' cost
+func (t RealizedTrade) PnLPercent() float64 {
+	if t.Cost == 0 {
+		return 0
+	}
+	return t.PnL / t.Cost * 100
+}
+
+// MatchLots replays fills in time order, closing open lots of the same
+// symbol with each opposing fill. Longs open with buys and shorts with sells.
+// With LotSpecific, selections maps an exit fill's ID to the entry fill it
+// should close first. Exits whose entries predate the fills open a new lot
+// rather than realizing anything.
+func MatchLots(fills []Fill, method LotMethod, selections map[string]string) []RealizedTrade {
+	sorted := make([]Fill, len(fills))
+	copy(sorted, fills)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	open := make(map[string][]OpenLot)
+	var trades []RealizedTrade
+
+	for _, fill := range sorted {
+		qty := fill.Qty
+		if fill.Side == "sell" {
+			qty = -qty
+		}
+
+		lots := open[fill.Symbol]
+		if len(lots) == 0 || (lots[0].Qty > 0) == (qty > 0) {
+			if abs(qty) > epsilon {
+				open[fill.Symbol] = append(lots, OpenLot{EntryID: fill.ID, Qty: qty, Price: fill.Price, Time: fill.Time})
+			}
+			continue
+		}
+
+		trade := RealizedTrade{
+			ExitID:     fill.ID,
+			Symbol:     fill.Symbol,
+			Side:       fill.Side,
+			Price:      fill.Price,
+			Time:       fill.Time,
+			Candidates: append([]OpenLot(nil), lots...),
+		}
+		for _, i := range closeOrder(lots, method, selections[fill.ID]) {
+			if abs(qty) <= epsilon {
+				break
+			}
+			matched := min(abs(lots[i].Qty), abs(qty))
+			direction := 1.0
+			if lots[i].Qty < 0 {
+				direction = -1
+			}
+
+			trade.Qty += matched
+			trade.Cost += lots[i].Price * matched
+			trade.PnL += (fill.Price - lots[i].Price) * matched * direction
+			trade.Lots = append(trade.Lots, ClosedLot{EntryID: lots[i].EntryID, Qty: matched, Price: lots[i].Price, Time: lots[i].Time})
+
+			lots[i].Qty -= matched * direction
+			qty += matched * direction
+		}
+		trades = append(trades, trade)
+
+		remaining := lots[:0]
+		for _, l := range lots {
+			if abs(l.Qty) > epsilon {
+				remaining = append(remaining, l)
+			}
+		}
+		if abs(qty) > epsilon {
+			remaining = append(remaining, OpenLot{EntryID: fill.ID, Qty: qty, Price: fill.Price, Time: fill.Time})
+		}
+		open[fill.Symbol] = remaining
+	}
+
+	return trades
+}
+
+// closeOrder returns the order in which an exit closes the open lots (held
+// oldest first)
+func closeOrder(lots []OpenLot, method LotMethod, selected string) []int {
+	order := make([]int, 0, len(lots))
+	if method == LotSpecific && selected != "" {
+		for i, l := range lots {
+			if l.EntryID == selected {
+				order = append(order, i)
+			}
+		}
+	}
+	for i := range lots {
+		idx := i
+		if method == LotLIFO {
+			idx = len(lots) - 1 - i
+		}
+		if len(order) > 0 && order[0] == idx {
+			continue
+		}
+		order = append(order, idx)
+	}
+	return order
+}
+
+// Realized totals the profit locked in by a set of exits
+type Realized struct {
+	Trades int
+	Cost   float64
+	PnL    float64
+}
+
+// PnLPercent is the realized profit as a share of the closed entries' cost
+func (r Realized) PnLPercent() float64 {
+	if r.Cost == 0 {
+		return 0
+	}
+	return r.PnL / r.Cost * 100
+}
+
+// SymbolRealized is the realized profit on one symbol
+type SymbolRealized struct {
+	Symbol string
+	Realized
+}
+
+// SummarizeRealized totals the exits at or after since
+func SummarizeRealized(trades []RealizedTrade, since time.Time) Realized {
+	var r Realized
+	for _, t := range trades {
+		if t.Time.Before(since) {
+			continue
+		}
+		r.Trades++
+		r.Cost += t.Cost
+		r.PnL += t.PnL
+	}
+	return r
+}
+
+// RealizedBySymbol totals the exits at or after since per symbol, largest
+// profit first
+func RealizedBySymbol(trades []RealizedTrade, since time.Time) []SymbolRealized {
+	bySymbol := make(map[string]*SymbolRealized)
+	var symbols []*SymbolRealized
+	for _, t := range trades {
+		if t.Time.Before(since) {
+			continue
+		}
+		s, ok := bySymbol[t.Symbol]
+		if !ok {
+			s = &SymbolRealized{Symbol: t.Symbol}
+			bySymbol[t.Symbol] = s
+			symbols = append(symbols, s)
+		}
+		s.Trades++
+		s.Cost += t.Cost
+		s.PnL += t.PnL
+	}
+
+	result := make([]SymbolRealized, 0, len(symbols))
+	for _, s := range symbols {
+		result = append(result, *s)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].PnL > result[j].PnL
+	})
+	return result
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestComputeRisk(t *testing.T) {
+	// +10%, -10%, +5%
+	risk := ComputeRisk([]float64{100, 110, 99, 103.95})
+
+	if risk.Days != 3 {
+		t.Fatalf("Expected 3 daily returns, got %d", risk.Days)
+	}
+	if !near(risk.BestDay, 10) || !near(risk.WorstDay, -10) {
+		t.Errorf("Expected best/worst day of 10%%/-10%%, got %v/%v", risk.BestDay, risk.WorstDay)
+	}
+	if !near(risk.MaxDrawdown, -10) {
+		t.Errorf("Expected a 10%% drawdown, got %v", risk.MaxDrawdown)
+	}
+
+	mean := (0.10 - 0.10 + 0.05) / 3
+	stdDev := math.Sqrt((math.Pow(0.10-mean, 2) + math.Pow(-0.10-mean, 2) + math.Pow(0.05-mean, 2)) / 2)
+	downside := math.Sqrt(0.01 / 3)
+	if !near(risk.Volatility, stdDev*math.Sqrt(252)*100) {
+		t.Errorf("Unexpected volatility %v", risk.Volatility)
+	}
+	if !near(risk.Sharpe, mean/stdDev*math.Sqrt(252)) {
+		t.Errorf("Unexpected Sharpe ratio %v", risk.Sharpe)
+	}
+	if !near(risk.Sortino, mean/downside*math.Sqrt(252)) {
+		t.Errorf("Unexpected Sortino ratio %v", risk.Sortino)
+	}
+}
+
+func TestComputeRiskUndefinedRatios(t *testing.T) {
+	risk := ComputeRisk([]float64{100, 101, 102})
+	if risk.Sortino != 0 || risk.MaxDrawdown != 0 {
+		t.Errorf("Expected no Sortino ratio or drawdown without a down day, got %+v", risk)
+	}
+
+	if risk := ComputeRisk([]float64{100}); risk.Days != 0 || risk.Sharpe != 0 {
+		t.Errorf("Expected an empty result for a single close, got %+v", risk)
+	}
+}
+
+func TestDailyClosesKeepsLastPointPerDay(t *testing.T) {
+	day := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	timestamps := []int64{
+		day.Unix(),
+		day.Add(time.Hour).Unix(),
+		day.AddDate(0, 0, 1).Unix(),
+		day.AddDate(0, 0, 2).Unix(),
+	}
+	closes := DailyCloses(timestamps, []float64{101, 102, 103, 0}, 100, time.UTC)
+
+	want := []float64{100, 102, 103}
+	if len(closes) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, closes)
+	}
+	for i := range want {
+		if closes[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, closes)
+		}
+	}
+}
+
+func TestComputeTradingMatchesFirstInFirstOut(t *testing.T) {
+	start := time.Date(2024, 3, 4, 15, 0, 0, 0, time.UTC)
+	fills := []Fill{
+		// Listed newest first, as Alpaca returns them
+		{Symbol: "TSLA", Side: "buy", Qty: 2, Price: 190, Time: start.Add(96 * time.Hour)},
+		{Symbol: "TSLA", Side: "sell", Qty: 2, Price: 200, Time: start.Add(72 * time.Hour)},
+		{Symbol: "AAPL", Side: "sell", Qty: 10, Price: 90, Time: start.Add(48 * time.Hour)},
+		{Symbol: "AAPL", Side: "sell", Qty: 10, Price: 120, Time: start.Add(24 * time.Hour)},
+		{Symbol: "AAPL", Side: "buy", Qty: 10, Price: 110, Time: start.Add(12 * time.Hour)},
+		{Symbol: "AAPL", Side: "buy", Qty: 10, Price: 100, Time: start},
+	}
+
+	trading := ComputeTrading(fills, time.Time{})
+
+	// AAPL: sold the $100 lot at $120 (win, 24h) and the $110 lot at $90 (loss, 36h);
+	// TSLA: shorted at $200 and covered at $190 (win, 24h)
+	if trading.ClosedTrades != 3 {
+		t.Fatalf("Expected 3 closed trades, got %d", trading.ClosedTrades)
+	}
+	if !near(trading.WinRate, 200.0/3) {
+		t.Errorf("Expected a 66.7%% win rate, got %v", trading.WinRate)
+	}
+	wantHours := (10*24 + 10*36 + 2*24) / 22.0
+	if !near(trading.AvgHold.Hours(), wantHours) {
+		t.Errorf("Expected an average hold of %.2fh, got %v", wantHours, trading.AvgHold)
+	}
+
+	if recent := ComputeTrading(fills, start.Add(60*time.Hour)); recent.ClosedTrades != 1 || recent.WinRate != 100 {
+		t.Errorf("Expected only the TSLA cover after since, got %+v", recent)
+	}
+}
+
+func TestMatchLotsMethods(t *testing.T) {
+	start := time.Date(2024, 3, 4, 15, 0, 0, 0, time.UTC)
+	fills := []Fill{
+		{ID: "b1", Symbol: "AAPL", Side: "buy", Qty: 10, Price: 100, Time: start},
+		{ID: "b2", Symbol: "AAPL", Side: "buy", Qty: 10, Price: 110, Time: start.Add(time.Hour)},
+		{ID: "b3", Symbol: "AAPL", Side: "buy", Qty: 10, Price: 130, Time: start.Add(2 * time.Hour)},
+		{ID: "s1", Symbol: "AAPL", Side: "sell", Qty: 15, Price: 120, Time: start.Add(3 * time.Hour)},
+	}
+
+	tests := []struct {
+		method     LotMethod
+		selections map[string]string
+		wantPnL    float64
+		wantLots   []string
+	}{
+		{LotFIFO, nil, 10*20 + 5*10, []string{"b1", "b2"}},
+		{LotLIFO, nil, 10*-10 + 5*10, []string{"b3", "b2"}},
+		{LotSpecific, map[string]string{"s1": "b2"}, 10*10 + 5*20, []string{"b2", "b1"}},
+		{LotSpecific, nil, 10*20 + 5*10, []string{"b1", "b2"}},
+	}
+	for _, tt := range tests {
+		trades := MatchLots(fills, tt.method, tt.selections)
+		if len(trades) != 1 {
+			t.Fatalf("%s: expected 1 realized trade, got %d", tt.method, len(trades))
+		}
+		trade := trades[0]
+		if !near(trade.PnL, tt.wantPnL) || !near(trade.Qty, 15) {
+			t.Errorf("%s: expected $%.2f on 15 shares, got $%.2f on %v", tt.method, tt.wantPnL, trade.PnL, trade.Qty)
+		}
+		var lots []string
+		for _, l := range trade.Lots {
+			lots = append(lots, l.EntryID)
+		}
+		if strings.Join(lots, ",") != strings.Join(tt.wantLots, ",") {
+			t.Errorf("%s: expected lots %v, got %v", tt.method, tt.wantLots, lots)
+		}
+		if len(trade.Candidates) != 3 {
+			t.Errorf("%s: expected 3 candidate lots, got %d", tt.method, len(trade.Candidates))
+		}
+	}
+}
+
+func TestRealizedSummaries(t *testing.T) {
+	start := time.Date(2024, 3, 4, 15, 0, 0, 0, time.UTC)
+	trades := []RealizedTrade{
+		{Symbol: "AAPL", Cost: 1000, PnL: 100, Time: start},
+		{Symbol: "TSLA", Cost: 2000, PnL: -50, Time: start.Add(24 * time.Hour)},
+		{Symbol: "AAPL", Cost: 1000, PnL: 200, Time: start.Add(48 * time.Hour)},
+	}
+
+	all := SummarizeRealized(trades, time.Time{})
+	if all.Trades != 3 || !near(all.PnL, 250) || !near(all.PnLPercent(), 6.25) {
+		t.Errorf("Unexpected all-time summary %+v", all)
+	}
+	if recent := SummarizeRealized(trades, start.Add(time.Hour)); recent.Trades != 2 || !near(recent.PnL, 150) {
+		t.Errorf("Unexpected recent summary %+v", recent)
+	}
+
+	bySymbol := RealizedBySymbol(trades, time.Time{})
+	if len(bySymbol) != 2 || bySymbol[0].Symbol != "AAPL" || !near(bySymbol[0].PnL, 300) || bySymbol[0].Trades != 2 {
+		t.Errorf("Unexpected per-symbol summary %+v", bySymbol)
+	}
+}
+
+func TestTimeWeightedReturnStripsCashFlows(t *testing.T) {
+	day := time.Date(2024, 3, 4, 16, 0, 0, 0, time.UTC)
+	timestamps := []int64{day.Unix(), day.AddDate(0, 0, 1).Unix(), day.AddDate(0, 0, 2).Unix()}
+
+	// +10%, then a 50,000 deposit alongside a flat day, then +10%
+	flows := []CashFlow{
+		{Date: "2024-03-01", Amount: 1000}, // already in the starting value
+		{Date: "2024-03-05", Amount: 50000},
+	}
+	ret, ok := TimeWeightedReturn(timestamps, []float64{110000, 160000, 176000}, 100000, flows, time.UTC)
+	if !ok {
+		t.Fatal("Expected a return")
+	}
+	if !near(ret.Percent, 21) {
+		t.Errorf("Expected a 21%% return, got %v", ret.Percent)
+	}
+	if !near(ret.NetFlows, 50000) || len(ret.Resets) != 0 {
+		t.Errorf("Expected 50,000 of flows and no resets, got %+v", ret)
+	}
+}
+
+func TestTimeWeightedReturnFlagsResets(t *testing.T) {
+	day := time.Date(2024, 3, 4, 16, 0, 0, 0, time.UTC)
+	timestamps := []int64{day.Unix(), day.AddDate(0, 0, 1).Unix(), day.AddDate(0, 0, 2).Unix()}
+
+	// The account loses 5%, is reset to 100,000 and then gains 10%
+	ret, ok := TimeWeightedReturn(timestamps, []float64{19000, 100000, 110000}, 20000, nil, time.UTC)
+	if !ok {
+		t.Fatal("Expected a return")
+	}
+	if !near(ret.Percent, (0.95*1.10-1)*100) {
+		t.Errorf("Expected the reset day to be left out, got %v", ret.Percent)
+	}
+	if len(ret.Resets) != 1 || ret.Resets[0] != "2024-03-05" {
+		t.Errorf("Expected a reset on 2024-03-05, got %v", ret.Resets)
+	}
+	if !near(ret.NetFlows, 81000) {
+		t.Errorf("Expected the reset to count as a flow, got %v", ret.NetFlows)
+	}
+
+	if _, ok := TimeWeightedReturn(timestamps, []float64{0, 0, 0}, 0, nil, time.UTC); ok {
+		t.Error("Expected no return for an empty history")
+	}
+}
@@ -0,0 +1,108 @@
+// Package metrics computes risk-adjusted performance statistics from a
+// trader's equity history and trade fills.
+package metrics
+
+import (
+	"math"
+	"time"
+)
+
+// tradingDaysPerYear annualizes daily statistics
+const tradingDaysPerYear = 252
+
+// Risk summarizes the daily returns of an equity series. Ratios assume a zero
+// risk-free rate and are zero when undefined, e.g. with fewer than two days.
+type Risk struct {
+	Days        int     // daily returns measured
+	Volatility  float64 // annualized standard deviation of daily returns, in percent
+	Sharpe      float64 // annualized mean return over volatility
+	Sortino     float64 // annualized mean return over downside deviation
+	MaxDrawdown float64 // largest peak-to-trough decline, in percent (zero or negative)
+	BestDay     float64 // in percent
+	WorstDay    float64 // in percent
+}
+
+// DailyCloses reduces an equity history to one closing value per trading day
+// in loc, dropping the zero padding Alpaca uses for future slots. A positive
+// base value is treated as the close before the first day.
+func DailyCloses(timestamps []int64, equity []float64, baseValue float64, loc *time.Location) []float64 {
+	var closes []float64
+	if baseValue > 0 {
+		closes = append(closes, baseValue)
+	}
+
+	lastDay := ""
+	for i, ts := range timestamps {
+		if i >= len(equity) || equity[i] <= 0 {
+			continue
+		}
+		day := time.Unix(ts, 0).In(loc).Format("2006-01-02")
+		if day == lastDay && len(closes) > 0 {
+			closes[len(closes)-1] = equity[i]
+			continue
+		}
+		lastDay = day
+		closes = append(closes, equity[i])
+	}
+	return closes
+}
+
+// ComputeRisk measures the daily returns between consecutive closes
+func ComputeRisk(closes []float64) Risk {
+	var risk Risk
+	if len(closes) == 0 {
+		return risk
+	}
+
+	returns := make([]float64, 0, len(closes))
+	peak := closes[0]
+	for i, close := range closes {
+		if close > peak {
+			peak = close
+		}
+		if drawdown := (close - peak) / peak * 100; drawdown < risk.MaxDrawdown {
+			risk.MaxDrawdown = drawdown
+		}
+		if i > 0 && closes[i-1] > 0 {
+			returns = append(returns, (close-closes[i-1])/closes[i-1])
+		}
+	}
+
+	risk.Days = len(returns)
+	if risk.Days == 0 {
+		return risk
+	}
+
+	var sum float64
+	risk.BestDay, risk.WorstDay = math.Inf(-1), math.Inf(1)
+	for _, r := range returns {
+		sum += r
+		risk.BestDay = math.Max(risk.BestDay, r*100)
+		risk.WorstDay = math.Min(risk.WorstDay, r*100)
+	}
+	mean := sum / float64(risk.Days)
+
+	if risk.Days < 2 {
+		return risk
+	}
+
+	var variance, downside float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	stdDev := math.Sqrt(variance / float64(risk.Days-1))
+	downsideDev := math.Sqrt(downside / float64(risk.Days))
+
+	annualize := math.Sqrt(tradingDaysPerYear)
+	risk.Volatility = stdDev * annualize * 100
+	if stdDev > 0 {
+		risk.Sharpe = mean / stdDev * annualize
+	}
+	if downsideDev > 0 {
+		risk.Sortino = mean / downsideDev * annualize
+	}
+	return risk
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import "time"
+
+// Fill is an executed trade
+type Fill struct {
+	ID     string
+	Symbol string
+	Side   string // "buy" or "sell"
+	Qty    float64
+	Price  float64
+	Time   time.Time
+}
+
+// Trading summarizes closed round trips, matching fills first in, first out
+type Trading struct {
+	ClosedTrades int           // fills that closed at least part of a position
+	WinRate      float64       // share of closed trades with a profit, in percent
+	AvgHold      time.Duration // quantity-weighted time from entry to exit
+}
+
+// epsilon absorbs rounding left over from fractional share quantities
+const epsilon = 1e-9
+
+// ComputeTrading matches exits against earlier entries of the same symbol,
+// first in, first out. Only exits at or after since are counted, and exits
+// whose entries predate the fills are ignored.
+func ComputeTrading(fills []Fill, since time.Time) Trading {
+	var trading Trading
+	var wins int
+	var heldQty float64
+	var heldFor float64 // quantity-weighted seconds
+
+	for _, trade := range MatchLots(fills, LotFIFO, nil) {
+		if trade.Time.Before(since) {
+			continue
+		}
+		trading.ClosedTrades++
+		if trade.PnL > 0 {
+			wins++
+		}
+		for _, l := range trade.Lots {
+			heldQty += l.Qty
+			heldFor += trade.Time.Sub(l.Time).Seconds() * l.Qty
+		}
+	}
+
+	if trading.ClosedTrades > 0 {
+		trading.WinRate = float64(wins) / float64(trading.ClosedTrades) * 100
+		trading.AvgHold = time.Duration(heldFor / heldQty * float64(time.Second))
+	}
+	return trading
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
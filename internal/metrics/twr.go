@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// resetThreshold is the largest one-day move, net of cash flows, that is
+// still treated as trading. A bigger jump is taken to be an account reset
+// (e.g. a paper account put back to a fresh balance) rather than a gain.
+const resetThreshold = 0.5
+
+// CashFlow is money moved into (positive) or out of (negative) an account
+type CashFlow struct {
+	Date   string // trading day in market time (YYYY-MM-DD)
+	Amount float64
+}
+
+// Return is a time-weighted return with external cash flows stripped out
+type Return struct {
+	Percent  float64
+	NetFlows float64  // money added to the account inside the window, including resets
+	Resets   []string // trading days the account appears to have been reset
+}
+
+// dailyValue is an account's closing equity on a trading day
+type dailyValue struct {
+	date   string
+	equity float64
+}
+
+// TimeWeightedReturn chains the daily returns of an equity history, treating
+// each day's cash flows as arriving at the close so deposits and withdrawals
+// don't count as gains. A positive startValue is the equity just before the
+// first day; otherwise the first close is the starting point. It reports
+// false when the history has no equity.
+func TimeWeightedReturn(timestamps []int64, equity []float64, startValue float64, flows []CashFlow, loc *time.Location) (Return, bool) {
+	var days []dailyValue
+	for i, ts := range timestamps {
+		if i >= len(equity) || equity[i] <= 0 {
+			continue
+		}
+		date := time.Unix(ts, 0).In(loc).Format("2006-01-02")
+		if len(days) > 0 && days[len(days)-1].date == date {
+			days[len(days)-1].equity = equity[i]
+			continue
+		}
+		days = append(days, dailyValue{date: date, equity: equity[i]})
+	}
+	if len(days) == 0 {
+		return Return{}, false
+	}
+
+	// Flows before the window are already part of the starting equity, as
+	// are those on the first day when it is the starting point
+	sorted := make([]CashFlow, len(flows))
+	copy(sorted, flows)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date < sorted[j].Date
+	})
+	prev := startValue
+	if prev <= 0 {
+		prev = days[0].equity
+		for len(sorted) > 0 && sorted[0].Date <= days[0].date {
+			sorted = sorted[1:]
+		}
+		days = days[1:]
+	} else {
+		for len(sorted) > 0 && sorted[0].Date < days[0].date {
+			sorted = sorted[1:]
+		}
+	}
+
+	var result Return
+	growth := 1.0
+	next := 0
+	for _, day := range days {
+		// Flows on non-trading days land on the next close
+		var flow float64
+		for next < len(sorted) && sorted[next].Date <= day.date {
+			flow += sorted[next].Amount
+			next++
+		}
+
+		r := (day.equity-flow)/prev - 1
+		if math.Abs(r) > resetThreshold {
+			result.Resets = append(result.Resets, day.date)
+			result.NetFlows += day.equity - prev
+			r = 0
+		} else {
+			result.NetFlows += flow
+		}
+
+		growth *= 1 + r
+		prev = day.equity
+	}
+
+	result.Percent = (growth - 1) * 100
+	return result, true
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"net/url"
 
 	"github.com/skywall34/fantasy-trading/internal/database"
 )
@@ -10,12 +11,33 @@ import (
 type contextKey string
 
 const (
-	UserIDKey     contextKey = "user_id"
-	APIKeyKey     contextKey = "api_key"
-	APISecretKey  contextKey = "api_secret"
-	SessionIDKey  contextKey = "session_id"
+	UserIDKey    contextKey = "user_id"
+	APIKeyKey    contextKey = "api_key"
+	APISecretKey contextKey = "api_secret"
+	SessionIDKey contextKey = "session_id"
+	IsLiveKey    contextKey = "is_live"
 )
 
+// LoginReasonRevoked is the /login reason shown when Alpaca rejected a session's API key
+const LoginReasonRevoked = "revoked"
+
+// RedirectToLogin sends the user to the login page with an optional reason.
+// HTMX requests get an HX-Redirect so the whole page navigates instead of the
+// login form being swapped into a fragment.
+func RedirectToLogin(w http.ResponseWriter, r *http.Request, reason string) {
+	target := "/login"
+	if reason != "" {
+		target += "?reason=" + url.QueryEscape(reason)
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", target)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
 // AuthMiddleware checks if the user is authenticated via session cookie
 func AuthMiddleware(db *database.DB) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -45,11 +67,19 @@ func AuthMiddleware(db *database.DB) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Alpaca rejected this session's API key; ask for new credentials
+			if session.IsRevoked() {
+				_ = db.DeleteSession(session.ID)
+				RedirectToLogin(w, r, LoginReasonRevoked)
+				return
+			}
+
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), UserIDKey, session.UserID)
 			ctx = context.WithValue(ctx, APIKeyKey, session.APIKey)
 			ctx = context.WithValue(ctx, APISecretKey, session.APISecret)
 			ctx = context.WithValue(ctx, SessionIDKey, session.ID)
+			ctx = context.WithValue(ctx, IsLiveKey, session.IsLive)
 
 			// Continue with the request
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -80,3 +110,9 @@ func GetSessionID(ctx context.Context) (string, bool) {
 	sessionID, ok := ctx.Value(SessionIDKey).(string)
 	return sessionID, ok
 }
+
+// GetIsLive reports whether the session's credentials are for a live trading account
+func GetIsLive(ctx context.Context) bool {
+	isLive, _ := ctx.Value(IsLiveKey).(bool)
+	return isLive
+}
@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+// AssetSync copies Alpaca's catalog of active assets into SQLite, giving
+// company names and symbol search without a request per lookup
+type AssetSync struct {
+	db *database.DB
+}
+
+// NewAssetSync creates an asset catalog sync
+func NewAssetSync(db *database.DB) *AssetSync {
+	return &AssetSync{db: db}
+}
+
+// Refresh lists active assets with the first stored session Alpaca accepts
+// and saves them. The catalog is the same for every account, so any user's
+// credentials will do.
+func (s *AssetSync) Refresh(ctx context.Context, _ time.Time) error {
+	users, err := s.db.GetUsersWithSessions()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	if len(users) == 0 {
+		return errors.New("no stored sessions to fetch assets with")
+	}
+
+	var errs []error
+	for _, user := range users {
+		assets, err := s.listAssets(ctx, user.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %d: %w", user.ID, err))
+			continue
+		}
+
+		catalog := make([]database.Asset, 0, len(assets))
+		for _, a := range assets {
+			catalog = append(catalog, database.Asset{
+				Symbol:       a.Symbol,
+				AlpacaID:     a.ID,
+				Name:         a.Name,
+				Exchange:     a.Exchange,
+				AssetClass:   a.Class,
+				Status:       a.Status,
+				Tradable:     a.Tradable,
+				Fractionable: a.Fractionable,
+			})
+		}
+		if err := s.db.SaveAssets(catalog); err != nil {
+			return err
+		}
+		log.Printf("Asset catalog refreshed with %d assets", len(catalog))
+		return nil
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *AssetSync) listAssets(ctx context.Context, userID int) ([]alpaca.Asset, error) {
+	session, err := s.db.GetLatestSession(userID)
+	if err != nil {
+		return nil, fmt.Errorf("no session found: %w", err)
+	}
+
+	apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
+	if err != nil {
+		return nil, err
+	}
+
+	client := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(session.IsLive))
+	return client.ListAssets(ctx, alpaca.AssetsQuery{Status: alpaca.AssetStatusActive})
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Failed daily runs are retried a few times before waiting for the next day
+const (
+	dailyJobAttempts   = 4
+	dailyJobRetryDelay = 15 * time.Minute
+)
+
+// DailyJob runs a task once every weekday at a fixed time of day, e.g. to
+// record end-of-day leaderboard standings after the market closes
+type DailyJob struct {
+	name     string
+	loc      *time.Location
+	hour     int
+	minute   int
+	task     func(ctx context.Context, day time.Time) error
+	stopChan chan bool
+}
+
+// NewDailyJob creates a job that runs task at hour:minute in loc on weekdays
+func NewDailyJob(name string, loc *time.Location, hour, minute int, task func(ctx context.Context, day time.Time) error) *DailyJob {
+	return &DailyJob{
+		name:     name,
+		loc:      loc,
+		hour:     hour,
+		minute:   minute,
+		task:     task,
+		stopChan: make(chan bool),
+	}
+}
+
+// Start runs the job in the background. If the server starts after today's
+// run time the job catches up immediately, and failed runs are retried;
+// tasks must be safe to rerun.
+func (j *DailyJob) Start() {
+	go j.run()
+}
+
+// Stop shuts down the background loop
+func (j *DailyJob) Stop() {
+	close(j.stopChan)
+}
+
+func (j *DailyJob) run() {
+	now := time.Now().In(j.loc)
+	if isWeekday(now) && !now.Before(j.runTime(now)) {
+		j.runOnce(now)
+	}
+
+	for {
+		next := j.nextRun(time.Now().In(j.loc))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			j.runOnce(next)
+		case <-j.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runOnce runs the task for day, retrying after a delay when it fails
+func (j *DailyJob) runOnce(day time.Time) {
+	for attempt := 1; ; attempt++ {
+		err := j.attempt(day, attempt == dailyJobAttempts)
+		if err == nil {
+			log.Printf("%s complete for %s", j.name, day.Format("2006-01-02"))
+			return
+		}
+		log.Printf("%s failed for %s (attempt %d/%d): %v", j.name, day.Format("2006-01-02"), attempt, dailyJobAttempts, err)
+		if attempt == dailyJobAttempts {
+			return
+		}
+
+		timer := time.NewTimer(dailyJobRetryDelay)
+		select {
+		case <-timer.C:
+		case <-j.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (j *DailyJob) attempt(day time.Time, final bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if final {
+		ctx = WithFinalAttempt(ctx)
+	}
+	return j.task(ctx, day)
+}
+
+type finalAttemptKey struct{}
+
+// WithFinalAttempt marks ctx as a task's last attempt of the day
+func WithFinalAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, finalAttemptKey{}, true)
+}
+
+// IsFinalAttempt reports whether a task is on its last attempt of the day, so
+// it can keep what it has rather than failing for a retry that won't come
+func IsFinalAttempt(ctx context.Context) bool {
+	final, _ := ctx.Value(finalAttemptKey{}).(bool)
+	return final
+}
+
+// runTime returns the job's run time on t's day
+func (j *DailyJob) runTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), j.hour, j.minute, 0, 0, j.loc)
+}
+
+// nextRun returns the first weekday run time after now
+func (j *DailyJob) nextRun(now time.Time) time.Time {
+	next := j.runTime(now)
+	for !next.After(now) || !isWeekday(next) {
+		next = j.runTime(next.AddDate(0, 0, 1))
+	}
+	return next
+}
+
+func isWeekday(t time.Time) bool {
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+}
@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// IntervalJob runs a task on startup and then every interval, e.g. to
+// rebuild aggregates that are too expensive to compute per request
+type IntervalJob struct {
+	name     string
+	interval time.Duration
+	task     func(ctx context.Context) error
+	stopChan chan bool
+}
+
+// NewIntervalJob creates a job that runs task every interval
+func NewIntervalJob(name string, interval time.Duration, task func(ctx context.Context) error) *IntervalJob {
+	return &IntervalJob{
+		name:     name,
+		interval: interval,
+		task:     task,
+		stopChan: make(chan bool),
+	}
+}
+
+// Start runs the job immediately and then on every interval in the background
+func (j *IntervalJob) Start() {
+	go j.run()
+}
+
+// Stop shuts down the background loop
+func (j *IntervalJob) Stop() {
+	close(j.stopChan)
+}
+
+func (j *IntervalJob) run() {
+	j.runOnce()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.runOnce()
+		case <-j.stopChan:
+			return
+		}
+	}
+}
+
+func (j *IntervalJob) runOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if err := j.task(ctx); err != nil {
+		log.Printf("%s failed: %v", j.name, err)
+	}
+}
@@ -0,0 +1,167 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/skywall34/fantasy-trading/internal/alpaca"
+	"github.com/skywall34/fantasy-trading/internal/database"
+)
+
+// defaultSnapshotRetention is how long every snapshot is kept before being
+// downsampled to one per day
+const defaultSnapshotRetention = 7 * 24 * time.Hour
+
+// Worker periodically pulls account and position data from Alpaca for every user
+// with a stored session and persists it as portfolio snapshots
+type Worker struct {
+	db        *database.DB
+	interval  time.Duration
+	retention time.Duration
+	stopChan  chan bool
+}
+
+// NewWorker creates a sync worker that runs every interval
+func NewWorker(db *database.DB, interval time.Duration) *Worker {
+	return &Worker{
+		db:        db,
+		interval:  interval,
+		retention: defaultSnapshotRetention,
+		stopChan:  make(chan bool),
+	}
+}
+
+// SetRetention sets how long every snapshot is kept before older ones are
+// downsampled to one per user per day
+func (w *Worker) SetRetention(retention time.Duration) {
+	w.retention = retention
+}
+
+// Start runs an initial sync and then syncs on every interval in the background
+func (w *Worker) Start() {
+	go w.run()
+}
+
+// Stop gracefully shuts down the background sync loop
+func (w *Worker) Stop() {
+	close(w.stopChan)
+}
+
+func (w *Worker) run() {
+	w.SyncAll()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.SyncAll()
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+// SyncAll snapshots every user that has a stored session
+func (w *Worker) SyncAll() {
+	users, err := w.db.GetUsersWithSessions()
+	if err != nil {
+		log.Printf("Sync failed to list users: %v", err)
+		return
+	}
+
+	successCount := 0
+	for _, user := range users {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := w.SyncUser(ctx, user.ID)
+		cancel()
+		if err != nil {
+			log.Printf("Sync failed for user %d: %v", user.ID, err)
+			continue
+		}
+		successCount++
+	}
+
+	log.Printf("Sync complete for %d/%d users", successCount, len(users))
+
+	w.prune()
+}
+
+// prune downsamples snapshots older than the retention window
+func (w *Worker) prune() {
+	pruned, err := w.db.PrunePortfolioSnapshots(time.Now().Add(-w.retention))
+	if err != nil {
+		log.Printf("Sync failed to prune snapshots: %v", err)
+		return
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d old portfolio snapshots", pruned)
+	}
+}
+
+// SyncUser fetches a user's account and positions from Alpaca, stores a snapshot
+// and records the sync time on the user
+func (w *Worker) SyncUser(ctx context.Context, userID int) error {
+	session, err := w.db.GetLatestSession(userID)
+	if err != nil {
+		return fmt.Errorf("no session found: %w", err)
+	}
+
+	apiKey, apiSecret, err := database.DecryptAPIKeys(session.APIKey, session.APISecret)
+	if err != nil {
+		return err
+	}
+
+	// A rejected key revokes the user's sessions so later syncs skip them until they log in again
+	client := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(session.IsLive), alpaca.WithOnUnauthorized(func() {
+		if err := w.db.RevokeSessionsForUser(userID); err != nil {
+			log.Printf("Failed to revoke sessions for user %d: %v", userID, err)
+		}
+	}))
+
+	account, err := client.GetAccount(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+
+	positions, err := client.GetPositions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get positions: %w", err)
+	}
+
+	positionSnapshots := make([]database.PositionSnapshot, 0, len(positions))
+	for _, pos := range positions {
+		positionSnapshots = append(positionSnapshots, snapshotFromPosition(pos))
+	}
+
+	if _, err := w.db.CreatePortfolioSnapshot(snapshotFromAccount(userID, account), positionSnapshots); err != nil {
+		return err
+	}
+
+	return w.db.UpdateLastSync(userID)
+}
+
+// snapshotFromAccount converts an Alpaca account into a portfolio snapshot
+func snapshotFromAccount(userID int, account *alpaca.Account) database.PortfolioSnapshot {
+	return database.PortfolioSnapshot{
+		UserID:     userID,
+		Equity:     account.Equity.Float64(),
+		LastEquity: account.LastEquity.Float64(),
+		Cash:       account.Cash.Float64(),
+	}
+}
+
+// snapshotFromPosition converts an Alpaca position into a position snapshot
+func snapshotFromPosition(pos alpaca.Position) database.PositionSnapshot {
+	return database.PositionSnapshot{
+		Symbol:        pos.Symbol,
+		AssetClass:    pos.AssetClass,
+		Qty:           pos.Qty.Float64(),
+		AvgEntryPrice: pos.AvgEntryPrice.Float64(),
+		MarketValue:   pos.MarketValue.Float64(),
+		UnrealizedPL:  pos.UnrealizedPL.Float64(),
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -14,7 +15,9 @@ import (
 	"github.com/skywall34/fantasy-trading/internal/cache"
 	"github.com/skywall34/fantasy-trading/internal/database"
 	"github.com/skywall34/fantasy-trading/internal/handlers"
+	"github.com/skywall34/fantasy-trading/internal/live"
 	"github.com/skywall34/fantasy-trading/internal/middleware"
+	syncworker "github.com/skywall34/fantasy-trading/internal/sync"
 )
 
 // Global cache instance
@@ -42,6 +45,17 @@ func main() {
 
 	log.Println("Database initialized successfully")
 
+	// Admins moderate comments; the list is synced on every start
+	adminAccountIDs := getEnvList("ADMIN_ACCOUNT_IDS")
+	if err := db.SetAdmins(adminAccountIDs); err != nil {
+		log.Fatalf("Failed to set admins: %v", err)
+	}
+	log.Printf("Admins configured: %d", len(adminAccountIDs))
+
+	// Alpaca API hosts (override to point at a proxy or local fake)
+	alpaca.PaperBaseURL = getEnv("ALPACA_PAPER_BASE_URL", alpaca.PaperBaseURL)
+	alpaca.LiveBaseURL = getEnv("ALPACA_LIVE_BASE_URL", alpaca.LiveBaseURL)
+
 	// Initialize cache
 	cacheEnabled := getEnv("CACHE_ENABLED", "true") == "true"
 	if cacheEnabled {
@@ -62,12 +76,93 @@ func main() {
 		log.Println("Cache disabled")
 	}
 
+	// Start background portfolio snapshot sync
+	syncEnabled := getEnv("SYNC_ENABLED", "true") == "true"
+	if syncEnabled {
+		syncInterval := getEnvInt("SYNC_INTERVAL_SECONDS", 300)
+		retentionDays := getEnvInt("SNAPSHOT_RETENTION_DAYS", 7)
+
+		worker := syncworker.NewWorker(db, time.Duration(syncInterval)*time.Second)
+		worker.SetRetention(time.Duration(retentionDays) * 24 * time.Hour)
+		worker.Start()
+		defer worker.Stop()
+
+		log.Printf("Sync enabled - Interval: %ds, Full snapshot retention: %dd", syncInterval, retentionDays)
+	} else {
+		log.Println("Sync disabled")
+	}
+
+	// Record each day's leaderboard standings after the market closes
+	standingsEnabled := getEnv("STANDINGS_ENABLED", "true") == "true"
+	if standingsEnabled {
+		recorder := handlers.NewStandingsRecorder(db)
+		if alpacaCache != nil {
+			recorder.SetCache(alpacaCache)
+		}
+
+		standingsJob := syncworker.NewDailyJob("Standings recording", alpaca.MarketLocation, 16, 30, recorder.Record)
+		standingsJob.Start()
+		defer standingsJob.Stop()
+
+		log.Println("Standings recording enabled - daily at 16:30 market time")
+	} else {
+		log.Println("Standings recording disabled")
+	}
+
+	// Refresh the asset catalog every weekday before the open, and right
+	// away when it has never been filled
+	assetSyncEnabled := getEnv("ASSET_SYNC_ENABLED", "true") == "true"
+	if assetSyncEnabled {
+		assetSync := syncworker.NewAssetSync(db)
+		assetJob := syncworker.NewDailyJob("Asset catalog refresh", alpaca.MarketLocation, 8, 0, assetSync.Refresh)
+		defer assetJob.Stop()
+
+		go func() {
+			if count, err := db.CountAssets(); err == nil && count == 0 {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+				if err := assetSync.Refresh(ctx, time.Now()); err != nil {
+					log.Printf("Initial asset catalog refresh failed: %v", err)
+				}
+				cancel()
+			}
+			assetJob.Start()
+		}()
+
+		log.Println("Asset catalog refresh enabled - daily at 08:00 market time")
+	} else {
+		log.Println("Asset catalog refresh disabled")
+	}
+
+	// Rebuild the platform consensus on a schedule rather than per request
+	consensusHandler := handlers.NewConsensusHandler(db)
+	if alpacaCache != nil {
+		consensusHandler.SetCache(alpacaCache)
+	}
+	consensusInterval := getEnvInt("CONSENSUS_REFRESH_SECONDS", 900)
+	consensusJob := syncworker.NewIntervalJob("Consensus refresh", time.Duration(consensusInterval)*time.Second, consensusHandler.Refresh)
+	consensusJob.Start()
+	defer consensusJob.Stop()
+
+	log.Printf("Consensus refresh - Interval: %ds", consensusInterval)
+
+	// Live updates are fanned out to connected browsers over server-sent
+	// events; new trades are spotted as the cache refreshes users' fills
+	liveHub := live.NewHub(getEnvInt("LIVE_BACKLOG_EVENTS", 500))
+	if alpacaCache != nil {
+		tradeWatcher := handlers.NewTradeWatcher(db, alpacaCache, liveHub)
+		alpacaCache.OnRefresh(tradeWatcher.Refreshed)
+	}
+
 	// Create handlers
 	loginHandler := handlers.NewAPIKeyLoginHandler(db)
 	dashboardHandler := handlers.NewDashboardHandler(db)
 	dashboardContentHandler := handlers.NewDashboardContentHandler(db)
 	portfolioHistoryHandler := handlers.NewPortfolioHistoryHandler()
 	updateProfileHandler := handlers.NewUpdateProfileHandler(db)
+	startingEquityHandler := handlers.NewStartingEquityHandler(db)
+	privacyHandler := handlers.NewPrivacyHandler(db)
+	lotMethodHandler := handlers.NewLotMethodHandler(db)
+	lotSelectionHandler := handlers.NewLotSelectionHandler(db)
 	settingsHandler := handlers.NewSettingsHandler(db)
 	leaderboardHandler := handlers.NewLeaderboardHandler(db)
 	activityHandler := handlers.NewActivityHandler(db)
@@ -77,14 +172,38 @@ func main() {
 	followHandler := handlers.NewFollowHandler(db)
 	searchHandler := handlers.NewSearchHandler(db)
 	userHandler := handlers.NewUserHandler(db)
+	symbolHandler := handlers.NewSymbolHandler(db)
+	leaguesHandler := handlers.NewLeaguesHandler(db)
 	logoutHandler := handlers.NewLogoutHandler(db)
+	notificationsHandler := handlers.NewNotificationsHandler(db)
+	notificationPreferencesHandler := handlers.NewNotificationPreferencesHandler(db)
+	streamHandler := handlers.NewStreamHandler(db, liveHub)
+	moderationHandler := handlers.NewModerationHandler(db)
+
+	// Publish social events to the live stream
+	commentsHandler.SetHub(liveHub)
+	commentActionsHandler.SetHub(liveHub)
+	reactionsHandler.SetHub(liveHub)
+	followHandler.SetHub(liveHub)
+
+	// Comment moderation: an optional word filter and hiding reported comments
+	wordFilter := handlers.NewWordFilter(getEnvList("COMMENT_BLOCKED_WORDS"))
+	commentsHandler.SetWordFilter(wordFilter)
+	commentActionsHandler.SetWordFilter(wordFilter)
+	commentActionsHandler.SetReportHideThreshold(getEnvInt("COMMENT_REPORT_HIDE_THRESHOLD", 3))
 
 	// Set cache on handlers if enabled
 	if alpacaCache != nil {
+		dashboardHandler.SetCache(alpacaCache)
+		dashboardContentHandler.SetCache(alpacaCache)
 		leaderboardHandler.SetCache(alpacaCache)
 		activityHandler.SetCache(alpacaCache)
 		userHandler.SetCache(alpacaCache)
+		symbolHandler.SetCache(alpacaCache)
+		leaguesHandler.SetCache(alpacaCache)
 		logoutHandler.SetCache(alpacaCache)
+		privacyHandler.SetCache(alpacaCache)
+		lotSelectionHandler.SetCache(alpacaCache)
 	}
 
 	// Create router
@@ -104,9 +223,23 @@ func main() {
 	mux.Handle("/activity", middleware.AuthMiddleware(db)(activityHandler))
 	mux.Handle("/search", middleware.AuthMiddleware(db)(searchHandler))
 	mux.Handle("/user/", middleware.AuthMiddleware(db)(userHandler))
+	mux.Handle("/symbol/", middleware.AuthMiddleware(db)(symbolHandler))
+	mux.Handle("/consensus", middleware.AuthMiddleware(db)(consensusHandler))
+	mux.Handle("/leagues", middleware.AuthMiddleware(db)(leaguesHandler))
+	mux.Handle("/leagues/", middleware.AuthMiddleware(db)(leaguesHandler))
 	mux.Handle("/settings", middleware.AuthMiddleware(db)(settingsHandler))
+	mux.Handle("/notifications", middleware.AuthMiddleware(db)(notificationsHandler))
+	mux.Handle("/notifications/", middleware.AuthMiddleware(db)(notificationsHandler))
+	mux.Handle("/events", middleware.AuthMiddleware(db)(streamHandler))
+	mux.Handle("/moderation", middleware.AuthMiddleware(db)(moderationHandler))
+	mux.Handle("/moderation/", middleware.AuthMiddleware(db)(moderationHandler))
 	mux.Handle("/api/portfolio/history", middleware.AuthMiddleware(db)(portfolioHistoryHandler))
 	mux.Handle("/api/profile/update", middleware.AuthMiddleware(db)(updateProfileHandler))
+	mux.Handle("/api/profile/starting-equity", middleware.AuthMiddleware(db)(startingEquityHandler))
+	mux.Handle("/api/profile/privacy", middleware.AuthMiddleware(db)(privacyHandler))
+	mux.Handle("/api/profile/notifications", middleware.AuthMiddleware(db)(notificationPreferencesHandler))
+	mux.Handle("/api/profile/lot-method", middleware.AuthMiddleware(db)(lotMethodHandler))
+	mux.Handle("/api/lots/select", middleware.AuthMiddleware(db)(lotSelectionHandler))
 	mux.Handle("/api/activities/", middleware.AuthMiddleware(db)(http.StripPrefix("/api/activities/", commentsHandler)))
 	mux.Handle("/api/comments/", middleware.AuthMiddleware(db)(http.StripPrefix("/api/comments/", commentActionsHandler)))
 	mux.Handle("/api/reactions/", middleware.AuthMiddleware(db)(http.StripPrefix("/api/reactions/", reactionsHandler)))
@@ -160,7 +293,7 @@ func warmCache(db *database.DB, cache *cache.Cache) {
 	}
 
 	successCount := 0
-	for i, user := range users {
+	for _, user := range users {
 		session, err := db.GetLatestSession(user.ID)
 		if err != nil {
 			continue
@@ -171,7 +304,11 @@ func warmCache(db *database.DB, cache *cache.Cache) {
 			continue
 		}
 
-		client := alpaca.NewClient(apiKey, apiSecret)
+		client := alpaca.NewClient(apiKey, apiSecret, alpaca.WithLive(session.IsLive), alpaca.WithOnUnauthorized(func() {
+			if err := db.RevokeSessionsForUser(user.ID); err != nil {
+				log.Printf("Failed to revoke sessions for user %d: %v", user.ID, err)
+			}
+		}))
 		ctx := context.Background()
 
 		// Cache account data with refresh function
@@ -184,23 +321,24 @@ func warmCache(db *database.DB, cache *cache.Cache) {
 			activitiesTTL := getEnvInt("CACHE_ACTIVITIES_TTL_SECONDS", 30)
 			cache.SetWithRefresh(accountCacheKey, account, 60*time.Second, accountRefreshFunc)
 
-			// Cache activities with refresh function
-			activitiesCacheKey := fmt.Sprintf("activities:%d", user.ID)
+			// Cache the trades needed for the activity feed's first page
+			// (20 entries plus one to detect a next page)
+			const feedFirstPage = 21
+			activitiesCacheKey := fmt.Sprintf("activities:%d:%d", user.ID, feedFirstPage)
+			activitiesQuery := alpaca.ActivitiesQuery{
+				ActivityTypes: []string{alpaca.ActivityTypeFill},
+				Direction:     alpaca.DirectionDesc,
+			}
 			activitiesRefreshFunc := func(ctx context.Context) (any, error) {
-				return client.GetActivities(ctx)
+				return client.ListActivities(ctx, activitiesQuery, feedFirstPage)
 			}
 
-			if activities, err := client.GetActivities(ctx); err == nil {
+			if activities, err := client.ListActivities(ctx, activitiesQuery, feedFirstPage); err == nil {
 				cache.SetWithRefresh(activitiesCacheKey, activities, time.Duration(activitiesTTL)*time.Second, activitiesRefreshFunc)
 			}
 
 			successCount++
 		}
-
-		// Rate limit protection - spread requests over time
-		if i < len(users)-1 {
-			time.Sleep(100 * time.Millisecond)
-		}
 	}
 
 	log.Printf("Cache warming complete for %d/%d users", successCount, len(users))
@@ -225,3 +363,14 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return intVal
 }
+
+// getEnvList splits a comma-separated environment variable, dropping blank entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
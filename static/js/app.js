@@ -262,3 +262,119 @@ document.addEventListener('click', function(event) {
         });
     }
 });
+
+// Rank History Chart Initialization
+function initializeRankChart() {
+    const chartCanvas = document.getElementById('rankChart');
+    if (!chartCanvas) {
+        return;
+    }
+
+    let points = [];
+    try {
+        points = JSON.parse(chartCanvas.getAttribute('data-points') || '[]');
+    } catch (e) {
+        console.error('Error parsing rank history:', e);
+    }
+
+    if (chartCanvas.chart) {
+        chartCanvas.chart.destroy();
+    }
+
+    chartCanvas.chart = new Chart(chartCanvas.getContext('2d'), {
+        type: 'line',
+        data: {
+            labels: points.map(p => new Date(p.Date + 'T12:00:00').toLocaleDateString('en-US', { month: 'short', day: 'numeric' })),
+            datasets: [{
+                label: 'Rank',
+                data: points.map(p => p.Rank),
+                borderColor: '#E31B23',
+                backgroundColor: '#E31B23',
+                stepped: true,
+                pointRadius: 2,
+            }]
+        },
+        options: {
+            responsive: true,
+            maintainAspectRatio: false,
+            plugins: {
+                legend: {
+                    display: false
+                },
+                tooltip: {
+                    displayColors: false,
+                    callbacks: {
+                        label: function(context) {
+                            const point = points[context.dataIndex];
+                            return '#' + point.Rank + ' of ' + point.Total;
+                        }
+                    }
+                }
+            },
+            scales: {
+                x: {
+                    grid: {
+                        display: false
+                    },
+                    ticks: {
+                        maxTicksLimit: 8,
+                        color: '#9CA3AF'
+                    }
+                },
+                y: {
+                    // Rank 1 belongs at the top
+                    reverse: true,
+                    min: 1,
+                    ticks: {
+                        precision: 0,
+                        callback: function(value) {
+                            return '#' + value;
+                        },
+                        color: '#9CA3AF'
+                    }
+                }
+            }
+        }
+    });
+}
+
+document.addEventListener('DOMContentLoaded', initializeRankChart);
+
+// Live Updates
+// The server pushes HTML fragments over server-sent events; their out of band
+// swaps update the feed, reactions, comments and notification bell in place.
+// EventSource reconnects on its own, sending Last-Event-ID so missed events
+// are replayed.
+function connectLiveStream() {
+    const url = document.body.getAttribute('data-live-stream');
+    if (!url || !window.EventSource || typeof htmx === 'undefined') {
+        return;
+    }
+
+    const source = new EventSource(url);
+    const applyFragments = function(event) {
+        htmx.swap(document.body, event.data, { swapStyle: 'none' });
+    };
+
+    ['reactions', 'comment', 'notification'].forEach(type => {
+        source.addEventListener(type, applyFragments);
+    });
+
+    source.addEventListener('trade', function(event) {
+        // Skip trades the page already shows, e.g. when it loaded just after the trade
+        const fragment = document.createElement('template');
+        fragment.innerHTML = event.data;
+        const card = fragment.content.querySelector('[id^="activity-"]');
+        if (card && document.getElementById(card.id)) {
+            return;
+        }
+        applyFragments(event);
+    });
+
+    // Too much was missed to replay, so live sections reload themselves
+    source.addEventListener('resync', function() {
+        htmx.trigger(document.body, 'liveResync');
+    });
+}
+
+document.addEventListener('DOMContentLoaded', connectLiveStream);
@@ -8,6 +8,8 @@ package templates
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
+import "fmt"
+
 func Layout(title string, user *User) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
@@ -36,13 +38,23 @@ func Layout(title string, user *User) templ.Component {
 		var templ_7745c5c3_Var2 string
 		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(title)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/layout.templ`, Line: 9, Col: 17}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/layout.templ`, Line: 11, Col: 17}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " - EOG Alpaca Platform</title><link rel=\"stylesheet\" href=\"/static/css/output.css\"><script src=\"https://cdn.jsdelivr.net/npm/htmx.org@2.0.0\"></script><script src=\"https://cdn.jsdelivr.net/npm/chart.js@4.4.0/dist/chart.umd.min.js\"></script></head><body class=\"bg-gray-100 min-h-screen\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " - EOG Alpaca Platform</title><link rel=\"stylesheet\" href=\"/static/css/output.css\"><script src=\"https://cdn.jsdelivr.net/npm/htmx.org@2.0.0\"></script><script src=\"https://cdn.jsdelivr.net/npm/chart.js@4.4.0/dist/chart.umd.min.js\"></script></head><body class=\"bg-gray-100 min-h-screen\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if user != nil {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, " data-live-stream=\"/events\"")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, ">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -50,7 +62,7 @@ func Layout(title string, user *User) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<main>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<main>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -58,7 +70,7 @@ func Layout(title string, user *User) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</main><script src=\"/static/js/app.js\"></script></body></html>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</main><script src=\"/static/js/app.js\"></script></body></html>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -70,6 +82,7 @@ type User struct {
 	ID          int
 	DisplayName string
 	Initials    string
+	IsAdmin     bool
 }
 
 func Navigation(user *User) templ.Component {
@@ -93,33 +106,51 @@ func Navigation(user *User) templ.Component {
 			templ_7745c5c3_Var3 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<nav class=\"bg-eog-black text-white shadow-lg\"><div class=\"max-w-7xl mx-auto px-4 sm:px-6 lg:px-8\"><div class=\"flex items-center justify-between h-16\"><!-- Logo --><div class=\"flex items-center space-x-3\"><svg class=\"h-10 w-10 flame-icon\" viewBox=\"0 0 100 100\"><path d=\"M50 5 C35 25 20 40 25 60 C28 75 35 85 50 95 C65 85 72 75 75 60 C80 40 65 25 50 5\" fill=\"#E31B23\"></path> <path d=\"M50 25 C42 38 35 48 38 60 C40 70 45 78 50 85 C55 78 60 70 62 60 C65 48 58 38 50 25\" fill=\"#FF6B6B\"></path> <ellipse cx=\"50\" cy=\"55\" rx=\"8\" ry=\"12\" fill=\"#FFD93D\"></ellipse></svg><div><span class=\"text-xl font-bold tracking-tight\">EOG</span> <span class=\"text-xl font-light text-gray-300 ml-1\">ALPACA</span></div></div><!-- Navigation Links --><div class=\"hidden md:flex items-center space-x-8\"><a href=\"/dashboard\" class=\"nav-link font-medium text-white hover:text-eog-red transition-colors\">Dashboard</a> <a href=\"/leaderboard\" class=\"nav-link font-medium text-gray-300 hover:text-eog-red transition-colors\">Leaderboard</a> <a href=\"/activity\" class=\"nav-link font-medium text-gray-300 hover:text-eog-red transition-colors\">Activity</a> <a href=\"/search\" class=\"nav-link font-medium text-gray-300 hover:text-eog-red transition-colors\">Search</a></div><!-- User Menu --><div class=\"flex items-center space-x-4\"><div class=\"relative group\"><div class=\"flex items-center space-x-2 cursor-pointer hover:opacity-75 transition-opacity\"><div class=\"w-8 h-8 bg-eog-red rounded-full flex items-center justify-center text-white font-bold text-sm\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "<nav class=\"bg-eog-black text-white shadow-lg\"><div class=\"max-w-7xl mx-auto px-4 sm:px-6 lg:px-8\"><div class=\"flex items-center justify-between h-16\"><!-- Logo --><div class=\"flex items-center space-x-3\"><svg class=\"h-10 w-10 flame-icon\" viewBox=\"0 0 100 100\"><path d=\"M50 5 C35 25 20 40 25 60 C28 75 35 85 50 95 C65 85 72 75 75 60 C80 40 65 25 50 5\" fill=\"#E31B23\"></path> <path d=\"M50 25 C42 38 35 48 38 60 C40 70 45 78 50 85 C55 78 60 70 62 60 C65 48 58 38 50 25\" fill=\"#FF6B6B\"></path> <ellipse cx=\"50\" cy=\"55\" rx=\"8\" ry=\"12\" fill=\"#FFD93D\"></ellipse></svg><div><span class=\"text-xl font-bold tracking-tight\">EOG</span> <span class=\"text-xl font-light text-gray-300 ml-1\">ALPACA</span></div></div><!-- Navigation Links --><div class=\"hidden md:flex items-center space-x-8\"><a href=\"/dashboard\" class=\"nav-link font-medium text-white hover:text-eog-red transition-colors\">Dashboard</a> <a href=\"/leaderboard\" class=\"nav-link font-medium text-gray-300 hover:text-eog-red transition-colors\">Leaderboard</a> <a href=\"/activity\" class=\"nav-link font-medium text-gray-300 hover:text-eog-red transition-colors\">Activity</a> <a href=\"/consensus\" class=\"nav-link font-medium text-gray-300 hover:text-eog-red transition-colors\">Consensus</a> <a href=\"/leagues\" class=\"nav-link font-medium text-gray-300 hover:text-eog-red transition-colors\">Leagues</a> <a href=\"/search\" class=\"nav-link font-medium text-gray-300 hover:text-eog-red transition-colors\">Search</a></div><!-- User Menu --><div class=\"flex items-center space-x-4\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = NotificationBell().Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "<div class=\"relative group\"><div class=\"flex items-center space-x-2 cursor-pointer hover:opacity-75 transition-opacity\"><div class=\"w-8 h-8 bg-eog-red rounded-full flex items-center justify-center text-white font-bold text-sm\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		var templ_7745c5c3_Var4 string
 		templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(user.Initials)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/layout.templ`, Line: 60, Col: 22}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/layout.templ`, Line: 66, Col: 22}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</div><span class=\"hidden sm:block text-sm font-medium\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "</div><span class=\"hidden sm:block text-sm font-medium\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		var templ_7745c5c3_Var5 string
 		templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(user.DisplayName)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/layout.templ`, Line: 62, Col: 74}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/layout.templ`, Line: 68, Col: 74}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "</span></div><!-- Dropdown Menu --><div class=\"absolute right-0 mt-1 w-48 bg-white text-gray-800 rounded-lg shadow-lg invisible group-hover:visible transition-visibility duration-200 z-50\"><a href=\"/settings\" class=\"block px-4 py-2 hover:bg-gray-100 text-sm rounded-t-lg\">Settings</a> <a href=\"/logout\" class=\"block px-4 py-2 hover:bg-gray-100 text-sm rounded-b-lg border-t\">Logout</a></div></div></div></div></div></nav><style>\n\t\t.flame-icon {\n\t\t\tfilter: drop-shadow(0 0 2px rgba(227, 27, 35, 0.3));\n\t\t}\n\t\t.nav-link:hover {\n\t\t\tcolor: #E31B23;\n\t\t}\n\t</style>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 10, "</span></div><!-- Dropdown Menu --><div class=\"absolute right-0 mt-1 w-48 bg-white text-gray-800 rounded-lg shadow-lg invisible group-hover:visible transition-visibility duration-200 z-50\"><a href=\"/settings\" class=\"block px-4 py-2 hover:bg-gray-100 text-sm rounded-t-lg\">Settings</a> ")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if user.IsAdmin {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, "<a href=\"/moderation\" class=\"block px-4 py-2 hover:bg-gray-100 text-sm border-t\">Moderation</a> ")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 12, "<a href=\"/logout\" class=\"block px-4 py-2 hover:bg-gray-100 text-sm rounded-b-lg border-t\">Logout</a></div></div></div></div></div></nav><style>\n\t\t.flame-icon {\n\t\t\tfilter: drop-shadow(0 0 2px rgba(227, 27, 35, 0.3));\n\t\t}\n\t\t.nav-link:hover {\n\t\t\tcolor: #E31B23;\n\t\t}\n\t</style>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -127,4 +158,87 @@ func Navigation(user *User) templ.Component {
 	})
 }
 
+// AccountModeBadge marks whether figures come from a live or paper trading account
+func AccountModeBadge(isLive bool) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var6 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var6 == nil {
+			templ_7745c5c3_Var6 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		if isLive {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 13, "<span class=\"px-2 py-0.5 bg-amber-100 text-amber-800 text-xs font-semibold rounded-full\" title=\"Live trading account\">LIVE</span>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		} else {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 14, "<span class=\"px-2 py-0.5 bg-blue-100 text-blue-700 text-xs font-semibold rounded-full\" title=\"Paper trading account\">PAPER</span>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		return nil
+	})
+}
+
+// UnavailableNotice flags a page built from partial results because some
+// traders' Alpaca data couldn't be fetched in time
+func UnavailableNotice(count int) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var7 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var7 == nil {
+			templ_7745c5c3_Var7 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		if count > 0 {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 15, "<div class=\"mb-4 px-4 py-3 bg-amber-50 border border-amber-200 text-amber-800 text-sm rounded-lg\">Some traders unavailable (")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var8 string
+			templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs(fmt.Sprintf("%d", count))
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/layout.templ`, Line: 108, Col: 55}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var8))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 16, "); showing partial results. Refresh to try again.</div>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		return nil
+	})
+}
+
 var _ = templruntime.GeneratedTemplate